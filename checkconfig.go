@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RunCheckConfig implements the `check-config` subcommand. It returns the exit
+// code for the process.
+func RunCheckConfig(path string) int {
+	errs := CheckConfiguration(path)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: configuration is valid\n", path)
+	return 0
+}
+
+// CheckConfiguration reads the config file at the given path and validates it
+// more thoroughly than ReadConfiguration: Unknown keys are rejected, and the
+// values are checked for consistency and against the system in the chroot.
+// All problems found are reported at once.
+func CheckConfiguration(path string) (errs []error) {
+	configBytes, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("read configuration file: %w", err)}
+	}
+	var cfg Configuration
+	err = yaml.UnmarshalStrict(configBytes, &cfg)
+	if err != nil {
+		return []error{fmt.Errorf("parse configuration: %w", err)}
+	}
+	// also run the checks that are done on every regular startup and reload
+	_, err = parseConfiguration(configBytes)
+	if joinedErr, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = append(errs, joinedErr.Unwrap()...)
+	} else if err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, checkDriveGlobs(cfg.DriveGlobs)...)
+	errs = append(errs, checkSwiftIDPool(cfg.SwiftIDPool)...)
+	for idx, key := range cfg.Keys {
+		err := key.Secret.Validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("keys[%d].secret %w", idx, err))
+		}
+	}
+	if cfg.MetricsListenAddress != "" {
+		_, _, err := net.SplitHostPort(cfg.MetricsListenAddress)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for metrics-listen-address: %w", err))
+		}
+	}
+
+	chrootPath := cfg.ChrootPath
+	if chrootPath == "" {
+		chrootPath = "/"
+	}
+	if cfg.Owner.User != "" {
+		err := checkNameInDatabase(chrootPath, "etc/passwd", cfg.Owner.User)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for chown.user: %w", err))
+		}
+	}
+	if cfg.Owner.Group != "" {
+		err := checkNameInDatabase(chrootPath, "etc/group", cfg.Owner.Group)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for chown.group: %w", err))
+		}
+	}
+
+	return errs
+}
+
+func checkDriveGlobs(globs []string) (errs []error) {
+	if len(globs) == 0 {
+		return []error{errors.New("no drives configured")}
+	}
+	for _, pattern := range globs {
+		if !strings.HasPrefix(pattern, "/") {
+			errs = append(errs, fmt.Errorf("invalid glob in drives: %q is not an absolute path", pattern))
+			continue
+		}
+		_, err := filepath.Match(pattern, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid glob in drives: %q: %w", pattern, err))
+		}
+	}
+	return errs
+}
+
+func checkSwiftIDPool(pool []string) (errs []error) {
+	seen := make(map[string]bool)
+	for _, swiftID := range pool {
+		switch {
+		case swiftID == "":
+			errs = append(errs, errors.New("swift-id-pool contains an empty swift-id"))
+		case strings.Contains(swiftID, "/"):
+			errs = append(errs, fmt.Errorf("swift-id-pool contains invalid swift-id %q (must not contain slashes)", swiftID))
+		case swiftID == "spare":
+			// may appear multiple times
+		case seen[swiftID]:
+			errs = append(errs, fmt.Errorf("swift-id-pool contains duplicate swift-id %q", swiftID))
+		}
+		seen[swiftID] = true
+	}
+	return errs
+}
+
+// Checks that a user or group exists in the given database file (i.e.
+// /etc/passwd or /etc/group) within the chroot. Numeric IDs are always
+// accepted since chown(1) does not need to resolve them.
+func checkNameInDatabase(chrootPath, dbPath, name string) error {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return nil
+	}
+
+	fullPath := filepath.Join(chrootPath, dbPath)
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entryName, _, _ := strings.Cut(scanner.Text(), ":")
+		if entryName == name {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", fullPath, err)
+	}
+	return fmt.Errorf("%q not found in %s", name, fullPath)
+}
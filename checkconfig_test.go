@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	std_os "os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupCheckConfig(t *testing.T, configYAML string) string {
+	t.Helper()
+	dir := t.TempDir()
+	chrootPath := filepath.Join(dir, "chroot")
+	files := map[string]string{
+		"chroot/etc/passwd": "root:x:0:0:root:/root:/bin/sh\nswift:x:1000:1000::/var/lib/swift:/sbin/nologin\n",
+		"chroot/etc/group":  "root:x:0:\nswift:x:1000:\n",
+		"config.yaml":       strings.ReplaceAll(configYAML, "$CHROOT", chrootPath),
+	}
+	for path, contents := range files {
+		fullPath := filepath.Join(dir, path)
+		err := std_os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err == nil {
+			err = std_os.WriteFile(fullPath, []byte(contents), 0644)
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+func expectCheckConfigErrors(t *testing.T, path string, expected ...string) {
+	t.Helper()
+	var actual []string
+	for _, err := range CheckConfiguration(path) {
+		actual = append(actual, err.Error())
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected errors:\n\t%s\nbut got:\n\t%s", strings.Join(expected, "\n\t"), strings.Join(actual, "\n\t"))
+	}
+}
+
+func TestCheckConfigValid(t *testing.T) {
+	t.Setenv("AUTOPILOT_TEST_KEY", "secret")
+	path := setupCheckConfig(t, `{
+		chroot: "$CHROOT",
+		drives: [ "/dev/sd[a-z]", "/dev/sd[a-z][a-z]" ],
+		chown: { user: swift, group: "1000" },
+		keys: [ { secret: { fromEnv: AUTOPILOT_TEST_KEY } } ],
+		swift-id-pool: [ swift1, spare, swift2, spare ],
+		format-options: [ "-i", "size=1024" ],
+		mount-options: [ noatime, nodiratime, "logbufs=8" ],
+		luks: { version: 2, cipher: aes-xts-plain64, key-size: 512, sector-size: 4096, pbkdf: { type: pbkdf2, iterations: 1000 }, allow-discards: true },
+		metrics-listen-address: ":9102",
+	}`)
+	expectCheckConfigErrors(t, path)
+}
+
+func TestCheckConfigRejectsUnknownKeys(t *testing.T) {
+	path := setupCheckConfig(t, `{ drives: [ "/dev/sd[a-z]" ], swift-id-poll: [ swift1 ] }`)
+	expectCheckConfigErrors(t, path,
+		"parse configuration: yaml: unmarshal errors:\n  line 1: field swift-id-poll not found in type main.Configuration",
+	)
+}
+
+func TestCheckConfigRejectsInvalidValues(t *testing.T) {
+	path := setupCheckConfig(t, `{
+		chroot: "$CHROOT",
+		drives: [ "/dev/sd[a-z", "dev/sdb" ],
+		chown: { user: nobody, group: swift },
+		keys: [ { secret: "" } ],
+		swift-id-pool: [ swift1, swift2, swift1, "swift/3" ],
+		mount-options: [ "noatime,nodiratime", ro ],
+	}`)
+	chrootPath := filepath.Join(filepath.Dir(path), "chroot")
+	expectCheckConfigErrors(t, path,
+		`mount-options contains invalid option "noatime,nodiratime" (give each option as a separate list entry)`,
+		`mount-options contains forbidden option "ro"`,
+		`invalid glob in drives: "/dev/sd[a-z": syntax error in pattern`,
+		`invalid glob in drives: "dev/sdb" is not an absolute path`,
+		`swift-id-pool contains duplicate swift-id "swift1"`,
+		`swift-id-pool contains invalid swift-id "swift/3" (must not contain slashes)`,
+		`keys[0].secret is empty`,
+		`invalid value for chown.user: "nobody" not found in `+chrootPath+`/etc/passwd`,
+	)
+}
+
+func TestCheckConfigRejectsInvalidLUKSParameters(t *testing.T) {
+	path := setupCheckConfig(t, `{
+		drives: [ "/dev/sd[a-z]" ],
+		luks: { version: 1, key-size: 500, sector-size: 4096, pbkdf: { type: argon2id, iterations: 4, memory: 65536, iter-time: 100 } },
+	}`)
+	expectCheckConfigErrors(t, path,
+		`invalid value for luks.key-size: 500 (must be a multiple of 8)`,
+		`luks.sector-size cannot be used with luks.version = 1`,
+		`luks.pbkdf.type "argon2id" cannot be used with luks.version = 1`,
+		`only one of luks.pbkdf.iterations and luks.pbkdf.iter-time may be given`,
+		`luks.pbkdf.memory can only be used with argon2i or argon2id`,
+	)
+}
+
+func TestCheckConfigRejectsMissingEnvKey(t *testing.T) {
+	path := setupCheckConfig(t, `{ drives: [ "/dev/sd[a-z]" ], keys: [ { secret: { fromEnv: AUTOPILOT_MISSING_KEY } } ] }`)
+	errs := CheckConfiguration(path)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "AUTOPILOT_MISSING_KEY") {
+		t.Errorf("expected an error about AUTOPILOT_MISSING_KEY, but got %v", errs)
+	}
+}
@@ -4,10 +4,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	std_os "os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/sapcc/go-bits/logg"
+
 	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
 	"github.com/sapcc/swift-drive-autopilot/pkg/util"
 )
 
@@ -19,6 +28,18 @@ type Event interface {
 	Handle(c *Converger)
 }
 
+// sendEvents sends a batch of events to the converger, unless shutdown has
+// been requested. Returns false in the latter case, in which case the collector
+// shall return.
+func sendEvents(ctx context.Context, queue chan<- []Event, events []Event) bool {
+	select {
+	case queue <- events:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // drive collector
 
@@ -27,6 +48,20 @@ type DriveAddedEvent struct {
 	DevicePath   string
 	FoundAtPath  string // the DevicePath before symlinks were expanded
 	SerialNumber string // may be empty if it cannot be determined
+	WWN          string // may be empty if it cannot be determined
+	Model        string // may be empty if it cannot be determined
+}
+
+// newDriveAddedEvent builds the DriveAddedEvent for a drive that was reported
+// by os.Interface.CollectDrives().
+func newDriveAddedEvent(drive os.Drive) DriveAddedEvent {
+	return DriveAddedEvent{
+		DevicePath:   drive.DevicePath,
+		FoundAtPath:  drive.FoundAtPath,
+		SerialNumber: drive.SerialNumber,
+		WWN:          drive.WWN,
+		Model:        drive.Model,
+	}
 }
 
 // LogMessage implements the Event interface.
@@ -59,34 +94,63 @@ func (e DriveRemovedEvent) EventType() string {
 
 // CollectDriveEvents is a collector thread that emits DriveAddedEvent and
 // DriveRemovedEvent.
-func CollectDriveEvents(osi os.Interface, queue chan []Event) {
+func CollectDriveEvents(ctx context.Context, osi os.Interface, watchUevents bool, queue chan []Event) {
 	added := make(chan []os.Drive)
 	removed := make(chan []string)
-	trigger := util.StandardTrigger(5*time.Second, "run/swift-storage/check-drives", true)
-	go osi.CollectDrives(Config.DriveGlobs, trigger, added, removed)
+	go osi.CollectDrives(GetDriveGlobs, driveCollectionTrigger(watchUevents), added, removed)
 
 	for {
+		var events []Event
 		select {
+		case <-ctx.Done():
+			return
 		case drives := <-added:
-			events := make([]Event, len(drives))
+			events = make([]Event, len(drives))
 			for idx, drive := range drives {
-				events[idx] = DriveAddedEvent{
-					DevicePath:   drive.DevicePath,
-					FoundAtPath:  drive.FoundAtPath,
-					SerialNumber: drive.SerialNumber,
-				}
+				events[idx] = newDriveAddedEvent(drive)
 			}
-			queue <- events
 		case devicePaths := <-removed:
-			events := make([]Event, len(devicePaths))
+			events = make([]Event, len(devicePaths))
 			for idx, devicePath := range devicePaths {
 				events[idx] = DriveRemovedEvent{DevicePath: devicePath}
 			}
-			queue <- events
+		}
+		if !sendEvents(ctx, queue, events) {
+			return
 		}
 	}
 }
 
+// Returns the trigger for the work cycles of CollectDrives. By default, the
+// drive globs are evaluated every 5 seconds. When uevents are watched, each
+// uevent for a block device triggers a work cycle immediately (and another one
+// once udevd has created its symlinks), and the periodic work cycle only serves
+// as a safety net for lost events.
+func driveCollectionTrigger(watchUevents bool) <-chan struct{} {
+	if !watchUevents {
+		return util.StandardTrigger(5*time.Second, "run/swift-storage/check-drives", true)
+	}
+
+	trigger := make(chan struct{}, 1)
+	err := os.WatchBlockDeviceUevents(trigger)
+	if err != nil {
+		logg.Error("cannot watch uevents (will only check for drives every 5 seconds): %s", err.Error())
+		return util.StandardTrigger(5*time.Second, "run/swift-storage/check-drives", true)
+	}
+
+	periodic := util.StandardTrigger(5*time.Second, "run/swift-storage/check-drives", true)
+	go func() {
+		for range periodic {
+			select {
+			case trigger <- struct{}{}:
+			default:
+				// a work cycle is already pending
+			}
+		}
+	}()
+	return trigger
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // reinstatement collector
 
@@ -108,7 +172,7 @@ func (e DriveReinstatedEvent) EventType() string {
 // CollectReinstatements watches /run/swift-storage/broken and
 // /var/lib/swift-storage/broken and issues a DriveReinstatedEvent whenever a
 // broken-flag in there is deleted by an administrator.
-func CollectReinstatements(queue chan []Event) {
+func CollectReinstatements(ctx context.Context, queue chan []Event) {
 	// tracks broken devices between loop iterations; we only send an event when
 	// a device is removed from this set
 	brokenDevices := make(map[string]bool)
@@ -141,12 +205,16 @@ OUTER:
 		brokenDevices = newBrokenDevices
 
 		// wake up the converger thread
-		if len(events) > 0 {
-			queue <- events
+		if len(events) > 0 && !sendEvents(ctx, queue, events) {
+			return
 		}
 
 		// sleep for 5 seconds before re-running
-		time.Sleep(interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
 	}
 }
 
@@ -156,10 +224,17 @@ OUTER:
 // ScheduleWakeups is a collector job that pushes a no-op event every 30 seconds
 // to invoke the consistency checks that the converger executes during each of
 // its event loop iterations.
-func ScheduleWakeups(queue chan []Event) {
+func ScheduleWakeups(ctx context.Context, queue chan []Event) {
 	trigger := util.StandardTrigger(30*time.Second, "run/swift-storage/wakeup", false)
-	for range trigger {
-		queue <- []Event{WakeupEvent{}}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+			if !sendEvents(ctx, queue, []Event{WakeupEvent{}}) {
+				return
+			}
+		}
 	}
 }
 
@@ -195,6 +270,7 @@ func (e WakeupEvent) Handle(c *Converger) {
 type DriveErrorEvent struct {
 	DevicePath string
 	LogLine    string
+	Time       time.Time
 }
 
 // LogMessage implements the Event interface.
@@ -208,17 +284,180 @@ func (e DriveErrorEvent) EventType() string {
 }
 
 // WatchKernelLog is a collector job that sends DriveErrorEvent when the kernel
-// log contains an error regarding a SCSI disk.
-func WatchKernelLog(osi os.Interface, queue chan []Event) {
+// log contains an error regarding a drive.
+func WatchKernelLog(ctx context.Context, osi os.Interface, queue chan []Event) {
 	errors := make(chan []os.DriveError)
-	go osi.CollectDriveErrors(errors)
-
-	for errs := range errors {
-		for _, err := range errs {
-			queue <- []Event{DriveErrorEvent{
-				DevicePath: err.DevicePath,
-				LogLine:    err.Message,
-			}}
+	alive := make(chan bool)
+	go osi.CollectDriveErrors(GetKernelLogPatterns, errors, alive)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case isAlive := <-alive:
+			if isAlive {
+				kernelLogWatcherGauge.Set(1)
+			} else {
+				kernelLogWatcherGauge.Set(0)
+			}
+		case errs := <-errors:
+			for _, err := range errs {
+				event := DriveErrorEvent{
+					DevicePath: err.DevicePath,
+					LogLine:    err.Message,
+					Time:       time.Now(),
+				}
+				if !sendEvents(ctx, queue, []Event{event}) {
+					return
+				}
+			}
 		}
 	}
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// SMART health collector
+
+// DriveHealthEvent is emitted by the CollectSMARTHealth collector.
+type DriveHealthEvent struct {
+	DevicePath string
+	Health     parsers.SMARTHealth
+}
+
+// LogMessage implements the Event interface.
+//
+// The DriveHealthEvent does not produce an "event received" log message
+// because it occurs regularly for every drive. Concerning health indicators
+// are logged by the event handler.
+func (e DriveHealthEvent) LogMessage() string {
+	return ""
+}
+
+// EventType implements the Event interface.
+func (e DriveHealthEvent) EventType() string {
+	return "drive-health"
+}
+
+// The SMART health collector needs to know which drives the converger knows
+// about, so the converger publishes their device paths here.
+var knownDevicePaths = struct {
+	mutex sync.RWMutex
+	paths []string
+}{}
+
+func setKnownDevicePaths(paths []string) {
+	knownDevicePaths.mutex.Lock()
+	defer knownDevicePaths.mutex.Unlock()
+	knownDevicePaths.paths = paths
+}
+
+func getKnownDevicePaths() []string {
+	knownDevicePaths.mutex.RLock()
+	defer knownDevicePaths.mutex.RUnlock()
+	return slices.Clone(knownDevicePaths.paths)
+}
+
+// CollectSMARTHealth is a collector job that periodically reads the SMART
+// health indicators of all known drives and sends them as DriveHealthEvent.
+func CollectSMARTHealth(ctx context.Context, osi os.Interface, interval time.Duration, queue chan []Event) {
+	trigger := util.StandardTrigger(interval, "run/swift-storage/check-smart", false)
+	// the first check happens shortly after startup, once the converger knows
+	// about the drives
+	initial := time.After(util.GetJobInterval(1*time.Minute, 1*time.Second))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-initial:
+		case <-trigger:
+		}
+
+		events := readSMARTHealth(osi, getKnownDevicePaths())
+		if len(events) > 0 && !sendEvents(ctx, queue, events) {
+			return
+		}
+	}
+}
+
+func readSMARTHealth(osi os.Interface, devicePaths []string) []Event {
+	var events []Event
+	for _, devicePath := range devicePaths {
+		health, err := osi.ReadSMARTHealth(devicePath)
+		if err != nil {
+			logg.Error("cannot read SMART health of %s: %s", devicePath, err.Error())
+			continue
+		}
+		events = append(events, DriveHealthEvent{DevicePath: devicePath, Health: health})
+	}
+	return events
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// configuration reloader
+
+// ConfigChangedEvent is emitted by the CollectConfigChanges collector.
+type ConfigChangedEvent struct {
+	Path      string
+	NewConfig Configuration
+}
+
+// LogMessage implements the Event interface.
+func (e ConfigChangedEvent) LogMessage() string {
+	return "configuration reloaded from " + e.Path
+}
+
+// EventType implements the Event interface.
+func (e ConfigChangedEvent) EventType() string {
+	return "config-changed"
+}
+
+// CollectConfigChanges is a collector job that re-reads the configuration file
+// whenever SIGHUP is received, and sends a ConfigChangedEvent if it is valid.
+// The converger decides whether the changes can be applied without a restart.
+func CollectConfigChanges(ctx context.Context, path string, queue chan []Event) {
+	sighup := make(chan std_os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			cfg, err := ReadConfiguration(path)
+			if err != nil {
+				logg.Error("could not reload configuration: %s", err.Error())
+				continue
+			}
+			if !sendEvents(ctx, queue, []Event{ConfigChangedEvent{Path: path, NewConfig: cfg}}) {
+				return
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// shutdown
+
+// ShutdownEvent is emitted by the WaitForShutdown collector.
+type ShutdownEvent struct{}
+
+// LogMessage implements the Event interface.
+func (e ShutdownEvent) LogMessage() string {
+	return "shutdown requested"
+}
+
+// EventType implements the Event interface.
+func (e ShutdownEvent) EventType() string {
+	return "shutdown"
+}
+
+// WaitForShutdown is a collector job that sends a ShutdownEvent when the given
+// context expires (i.e. when SIGINT or SIGTERM is received). The other
+// collectors stop at the same time, so this is the last event that the
+// converger receives.
+func WaitForShutdown(ctx context.Context, queue chan []Event) {
+	<-ctx.Done()
+	queue <- []Event{ShutdownEvent{}}
+}
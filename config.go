@@ -4,64 +4,513 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	std_os "os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/sapcc/go-api-declarations/bininfo"
-	"github.com/sapcc/go-bits/logg"
-	"github.com/sapcc/go-bits/secrets"
 	yaml "gopkg.in/yaml.v2"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
 )
 
 // Configuration represents the content of the config file.
 type Configuration struct {
-	ChrootPath string   `yaml:"chroot"`
-	DriveGlobs []string `yaml:"drives"`
-	Owner      struct {
+	ChrootPath          string                  `yaml:"chroot"`
+	DriveGlobs          []string                `yaml:"drives"`
+	SerialNumberSources []os.SerialNumberSource `yaml:"serial-number-sources"`
+	IgnoredMountPaths   []string                `yaml:"ignored-mount-paths"`
+	Owner               struct {
 		User  string `yaml:"user"`
 		Group string `yaml:"group"`
 	} `yaml:"chown"`
 	Keys []struct {
-		// this is a struct to later support the addition of a Method field to
-		// specify the key derivation method
-		Secret secrets.FromEnv `yaml:"secret"`
+		Secret KeySource                `yaml:"secret"`
+		Method core.KeyDerivationMethod `yaml:"method"`
 	} `yaml:"keys"`
-	SwiftIDPool          []string `yaml:"swift-id-pool"`
-	MetricsListenAddress string   `yaml:"metrics-listen-address"`
+	LUKS struct {
+		RemoveRetiredKeys bool   `yaml:"remove-retired-keys"`
+		Version           int    `yaml:"version"`
+		Cipher            string `yaml:"cipher"`
+		KeySize           int    `yaml:"key-size"`
+		SectorSize        int    `yaml:"sector-size"`
+		PBKDF             struct {
+			Type       string `yaml:"type"`
+			Iterations int    `yaml:"iterations"`
+			Memory     int    `yaml:"memory"`
+			IterTime   int    `yaml:"iter-time"`
+		} `yaml:"pbkdf"`
+		AllowDiscards    bool `yaml:"allow-discards"`
+		NoReadWorkqueue  bool `yaml:"no-read-workqueue"`
+		NoWriteWorkqueue bool `yaml:"no-write-workqueue"`
+	} `yaml:"luks"`
+	Filesystem          os.FilesystemType `yaml:"filesystem"`
+	FormatOptions       []string          `yaml:"format-options"`
+	MountOptions        []string          `yaml:"mount-options"`
+	FsckBeforeMount     bool              `yaml:"fsck-before-mount"`
+	NearlyFullThreshold int               `yaml:"nearly-full-threshold"`
+	SwiftIDPool         []string          `yaml:"swift-id-pool"`
+	KernelLog           struct {
+		ErrorPatterns    []string `yaml:"error-patterns"`
+		IgnorePatterns   []string `yaml:"ignore-patterns"`
+		DevicePatterns   []string `yaml:"device-patterns"`
+		DriveAuditConfig string   `yaml:"drive-audit-config"`
+		ErrorPolicies    []struct {
+			Name      string `yaml:"name"`
+			Pattern   string `yaml:"pattern"`
+			Threshold int    `yaml:"threshold"`
+			Interval  string `yaml:"interval"`
+		} `yaml:"error-policies"`
+	} `yaml:"kernel-log"`
+	SMART struct {
+		Interval           string               `yaml:"interval"`
+		FailedHealthCheck  core.SMARTAction     `yaml:"failed-health-check"`
+		ReallocatedSectors core.SMARTThresholds `yaml:"reallocated-sectors"`
+		PendingSectors     core.SMARTThresholds `yaml:"pending-sectors"`
+		Temperature        core.SMARTThresholds `yaml:"temperature"`
+	} `yaml:"smart"`
+	WatchUevents         bool           `yaml:"watch-uevents"`
+	MetricsListenAddress string         `yaml:"metrics-listen-address"`
+	ShutdownPolicy       ShutdownPolicy `yaml:"shutdown-policy"`
+
+	// compiled from KernelLog by parseConfiguration()
+	kernelLogPatterns os.KernelLogPatterns
+	errorPolicies     []core.ErrorPolicy
+	// compiled from SMART.Interval by parseConfiguration()
+	smartInterval time.Duration
 }
 
+// ShutdownPolicy appears in type Configuration. It describes what happens to
+// the drives when the autopilot is stopped with SIGINT or SIGTERM.
+type ShutdownPolicy string
+
+const (
+	// KeepMountedOnShutdown is the default ShutdownPolicy. All mounts and LUKS
+	// mappings are left in place, so Swift can continue to use the drives while
+	// the autopilot is restarted (e.g. during a rolling update).
+	KeepMountedOnShutdown ShutdownPolicy = "keep-mounted"
+	// UnmountAllOnShutdown is a ShutdownPolicy. All drives are unmounted and
+	// all LUKS containers are closed before the autopilot exits.
+	UnmountAllOnShutdown ShutdownPolicy = "unmount-all"
+)
+
 // Config is the global Configuration instance that's filled by main() at
-// program start.
+// program start. It is only accessed by the converger thread afterwards, which
+// replaces it when a ConfigChangedEvent is handled.
 var Config Configuration
 
-func init() {
-	bininfo.HandleVersionArgument()
+// The drive collector needs to see changes to Config.DriveGlobs, but runs in a
+// different thread than the converger, so it gets its own copy guarded by a
+// mutex.
+var currentDriveGlobs = struct {
+	mutex sync.RWMutex
+	globs []string
+}{}
+
+// SetDriveGlobs updates the globs returned by GetDriveGlobs.
+func SetDriveGlobs(globs []string) {
+	currentDriveGlobs.mutex.Lock()
+	defer currentDriveGlobs.mutex.Unlock()
+	currentDriveGlobs.globs = slices.Clone(globs)
+}
+
+// GetDriveGlobs returns the drive globs from the current configuration. This
+// can be called from any thread.
+func GetDriveGlobs() []string {
+	currentDriveGlobs.mutex.RLock()
+	defer currentDriveGlobs.mutex.RUnlock()
+	return slices.Clone(currentDriveGlobs.globs)
+}
+
+// Likewise, the kernel log collector needs to see changes to the kernel log
+// patterns.
+var currentKernelLogPatterns = struct {
+	mutex    sync.RWMutex
+	patterns os.KernelLogPatterns
+}{}
+
+// SetKernelLogPatterns updates the patterns returned by GetKernelLogPatterns.
+func SetKernelLogPatterns(patterns os.KernelLogPatterns) {
+	currentKernelLogPatterns.mutex.Lock()
+	defer currentKernelLogPatterns.mutex.Unlock()
+	currentKernelLogPatterns.patterns = patterns
+}
+
+// GetKernelLogPatterns returns the kernel log patterns from the current
+// configuration. This can be called from any thread.
+func GetKernelLogPatterns() os.KernelLogPatterns {
+	currentKernelLogPatterns.mutex.RLock()
+	defer currentKernelLogPatterns.mutex.RUnlock()
+	return currentKernelLogPatterns.patterns
+}
+
+// ReadConfiguration reads the config file at the given path.
+func ReadConfiguration(path string) (Configuration, error) {
+	configBytes, err := std_os.ReadFile(path)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("read configuration file: %w", err)
+	}
+	return parseConfiguration(configBytes)
+}
+
+func parseConfiguration(configBytes []byte) (Configuration, error) {
+	var cfg Configuration
+	err := yaml.Unmarshal(configBytes, &cfg) //nolint:gosec // you won't believe this, gosec, but our config file is not "untrusted data"
+	if err != nil {
+		return cfg, fmt.Errorf("parse configuration: %w", err)
+	}
+
+	switch cfg.Filesystem {
+	case "":
+		cfg.Filesystem = os.FilesystemXFS
+	case os.FilesystemXFS, os.FilesystemExt4:
+		// valid
+	default:
+		return cfg, fmt.Errorf("invalid value for filesystem: %q (expected %q or %q)",
+			cfg.Filesystem, os.FilesystemXFS, os.FilesystemExt4)
+	}
+
+	errs := checkMountOptions(cfg.MountOptions)
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+
+	if cfg.NearlyFullThreshold < 0 || cfg.NearlyFullThreshold > 100 {
+		return cfg, fmt.Errorf("invalid value for nearly-full-threshold: %d (expected a percentage from 0 (disabled) to 100)",
+			cfg.NearlyFullThreshold)
+	}
+
+	for idx, key := range cfg.Keys {
+		switch key.Method {
+		case "":
+			cfg.Keys[idx].Method = core.KeyDerivationNone
+		case core.KeyDerivationNone, core.KeyDerivationHKDFSHA256:
+			// valid
+		default:
+			return cfg, fmt.Errorf("invalid value for keys[%d].method: %q (expected %q or %q)",
+				idx, key.Method, core.KeyDerivationNone, core.KeyDerivationHKDFSHA256)
+		}
+	}
+
+	if len(cfg.SerialNumberSources) == 0 {
+		cfg.SerialNumberSources = slices.Clone(os.DefaultSerialNumberSources)
+	}
+	for idx, source := range cfg.SerialNumberSources {
+		if !slices.Contains(os.AllSerialNumberSources, source) {
+			return cfg, fmt.Errorf("invalid value for serial-number-sources[%d]: %q (expected %q, %q, %q, %q or %q)",
+				idx, source, os.SerialFromSysfs, os.SerialFromUdev, os.WWNFromSysfs, os.WWNFromUdev, os.SerialFromSmartctl)
+		}
+	}
+
+	// an explicitly empty list disables the default
+	if cfg.IgnoredMountPaths == nil {
+		cfg.IgnoredMountPaths = slices.Clone(os.DefaultIgnoredMountPaths)
+	}
+	for idx, path := range cfg.IgnoredMountPaths {
+		if !filepath.IsAbs(path) {
+			return cfg, fmt.Errorf("invalid value for ignored-mount-paths[%d]: %q (expected an absolute path)", idx, path)
+		}
+	}
 
-	// expect one argument (config file name)
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <config-file>\n", os.Args[0])
-		os.Exit(1)
+	switch cfg.LUKS.Version {
+	case 0, 1, 2:
+		// valid
+	default:
+		return cfg, fmt.Errorf("invalid value for luks.version: %d (expected 1 or 2)", cfg.LUKS.Version)
+	}
+	switch cfg.LUKS.PBKDF.Type {
+	case "", "pbkdf2", "argon2i", "argon2id":
+		// valid
+	default:
+		return cfg, fmt.Errorf("invalid value for luks.pbkdf.type: %q (expected %q, %q or %q)",
+			cfg.LUKS.PBKDF.Type, "pbkdf2", "argon2i", "argon2id")
+	}
+	errs = checkLUKSParameters(cfg)
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
 	}
 
-	// read config file
-	configBytes, err := os.ReadFile(os.Args[1])
+	cfg.kernelLogPatterns, err = cfg.compileKernelLogPatterns()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.errorPolicies, err = cfg.compileErrorPolicies()
 	if err != nil {
-		logg.Fatal("read configuration file: %s", err.Error())
+		return cfg, err
 	}
-	err = yaml.Unmarshal(configBytes, &Config) //nolint:gosec // you won't believe this, gosec, but our config file is not "untrusted data"
+
+	err = cfg.validateSMART()
 	if err != nil {
-		logg.Fatal("parse configuration: %s", err.Error())
+		return cfg, err
+	}
+
+	switch cfg.ShutdownPolicy {
+	case "":
+		cfg.ShutdownPolicy = KeepMountedOnShutdown
+	case KeepMountedOnShutdown, UnmountAllOnShutdown:
+		// valid
+	default:
+		return cfg, fmt.Errorf("invalid value for shutdown-policy: %q (expected %q or %q)",
+			cfg.ShutdownPolicy, KeepMountedOnShutdown, UnmountAllOnShutdown)
 	}
 
 	// if there are multiple "spare" entries in the SwiftIDPool, disambiguate
 	// them into "spare/0", "spare/1", and so on
-	if len(Config.SwiftIDPool) > 0 {
+	if len(cfg.SwiftIDPool) > 0 {
 		spareIdx := 0
-		for idx, str := range Config.SwiftIDPool {
+		for idx, str := range cfg.SwiftIDPool {
 			if str == "spare" {
-				Config.SwiftIDPool[idx] = fmt.Sprintf("spare/%d", spareIdx)
+				cfg.SwiftIDPool[idx] = fmt.Sprintf("spare/%d", spareIdx)
 				spareIdx++
 			}
 		}
 	}
+
+	return cfg, nil
+}
+
+func checkMountOptions(options []string) (errs []error) {
+	for _, option := range options {
+		switch {
+		case option == "":
+			errs = append(errs, errors.New("mount-options contains an empty option"))
+		case strings.Contains(option, ","):
+			errs = append(errs, fmt.Errorf("mount-options contains invalid option %q (give each option as a separate list entry)", option))
+		case option == "ro" || option == "remount":
+			errs = append(errs, fmt.Errorf("mount-options contains forbidden option %q", option))
+		}
+	}
+	return errs
+}
+
+func checkLUKSParameters(cfg Configuration) (errs []error) {
+	luks := cfg.LUKS
+	if luks.KeySize < 0 || luks.KeySize%8 != 0 {
+		errs = append(errs, fmt.Errorf("invalid value for luks.key-size: %d (must be a multiple of 8)", luks.KeySize))
+	}
+	switch luks.SectorSize {
+	case 0:
+		// not given
+	case 512, 1024, 2048, 4096:
+		if luks.Version == 1 {
+			errs = append(errs, errors.New("luks.sector-size cannot be used with luks.version = 1"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid value for luks.sector-size: %d (expected 512, 1024, 2048 or 4096)", luks.SectorSize))
+	}
+
+	pbkdf := luks.PBKDF
+	if luks.Version == 1 && pbkdf.Type != "" && pbkdf.Type != "pbkdf2" {
+		errs = append(errs, fmt.Errorf("luks.pbkdf.type %q cannot be used with luks.version = 1", pbkdf.Type))
+	}
+	if pbkdf.Iterations < 0 || pbkdf.Memory < 0 || pbkdf.IterTime < 0 {
+		errs = append(errs, errors.New("luks.pbkdf.iterations, luks.pbkdf.memory and luks.pbkdf.iter-time must not be negative"))
+	}
+	if pbkdf.Iterations != 0 && pbkdf.IterTime != 0 {
+		errs = append(errs, errors.New("only one of luks.pbkdf.iterations and luks.pbkdf.iter-time may be given"))
+	}
+	if pbkdf.Memory != 0 && (pbkdf.Type == "pbkdf2" || luks.Version == 1) {
+		errs = append(errs, errors.New("luks.pbkdf.memory can only be used with argon2i or argon2id"))
+	}
+	return errs
+}
+
+func (cfg Configuration) compileKernelLogPatterns() (os.KernelLogPatterns, error) {
+	errorPatterns := cfg.KernelLog.ErrorPatterns
+	if cfg.KernelLog.DriveAuditConfig != "" {
+		buf, err := std_os.ReadFile(cfg.KernelLog.DriveAuditConfig)
+		if err != nil {
+			return os.KernelLogPatterns{}, fmt.Errorf("read kernel-log.drive-audit-config: %w", err)
+		}
+		auditPatterns, err := parsers.ParseDriveAuditConfig(string(buf))
+		if err != nil {
+			return os.KernelLogPatterns{}, fmt.Errorf("parse kernel-log.drive-audit-config %s: %w", cfg.KernelLog.DriveAuditConfig, err)
+		}
+		errorPatterns = append(slices.Clone(errorPatterns), auditPatterns...)
+	}
+
+	result := os.DefaultKernelLogPatterns()
+	compile := func(field string, patterns []string, target *[]*regexp.Regexp) error {
+		if len(patterns) == 0 {
+			return nil // keep default
+		}
+		*target = make([]*regexp.Regexp, len(patterns))
+		for idx, pattern := range patterns {
+			rx, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid regex in kernel-log.%s: %w", field, err)
+			}
+			(*target)[idx] = rx
+		}
+		return nil
+	}
+	err := compile("error-patterns", errorPatterns, &result.ErrorPatterns)
+	if err == nil {
+		err = compile("ignore-patterns", cfg.KernelLog.IgnorePatterns, &result.IgnorePatterns)
+	}
+	if err == nil {
+		err = compile("device-patterns", cfg.KernelLog.DevicePatterns, &result.DevicePatterns)
+	}
+	return result, err
+}
+
+func (cfg Configuration) compileErrorPolicies() ([]core.ErrorPolicy, error) {
+	result := make([]core.ErrorPolicy, len(cfg.KernelLog.ErrorPolicies))
+	for idx, p := range cfg.KernelLog.ErrorPolicies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("missing value for kernel-log.error-policies[%d].name", idx)
+		}
+		for _, other := range result[:idx] {
+			if other.Name == p.Name {
+				return nil, fmt.Errorf("duplicate value for kernel-log.error-policies[%d].name: %q", idx, p.Name)
+			}
+		}
+		policy := core.ErrorPolicy{Name: p.Name, Threshold: p.Threshold}
+
+		if p.Pattern != "" {
+			rx, err := regexp.Compile(p.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex in kernel-log.error-policies[%d].pattern: %w", idx, err)
+			}
+			policy.Pattern = rx
+		}
+
+		switch {
+		case p.Threshold < 0:
+			return nil, fmt.Errorf("invalid value for kernel-log.error-policies[%d].threshold: %d (expected a positive number)", idx, p.Threshold)
+		case p.Threshold == 0:
+			policy.Threshold = 1
+		}
+
+		if p.Interval != "" {
+			interval, err := time.ParseDuration(p.Interval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid value for kernel-log.error-policies[%d].interval: %q (expected a positive duration like \"10m\")", idx, p.Interval)
+			}
+			policy.Interval = interval
+		} else if policy.Threshold > 1 {
+			return nil, fmt.Errorf("missing value for kernel-log.error-policies[%d].interval (required if threshold is greater than 1)", idx)
+		}
+
+		result[idx] = policy
+	}
+	return result, nil
+}
+
+func (cfg *Configuration) validateSMART() error {
+	if cfg.SMART.Interval != "" {
+		interval, err := time.ParseDuration(cfg.SMART.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid value for smart.interval: %q (expected a positive duration like \"1h\")", cfg.SMART.Interval)
+		}
+		cfg.smartInterval = interval
+	}
+
+	switch cfg.SMART.FailedHealthCheck {
+	case "":
+		cfg.SMART.FailedHealthCheck = core.SMARTActionBroken
+	case core.SMARTActionWarn, core.SMARTActionSuspect, core.SMARTActionBroken:
+		// valid
+	default:
+		return fmt.Errorf("invalid value for smart.failed-health-check: %q (expected %q, %q or %q)",
+			cfg.SMART.FailedHealthCheck, core.SMARTActionWarn, core.SMARTActionSuspect, core.SMARTActionBroken)
+	}
+
+	for _, t := range []struct {
+		Field      string
+		Thresholds core.SMARTThresholds
+	}{
+		{"reallocated-sectors", cfg.SMART.ReallocatedSectors},
+		{"pending-sectors", cfg.SMART.PendingSectors},
+		{"temperature", cfg.SMART.Temperature},
+	} {
+		values := []int64{t.Thresholds.Warn, t.Thresholds.Suspect, t.Thresholds.Broken}
+		actions := []core.SMARTAction{core.SMARTActionWarn, core.SMARTActionSuspect, core.SMARTActionBroken}
+		for idx, value := range values {
+			if value < 0 {
+				return fmt.Errorf("invalid value for smart.%s.%s: %d (expected a positive number)", t.Field, actions[idx], value)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckReload returns an error if the given new configuration contains changes
+// that cannot be applied without restarting the autopilot.
+func (cfg Configuration) CheckReload(newCfg Configuration) error {
+	if cfg.ChrootPath != newCfg.ChrootPath {
+		return fmt.Errorf("cannot change chroot from %q to %q without a restart", cfg.ChrootPath, newCfg.ChrootPath)
+	}
+	if !slices.Equal(cfg.SerialNumberSources, newCfg.SerialNumberSources) {
+		return fmt.Errorf("cannot change serial-number-sources from %v to %v without a restart", cfg.SerialNumberSources, newCfg.SerialNumberSources)
+	}
+	if !slices.Equal(cfg.IgnoredMountPaths, newCfg.IgnoredMountPaths) {
+		return fmt.Errorf("cannot change ignored-mount-paths from %v to %v without a restart", cfg.IgnoredMountPaths, newCfg.IgnoredMountPaths)
+	}
+	if cfg.SMART.Interval != newCfg.SMART.Interval {
+		return fmt.Errorf("cannot change smart.interval from %q to %q without a restart", cfg.SMART.Interval, newCfg.SMART.Interval)
+	}
+	if cfg.WatchUevents != newCfg.WatchUevents {
+		return fmt.Errorf("cannot change watch-uevents from %t to %t without a restart", cfg.WatchUevents, newCfg.WatchUevents)
+	}
+	if cfg.MetricsListenAddress != newCfg.MetricsListenAddress {
+		return fmt.Errorf("cannot change metrics-listen-address from %q to %q without a restart",
+			cfg.MetricsListenAddress, newCfg.MetricsListenAddress)
+	}
+	return nil
+}
+
+// DriveOptions returns the parts of the configuration that are relevant to
+// core.Drive. Since this includes retrieving the secrets of all keys from
+// their respective KeySource, this can fail.
+func (cfg Configuration) DriveOptions() (core.DriveOptions, error) {
+	keys := make([]core.Key, len(cfg.Keys))
+	for idx, key := range cfg.Keys {
+		secret, err := key.Secret.Resolve()
+		if err != nil {
+			return core.DriveOptions{}, fmt.Errorf("cannot obtain secret for keys[%d]: %w", idx, err)
+		}
+		keys[idx] = core.Key{Secret: secret, Method: key.Method}
+	}
+	return core.DriveOptions{
+		Keys:                  keys,
+		RemoveRetiredLUKSKeys: cfg.LUKS.RemoveRetiredKeys,
+		LUKSProfile:           cfg.LUKSProfile(),
+		Filesystem:            cfg.Filesystem,
+		FormatOptions:         cfg.FormatOptions,
+		MountOptions:          cfg.MountOptions,
+		NearlyFullThreshold:   cfg.NearlyFullThreshold,
+		FsckBeforeMount:       cfg.FsckBeforeMount,
+		ErrorPolicies:         cfg.errorPolicies,
+		SMARTPolicy: core.SMARTPolicy{
+			FailedHealthCheck:  cfg.SMART.FailedHealthCheck,
+			ReallocatedSectors: cfg.SMART.ReallocatedSectors,
+			PendingSectors:     cfg.SMART.PendingSectors,
+			TemperatureCelsius: cfg.SMART.Temperature,
+		},
+	}, nil
+}
+
+// LUKSProfile returns the LUKS parameters from the configuration.
+func (cfg Configuration) LUKSProfile() os.LUKSProfile {
+	return os.LUKSProfile{
+		Version:          cfg.LUKS.Version,
+		Cipher:           cfg.LUKS.Cipher,
+		KeySize:          cfg.LUKS.KeySize,
+		SectorSize:       cfg.LUKS.SectorSize,
+		PBKDF:            cfg.LUKS.PBKDF.Type,
+		PBKDFIterations:  cfg.LUKS.PBKDF.Iterations,
+		PBKDFMemory:      cfg.LUKS.PBKDF.Memory,
+		PBKDFIterTime:    cfg.LUKS.PBKDF.IterTime,
+		AllowDiscards:    cfg.LUKS.AllowDiscards,
+		NoReadWorkqueue:  cfg.LUKS.NoReadWorkqueue,
+		NoWriteWorkqueue: cfg.LUKS.NoWriteWorkqueue,
+	}
 }
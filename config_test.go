@@ -0,0 +1,344 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	std_os "os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func TestParseFilesystem(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`drives: [ "/dev/sd[a-z]" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.Filesystem != os.FilesystemXFS {
+		t.Errorf("expected default filesystem to be %q, but got %q", os.FilesystemXFS, cfg.Filesystem)
+	}
+
+	cfg, err = parseConfiguration([]byte(`filesystem: ext4`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if opts, _ := cfg.DriveOptions(); opts.Filesystem != os.FilesystemExt4 {
+		t.Errorf("expected filesystem to be %q, but got %q", os.FilesystemExt4, opts.Filesystem)
+	}
+
+	_, err = parseConfiguration([]byte(`filesystem: btrfs`))
+	expected := `invalid value for filesystem: "btrfs" (expected "xfs" or "ext4")`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseKeyDerivationMethod(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`keys: [ { secret: foo }, { secret: bar, method: hkdf-sha256 } ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	opts, err := cfg.DriveOptions()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	keys := opts.Keys
+	if len(keys) != 2 || keys[0].Method != core.KeyDerivationNone || keys[1].Method != core.KeyDerivationHKDFSHA256 {
+		t.Errorf("unexpected keys: %#v", keys)
+	}
+
+	_, err = parseConfiguration([]byte(`keys: [ { secret: foo, method: pbkdf2 } ]`))
+	expected := `invalid value for keys[0].method: "pbkdf2" (expected "none" or "hkdf-sha256")`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseLUKSProfile(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`luks: { version: 2, sector-size: 4096, pbkdf: { type: pbkdf2, iterations: 1000 }, no-read-workqueue: true }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := os.LUKSProfile{Version: 2, SectorSize: 4096, PBKDF: "pbkdf2", PBKDFIterations: 1000, NoReadWorkqueue: true}
+	if actual := cfg.LUKSProfile(); actual != expected {
+		t.Errorf("expected LUKS profile %#v, but got %#v", expected, actual)
+	}
+
+	_, err = parseConfiguration([]byte(`luks: { version: 3 }`))
+	expectedError := `invalid value for luks.version: 3 (expected 1 or 2)`
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("expected error %q, but got %v", expectedError, err)
+	}
+	_, err = parseConfiguration([]byte(`luks: { pbkdf: { type: scrypt } }`))
+	expectedError = `invalid value for luks.pbkdf.type: "scrypt" (expected "pbkdf2", "argon2i" or "argon2id")`
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("expected error %q, but got %v", expectedError, err)
+	}
+
+	// parameters that cannot be combined are rejected on startup and reload,
+	// not only by check-config
+	_, err = parseConfiguration([]byte(`luks: { version: 1, key-size: 500, sector-size: 4096 }`))
+	expectedError = "invalid value for luks.key-size: 500 (must be a multiple of 8)\n" +
+		"luks.sector-size cannot be used with luks.version = 1"
+	if err == nil || err.Error() != expectedError {
+		t.Errorf("expected error %q, but got %v", expectedError, err)
+	}
+}
+
+func TestParseMountOptions(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`mount-options: [ noatime, "logbufs=8" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !slices.Equal(cfg.MountOptions, []string{"noatime", "logbufs=8"}) {
+		t.Errorf("expected mount options %q, but got %q", []string{"noatime", "logbufs=8"}, cfg.MountOptions)
+	}
+
+	_, err = parseConfiguration([]byte(`mount-options: [ "noatime,nodiratime" ]`))
+	expected := `mount-options contains invalid option "noatime,nodiratime" (give each option as a separate list entry)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseSerialNumberSources(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`drives: [ "/dev/sd[a-z]" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !slices.Equal(cfg.SerialNumberSources, os.DefaultSerialNumberSources) {
+		t.Errorf("expected default serial-number-sources to be %v, but got %v", os.DefaultSerialNumberSources, cfg.SerialNumberSources)
+	}
+
+	newCfg, err := parseConfiguration([]byte(`{ drives: [ "/dev/sd[a-z]" ], serial-number-sources: [ udev-wwn, sysfs-serial ] }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedSources := []os.SerialNumberSource{os.WWNFromUdev, os.SerialFromSysfs}
+	if !slices.Equal(newCfg.SerialNumberSources, expectedSources) {
+		t.Errorf("expected serial-number-sources to be %v, but got %v", expectedSources, newCfg.SerialNumberSources)
+	}
+	err = cfg.CheckReload(newCfg)
+	expected := `cannot change serial-number-sources from [sysfs-serial udev-serial smartctl] to [udev-wwn sysfs-serial] without a restart`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+
+	_, err = parseConfiguration([]byte(`serial-number-sources: [ sysfs-serial, hdparm ]`))
+	expected = `invalid value for serial-number-sources[1]: "hdparm" (expected "sysfs-serial", "udev-serial", "sysfs-wwid", "udev-wwn" or "smartctl")`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseIgnoredMountPaths(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`drives: [ "/dev/sd[a-z]" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !slices.Equal(cfg.IgnoredMountPaths, os.DefaultIgnoredMountPaths) {
+		t.Errorf("expected default ignored-mount-paths to be %v, but got %v", os.DefaultIgnoredMountPaths, cfg.IgnoredMountPaths)
+	}
+
+	newCfg, err := parseConfiguration([]byte(`{ drives: [ "/dev/sd[a-z]" ], ignored-mount-paths: [] }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(newCfg.IgnoredMountPaths) != 0 {
+		t.Errorf("expected ignored-mount-paths to be empty, but got %v", newCfg.IgnoredMountPaths)
+	}
+	err = cfg.CheckReload(newCfg)
+	expected := `cannot change ignored-mount-paths from [/var/lib/docker /var/lib/rkt /var/lib/kubelet] to [] without a restart`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+
+	_, err = parseConfiguration([]byte(`ignored-mount-paths: [ /var/lib/containerd, var/lib/docker ]`))
+	expected = `invalid value for ignored-mount-paths[1]: "var/lib/docker" (expected an absolute path)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseErrorPolicies(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`kernel-log: { error-policies: [
+		{ name: xfs-corruption, pattern: "(?i)metadata corruption" },
+		{ name: other, threshold: 5, interval: 1h },
+	] }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	opts, err := cfg.DriveOptions()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	policies := opts.ErrorPolicies
+	if len(policies) != 2 {
+		t.Fatalf("expected 2 error policies, but got %#v", policies)
+	}
+	if policies[0].Name != "xfs-corruption" || policies[0].Pattern.String() != "(?i)metadata corruption" || policies[0].Threshold != 1 || policies[0].Interval != 0 {
+		t.Errorf("unexpected error policy: %#v", policies[0])
+	}
+	if policies[1].Name != "other" || policies[1].Pattern != nil || policies[1].Threshold != 5 || policies[1].Interval != time.Hour {
+		t.Errorf("unexpected error policy: %#v", policies[1])
+	}
+
+	testCases := []struct {
+		ConfigYAML string
+		Error      string
+	}{
+		{`[ { pattern: foo } ]`, `missing value for kernel-log.error-policies[0].name`},
+		{`[ { name: foo }, { name: foo } ]`, `duplicate value for kernel-log.error-policies[1].name: "foo"`},
+		{`[ { name: foo, pattern: "(?<=foo)bar" } ]`, "invalid regex in kernel-log.error-policies[0].pattern: error parsing regexp: invalid named capture: `(?<=foo)bar`"},
+		{`[ { name: foo, threshold: -1 } ]`, `invalid value for kernel-log.error-policies[0].threshold: -1 (expected a positive number)`},
+		{`[ { name: foo, threshold: 3, interval: 10 } ]`, `invalid value for kernel-log.error-policies[0].interval: "10" (expected a positive duration like "10m")`},
+		{`[ { name: foo, threshold: 3 } ]`, `missing value for kernel-log.error-policies[0].interval (required if threshold is greater than 1)`},
+	}
+	for _, tc := range testCases {
+		_, err := parseConfiguration([]byte(`kernel-log: { error-policies: ` + tc.ConfigYAML + ` }`))
+		if err == nil || err.Error() != tc.Error {
+			t.Errorf("expected error %q for %s, but got %v", tc.Error, tc.ConfigYAML, err)
+		}
+	}
+}
+
+func TestParseSMART(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`drives: [ "/dev/sd[a-z]" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.smartInterval != 0 || cfg.SMART.FailedHealthCheck != core.SMARTActionBroken {
+		t.Errorf("unexpected default SMART configuration: interval = %s, failed-health-check = %q", cfg.smartInterval, cfg.SMART.FailedHealthCheck)
+	}
+
+	newCfg, err := parseConfiguration([]byte(`smart: { interval: 1h, failed-health-check: suspect, reallocated-sectors: { warn: 1, broken: 500 } }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	opts, err := newCfg.DriveOptions()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectedPolicy := core.SMARTPolicy{
+		FailedHealthCheck:  core.SMARTActionSuspect,
+		ReallocatedSectors: core.SMARTThresholds{Warn: 1, Broken: 500},
+	}
+	if newCfg.smartInterval != time.Hour || opts.SMARTPolicy != expectedPolicy {
+		t.Errorf("unexpected SMART configuration: interval = %s, policy = %#v", newCfg.smartInterval, opts.SMARTPolicy)
+	}
+	err = cfg.CheckReload(newCfg)
+	expected := `cannot change smart.interval from "" to "1h" without a restart`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+
+	testCases := []struct {
+		ConfigYAML string
+		Error      string
+	}{
+		{`{ interval: -5m }`, `invalid value for smart.interval: "-5m" (expected a positive duration like "1h")`},
+		{`{ failed-health-check: ignore }`, `invalid value for smart.failed-health-check: "ignore" (expected "warn", "suspect" or "broken")`},
+		{`{ pending-sectors: { suspect: -1 } }`, `invalid value for smart.pending-sectors.suspect: -1 (expected a positive number)`},
+	}
+	for _, tc := range testCases {
+		_, err := parseConfiguration([]byte(`smart: ` + tc.ConfigYAML))
+		if err == nil || err.Error() != tc.Error {
+			t.Errorf("expected error %q for %s, but got %v", tc.Error, tc.ConfigYAML, err)
+		}
+	}
+}
+
+func TestParseNearlyFullThreshold(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`nearly-full-threshold: 90`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	opts, err := cfg.DriveOptions()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if opts.NearlyFullThreshold != 90 {
+		t.Errorf("expected NearlyFullThreshold to be 90, but got %d", opts.NearlyFullThreshold)
+	}
+
+	_, err = parseConfiguration([]byte(`nearly-full-threshold: 120`))
+	expected := `invalid value for nearly-full-threshold: 120 (expected a percentage from 0 (disabled) to 100)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseShutdownPolicy(t *testing.T) {
+	cfg, err := parseConfiguration([]byte(`drives: [ "/dev/sd[a-z]" ]`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if cfg.ShutdownPolicy != KeepMountedOnShutdown {
+		t.Errorf("expected default shutdown-policy to be %q, but got %q", KeepMountedOnShutdown, cfg.ShutdownPolicy)
+	}
+
+	_, err = parseConfiguration([]byte(`shutdown-policy: unmount-everything`))
+	expected := `invalid value for shutdown-policy: "unmount-everything" (expected "keep-mounted" or "unmount-all")`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestParseKernelLogPatterns(t *testing.T) {
+	auditConfigPath := filepath.Join(t.TempDir(), "drive-audit.conf")
+	err := std_os.WriteFile(auditConfigPath, []byte("[drive-audit]\nregex_pattern_1 = \\berror\\b.*\\b(sd[a-z]{1,2}\\d?)\\b\n"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	testCases := []struct {
+		ConfigYAML string
+		LogLine    string
+		DevicePath string // or "" if no error shall be reported
+	}{
+		// default patterns
+		{`{}`, "blk_update_request: I/O error, dev sdc, sector 1234", "/dev/sdc"},
+		{`{}`, "sd 0:0:2:0: [sdc] Attached SCSI disk", ""},
+		{`{}`, "XFS (dm-3): Metadata corruption detected at xfs_da3_node_read_verify", ""},
+		{`{}`, "blk_update_request: critical medium error, dev nvme1n2, sector 1234", "/dev/nvme1n2"},
+		{`{}`, "Buffer I/O error on dev nvme0n1p1, logical block 0, async page read", "/dev/nvme0n1"},
+		{`{}`, "nvme nvme0: I/O 828 QID 2 timeout, aborting", "/dev/nvme0"},
+		{`{}`, "nvme nvme12: controller is down; will reset: CSTS=0x3, PCI_STATUS=0x10", "/dev/nvme12"},
+		{`{}`, "nvme nvme0: Shutdown timeout set to 8 seconds", ""},
+		{`{}`, "nvme nvme0: 32/0/0 default/read/poll queues", ""},
+		// ignore patterns
+		{`{ ignore-patterns: [ "mpt3sas.*log_info" ] }`, "mpt3sas_cm0: log_info(0x31120303): originator(PL), code(0x12), sub_code(0x0303) error on sdc", ""},
+		{`{ ignore-patterns: [ "mpt3sas.*log_info" ] }`, "blk_update_request: I/O error, dev sdc, sector 1234", "/dev/sdc"},
+		// custom device patterns
+		{`{ device-patterns: [ '\b(vd[a-z]+)\b' ] }`, "blk_update_request: I/O error, dev vdb, sector 1234", "/dev/vdb"},
+		// custom error patterns with capture group (partitions are mapped to the whole disk)
+		{`{ error-patterns: [ 'critical medium error, dev (sd[a-z]+\d*)' ] }`, "critical medium error, dev sdd1, sector 5678", "/dev/sdd"},
+		{`{ error-patterns: [ 'critical medium error, dev (sd[a-z]+\d*)' ] }`, "blk_update_request: I/O error, dev sdc, sector 1234", ""},
+		// patterns imported from drive-audit.conf
+		{`{ drive-audit-config: "` + auditConfigPath + `" }`, "end_request: I/O error, dev sde2, sector 42", "/dev/sde"},
+	}
+	for _, tc := range testCases {
+		cfg, err := parseConfiguration([]byte(`kernel-log: ` + tc.ConfigYAML))
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", tc.ConfigYAML, err.Error())
+		}
+		driveError := cfg.kernelLogPatterns.Match(tc.LogLine)
+		switch {
+		case driveError == nil && tc.DevicePath != "":
+			t.Errorf("expected %q to be reported for %s with %s, but got nothing", tc.LogLine, tc.DevicePath, tc.ConfigYAML)
+		case driveError != nil && driveError.DevicePath != tc.DevicePath:
+			t.Errorf("expected %q to be reported for %q with %s, but got %q", tc.LogLine, tc.DevicePath, tc.ConfigYAML, driveError.DevicePath)
+		}
+	}
+
+	_, err = parseConfiguration([]byte(`kernel-log: { error-patterns: [ '(?<=foo)bar' ] }`))
+	expected := "invalid regex in kernel-log.error-patterns: error parsing regexp: invalid named capture: `(?<=foo)bar`"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, but got %v", expected, err)
+	}
+}
@@ -4,15 +4,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	sys_os "os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sapcc/go-bits/logg"
 
-	"github.com/sapcc/swift-drive-autopilot/pkg/command"
 	"github.com/sapcc/swift-drive-autopilot/pkg/core"
 	"github.com/sapcc/swift-drive-autopilot/pkg/os"
 )
@@ -21,45 +22,117 @@ import (
 type Converger struct {
 	// long-lived state
 	Drives []*core.Drive
-	OS     os.Interface
+	// PendingDrives are drives that were added (or reinstated) while the
+	// encryption keys could not be obtained. They are moved into Drives as soon
+	// as the keys become available.
+	PendingDrives []DriveAddedEvent
+	OS            os.Interface
+	// ShutdownRequested is closed as soon as SIGINT or SIGTERM is received,
+	// possibly in the middle of an event loop iteration. (The ShutdownEvent
+	// only arrives once the converger is done with the previous iteration.)
+	ShutdownRequested <-chan struct{}
+	// ShuttingDown is set when the ShutdownEvent is handled.
+	ShuttingDown bool
+
+	// result of Config.DriveOptions(), so that the keys are only obtained once
+	// per configuration instead of once per drive (nil if the keys have not
+	// been obtained yet, or if obtaining them failed during this event loop
+	// iteration, in which case driveOptionsErr is set)
+	driveOptions    *core.DriveOptions
+	driveOptionsErr error
+	// versions of the key files that driveOptions was obtained from
+	keyFileVersions map[string]keyFileVersion
 }
 
-// RunConverger runs the converger thread. This function does not return.
-func RunConverger(queue chan []Event, osi os.Interface) {
-	c := &Converger{OS: osi}
+// RunConverger runs the converger thread. This function returns after the
+// ShutdownEvent has been handled.
+func RunConverger(ctx context.Context, queue chan []Event, osi os.Interface) {
+	c := &Converger{OS: osi, ShutdownRequested: ctx.Done()}
 
-	for {
+	for !c.ShuttingDown {
 		// wait for processable events
-		events := <-queue
+		c.HandleEvents(<-queue)
+	}
+	logg.Info("shutdown complete")
+}
 
-		// initialize short-lived state for this event loop iteration
-		osi.RefreshMountPoints()
-		osi.RefreshLUKSMappings()
+// shutdownRequested returns whether no new operations shall be started on any
+// drive because the autopilot is about to exit.
+func (c *Converger) shutdownRequested() bool {
+	if c.ShuttingDown {
+		return true
+	}
+	select {
+	case <-c.ShutdownRequested:
+		return true
+	default:
+		return false
+	}
+}
 
-		// handle events
-		for _, event := range events {
-			if msg := event.LogMessage(); msg != "" {
-				logg.Info("event received: " + msg)
-			}
-			eventCounter.With(prometheus.Labels{"type": event.EventType()}).Add(1)
-			event.Handle(c)
+// convergeDrive calls drive.Converge(), unless shutdown has been requested. We
+// must not start a potentially long-running operation (most importantly
+// mkfs.xfs or cryptsetup luksFormat) when we are about to exit, since it would
+// be interrupted halfway when the process goes away.
+func (c *Converger) convergeDrive(drive *core.Drive) {
+	if !c.shutdownRequested() {
+		drive.Converge(c.OS)
+	}
+}
+
+// HandleEvents runs one iteration of the converger's event loop: The given
+// events are handled, and then the converger moves towards the desired state.
+func (c *Converger) HandleEvents(events []Event) {
+	// initialize short-lived state for this event loop iteration
+	c.OS.RefreshMountPoints()
+	c.OS.RefreshLUKSMappings()
+	// if the keys could not be obtained before, try again now
+	c.driveOptionsErr = nil
+	c.CheckKeyFiles()
+
+	// handle events
+	for _, event := range events {
+		if msg := event.LogMessage(); msg != "" {
+			logg.Info("event received: " + msg)
 		}
+		eventCounter.With(prometheus.Labels{"type": event.EventType()}).Add(1)
+		event.Handle(c)
+	}
+
+	c.Converge()
+	c.ReportStatus()
+	c.ReportMetrics()
 
-		c.Converge()
+	devicePaths := make([]string, len(c.Drives))
+	for idx, d := range c.Drives {
+		devicePaths[idx] = d.DevicePath
 	}
+	setKnownDevicePaths(devicePaths)
 }
 
 // Converge moves towards the desired state of all drives after a set of events
 // has been received and handled by the converger.
 func (c *Converger) Converge() {
+	if c.shutdownRequested() {
+		// only flush the state files that Swift looks at
+		c.WriteDriveAudit()
+		return
+	}
+
+	c.SetupPendingDrives()
+
+	now := time.Now()
 	for _, drive := range c.Drives {
-		drive.Converge(c.OS)
+		drive.ExpireKernelLogErrors(now)
+		c.convergeDrive(drive)
 	}
-	core.UpdateDriveAssignments(c.Drives, Config.SwiftIDPool, c.OS)
+	stats := core.UpdateDriveAssignments(c.Drives, Config.SwiftIDPool, c.OS)
+	unusedPoolIDsGauge.Set(float64(stats.UnusedPoolIDs))
+	poolExhaustedCounter.Add(float64(stats.PoolExhausted))
 
 	for _, drive := range c.Drives {
 		if !drive.Broken {
-			drive.Converge(c.OS) // to reflect updated drive assignments
+			c.convergeDrive(drive) // to reflect updated drive assignments
 			mountPath := drive.MountPath()
 			if filepath.Dir(mountPath) == "/srv/node" {
 				c.OS.Chown(mountPath, Config.Owner.User, Config.Owner.Group)
@@ -67,11 +140,19 @@ func (c *Converger) Converge() {
 		}
 	}
 
+	for _, drive := range c.Drives {
+		drive.UpdateFilesystemUsage(c.OS)
+	}
+
 	c.CheckForUnexpectedMounts()
 	c.WriteDriveAudit()
+	c.WriteDriveUsage()
 
 	// mark storage as ready for consumption by Swift
-	command.Command{ExitOnError: true}.Run("touch", "/run/swift-storage/state/flag-ready")
+	err := c.OS.WriteFile("/run/swift-storage/state/flag-ready", nil)
+	if err != nil {
+		logg.Fatal(err.Error())
+	}
 }
 
 // CheckForUnexpectedMounts prints error messages for every unexpected mount
@@ -86,6 +167,7 @@ MOUNT:
 		}
 
 		logg.Error("unexpected mount at %s", mount.MountPath)
+		unexpectedMountsCounter.Inc()
 	}
 }
 
@@ -110,26 +192,162 @@ func (c *Converger) WriteDriveAudit() {
 		logg.Error(err.Error())
 	}
 
-	path := "/var/cache/swift/drive.recon"
-	if Config.ChrootPath != "" {
-		path = filepath.Join(Config.ChrootPath, strings.TrimPrefix(path, "/"))
+	err = c.OS.WriteFile("/var/cache/swift/drive.recon", jsonStr)
+	if err != nil {
+		logg.Error(err.Error())
+	}
+}
+
+// driveUsageReport appears in the file written by WriteDriveUsage. The field
+// names follow those in the disk usage report of swift-recon.
+type driveUsageReport struct {
+	Size       uint64 `json:"size"`
+	Used       uint64 `json:"used"`
+	Avail      uint64 `json:"avail"`
+	Inodes     uint64 `json:"inodes"`
+	InodesFree uint64 `json:"inodes_free"`
+	NearlyFull bool   `json:"nearly_full"`
+}
+
+// WriteDriveUsage writes /var/cache/swift/drive_usage.recon in a format
+// similar to drive.recon, i.e. with the filesystem usage of each mounted drive
+// and the total number of drives that are nearly full.
+func (c *Converger) WriteDriveUsage() {
+	data := make(map[string]any)
+	total := 0
+
+	for _, drive := range c.Drives {
+		u := drive.FilesystemUsage
+		if u == nil {
+			continue
+		}
+		nearlyFull := drive.IsNearlyFull()
+		if nearlyFull {
+			total++
+		}
+		data[drive.MountedPath()] = driveUsageReport{
+			Size:       u.TotalBytes,
+			Used:       u.UsedBytes,
+			Avail:      u.FreeBytes,
+			Inodes:     u.TotalInodes,
+			InodesFree: u.FreeInodes,
+			NearlyFull: nearlyFull,
+		}
+	}
+	data["nearly_full_drives"] = total
+	jsonStr, err := json.Marshal(data)
+	if err != nil {
+		logg.Error(err.Error())
 	}
-	err = sys_os.WriteFile(path, jsonStr, 0644)
+
+	err = c.OS.WriteFile("/var/cache/swift/drive_usage.recon", jsonStr)
 	if err != nil {
 		logg.Error(err.Error())
 	}
 }
 
+// getDriveOptions returns the result of Config.DriveOptions(). Since this
+// involves obtaining the encryption keys (which can take a while), the result
+// is only computed once per configuration. If obtaining the keys fails, this is
+// only retried once per event loop iteration.
+func (c *Converger) getDriveOptions() (core.DriveOptions, error) {
+	if c.driveOptions == nil && c.driveOptionsErr == nil {
+		// stat before reading, so that changes during reading are not missed
+		versions := statKeyFiles(Config)
+		opts, err := Config.DriveOptions()
+		if err == nil {
+			c.driveOptions = &opts
+			c.keyFileVersions = versions
+		} else {
+			c.driveOptionsErr = err
+		}
+	}
+	if c.driveOptionsErr != nil {
+		return core.DriveOptions{}, c.driveOptionsErr
+	}
+	return *c.driveOptions, nil
+}
+
+// CheckKeyFiles obtains the keys again if one of the key files has changed
+// since the keys were last obtained. If successful, the new keys are given to
+// all drives, so that they are enrolled in the LUKS containers as described
+// for configuration reloads. Otherwise, the previous keys remain in effect, and
+// this is retried during the next event loop iteration.
+func (c *Converger) CheckKeyFiles() {
+	if c.driveOptions == nil {
+		// keys have not been obtained yet, so nothing can be outdated
+		return
+	}
+	versions := statKeyFiles(Config)
+	var changedPaths []string
+	for path, version := range versions {
+		if version != c.keyFileVersions[path] {
+			changedPaths = append(changedPaths, path)
+		}
+	}
+	if len(changedPaths) == 0 {
+		return
+	}
+	slices.Sort(changedPaths)
+
+	opts, err := Config.DriveOptions()
+	if err != nil {
+		logg.Error("cannot obtain keys after change of %s (previous keys remain in effect): %s",
+			strings.Join(changedPaths, ", "), err.Error())
+		return
+	}
+	logg.Info("keys obtained again after change of %s", strings.Join(changedPaths, ", "))
+	c.driveOptions = &opts
+	c.keyFileVersions = versions
+	for _, drive := range c.Drives {
+		drive.DriveOptions = opts
+	}
+}
+
+// newDrive calls core.NewDrive() with the current configuration. If the
+// encryption keys cannot be obtained, nil is returned and the drive is put in
+// c.PendingDrives instead, since it could otherwise end up being formatted
+// without encryption.
+func (c *Converger) newDrive(e DriveAddedEvent) *core.Drive {
+	opts, err := c.getDriveOptions()
+	if err != nil {
+		logg.Error("cannot set up %s until the keys can be obtained: %s", e.DevicePath, err.Error())
+		c.PendingDrives = append(c.PendingDrives, e)
+		return nil
+	}
+
+	drive := core.NewDrive(e.DevicePath, e.SerialNumber, opts, c.OS)
+	drive.WWN = e.WWN
+	drive.Model = e.Model
+	return drive
+}
+
+// SetupPendingDrives moves all drives from c.PendingDrives into c.Drives if
+// the encryption keys can be obtained now.
+func (c *Converger) SetupPendingDrives() {
+	if len(c.PendingDrives) == 0 {
+		return
+	}
+	_, err := c.getDriveOptions()
+	if err != nil {
+		logg.Error("cannot set up %d pending drives until the keys can be obtained: %s", len(c.PendingDrives), err.Error())
+		return
+	}
+
+	pendingDrives := c.PendingDrives
+	c.PendingDrives = nil
+	for _, e := range pendingDrives {
+		e.Handle(c)
+	}
+}
+
 // Handle implements the Event interface.
 func (e DriveAddedEvent) Handle(c *Converger) {
-	keys := make([]string, len(Config.Keys))
-	for idx, key := range Config.Keys {
-		keys[idx] = string(key.Secret)
+	drive := c.newDrive(e)
+	if drive != nil {
+		c.Drives = append(c.Drives, drive)
+		c.convergeDrive(drive)
 	}
-
-	drive := core.NewDrive(e.DevicePath, e.SerialNumber, keys, c.OS)
-	c.Drives = append(c.Drives, drive)
-	drive.Converge(c.OS)
 }
 
 // Handle implements the Event interface.
@@ -145,6 +363,9 @@ func (e DriveRemovedEvent) Handle(c *Converger) {
 		}
 	}
 	if drive == nil {
+		c.PendingDrives = slices.DeleteFunc(c.PendingDrives, func(p DriveAddedEvent) bool {
+			return p.DevicePath == e.DevicePath
+		})
 		return
 	}
 
@@ -157,7 +378,17 @@ func (e DriveRemovedEvent) Handle(c *Converger) {
 func (e DriveErrorEvent) Handle(c *Converger) {
 	for _, d := range c.Drives {
 		if d.DevicePath == e.DevicePath {
-			d.MarkAsBroken(c.OS)
+			d.HandleKernelLogError(c.OS, e.LogLine, e.Time)
+			return
+		}
+	}
+}
+
+// Handle implements the Event interface.
+func (e DriveHealthEvent) Handle(c *Converger) {
+	for _, d := range c.Drives {
+		if d.DevicePath == e.DevicePath {
+			d.HandleSMARTHealth(c.OS, e.Health)
 			return
 		}
 	}
@@ -168,10 +399,65 @@ func (e DriveReinstatedEvent) Handle(c *Converger) {
 	for idx, d := range c.Drives {
 		if d.DevicePath == e.DevicePath {
 			// reset the drive to pristine condition
-			d = core.NewDrive(d.DevicePath, d.DriveID, d.Keys, c.OS)
-			c.Drives[idx] = d
-			d.Converge(c.OS)
+			d = c.newDrive(DriveAddedEvent{
+				DevicePath:   d.DevicePath,
+				SerialNumber: d.SerialNumber,
+				WWN:          d.WWN,
+				Model:        d.Model,
+			})
+			if d == nil {
+				// will be set up again once the keys are available
+				c.Drives = slices.Delete(c.Drives, idx, idx+1)
+			} else {
+				c.Drives[idx] = d
+				c.convergeDrive(d)
+			}
 			break
 		}
 	}
 }
+
+// Handle implements the Event interface.
+func (e ConfigChangedEvent) Handle(c *Converger) {
+	err := Config.CheckReload(e.NewConfig)
+	if err != nil {
+		logg.Error("rejecting changed configuration from %s: %s", e.Path, err.Error())
+		return
+	}
+	versions := statKeyFiles(e.NewConfig)
+	opts, err := e.NewConfig.DriveOptions()
+	if err != nil {
+		logg.Error("rejecting changed configuration from %s: %s", e.Path, err.Error())
+		return
+	}
+
+	Config = e.NewConfig
+	c.driveOptions = &opts
+	c.driveOptionsErr = nil
+	c.keyFileVersions = versions
+	SetDriveGlobs(Config.DriveGlobs)
+	SetKernelLogPatterns(Config.kernelLogPatterns)
+
+	// changes to swift-id-pool and chown take effect during the next Converge(),
+	// but keys etc. are stored in each drive
+	for _, drive := range c.Drives {
+		drive.DriveOptions = opts
+	}
+}
+
+// Handle implements the Event interface.
+func (e ShutdownEvent) Handle(c *Converger) {
+	c.ShuttingDown = true
+	if Config.ShutdownPolicy != UnmountAllOnShutdown {
+		return
+	}
+
+	for _, drive := range c.Drives {
+		drive.Teardown(c.OS)
+	}
+	// storage is not ready for consumption by Swift anymore
+	err := c.OS.RemoveFile("/run/swift-storage/state/flag-ready")
+	if err != nil {
+		logg.Error(err.Error())
+	}
+}
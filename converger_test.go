@@ -0,0 +1,646 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+func setupConverger(t *testing.T, configYAML string) (*Converger, *os.Fake) {
+	t.Helper()
+	cfg, err := parseConfiguration([]byte(configYAML))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	prevConfig := Config
+	Config = cfg
+	t.Cleanup(func() { Config = prevConfig })
+
+	osi := os.NewFake()
+	return &Converger{OS: osi}, osi
+}
+
+func (c *Converger) findDrive(t *testing.T, devicePath string) *core.Drive {
+	t.Helper()
+	for _, d := range c.Drives {
+		if d.DevicePath == devicePath {
+			return d
+		}
+	}
+	t.Fatalf("converger does not know about %s", devicePath)
+	return nil
+}
+
+func expectMountedAt(t *testing.T, osi os.Interface, devicePath string, mountPaths ...string) {
+	t.Helper()
+	for _, scope := range []os.MountScope{os.HostScope, os.LocalScope} {
+		var actual []string
+		for _, m := range osi.GetMountPointsOf(devicePath, scope) {
+			actual = append(actual, m.MountPath)
+		}
+		if len(actual) != len(mountPaths) || (len(actual) > 0 && actual[0] != mountPaths[0]) {
+			t.Errorf("expected %s to be mounted at %v in %s mount namespace, but is mounted at %v",
+				devicePath, mountPaths, scope, actual)
+		}
+	}
+}
+
+func expectDriveAudit(t *testing.T, osi *os.Fake, expected map[string]int) {
+	t.Helper()
+	buf, exists := osi.ReadFile("/var/cache/swift/drive.recon")
+	if !exists {
+		t.Fatal("drive.recon was not written")
+	}
+	var actual map[string]int
+	err := json.Unmarshal([]byte(buf), &actual)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("expected drive.recon to contain %v, but got %v", expected, actual)
+		return
+	}
+	for key, value := range expected {
+		if actual[key] != value {
+			t.Errorf("expected drive.recon to contain %v, but got %v", expected, actual)
+			return
+		}
+	}
+}
+
+func TestConvergerInitialSetup(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1, swift2, swift3 ],
+		chown: { user: swift, group: swift },
+	}`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	if owner := osi.OwnerOf("/srv/node/swift1"); owner != "swift:swift" {
+		t.Errorf("expected /srv/node/swift1 to be owned by swift:swift, but is owned by %q", owner)
+	}
+	if _, exists := osi.ReadFile("/run/swift-storage/state/flag-ready"); !exists {
+		t.Error("expected flag-ready to be written")
+	}
+	expectDriveAudit(t, osi, map[string]int{
+		"/srv/node/swift1":   0,
+		"/srv/node/swift2":   0,
+		"drive_audit_errors": 0,
+	})
+}
+
+func TestConvergerHotSwap(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1, swift2 ]`)
+	drive1 := &os.FakeDevice{SerialNumber: "SERIAL1"}
+	osi.AddDrive("/dev/sda", drive1)
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	// pull the drive -> mounts are cleaned up and propagated
+	osi.RemoveDrive("/dev/sda")
+	c.HandleEvents([]Event{DriveRemovedEvent{DevicePath: "/dev/sda"}})
+	expectMountedAt(t, osi, "/dev/sda")
+	if len(c.Drives) != 1 {
+		t.Errorf("expected converger to know 1 drive, but knows %d", len(c.Drives))
+	}
+	target, err := osi.ReadSymlink("/run/swift-storage/state/unmount-propagation/swift1")
+	if err != nil || target != "/dev/sda" {
+		t.Errorf("expected unmount-propagation flag for swift1, got %q (err = %v)", target, err)
+	}
+
+	// reinsert the same drive -> it is mounted in the same place again
+	osi.AddDrive("/dev/sda", drive1)
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	_, err = osi.ReadSymlink("/run/swift-storage/state/unmount-propagation/swift1")
+	if err == nil {
+		t.Error("expected unmount-propagation flag for swift1 to be removed")
+	}
+}
+
+func TestConvergerHotSwapLUKS(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1 ],
+		keys: [ { secret: "bzQoG5HN4onneis5bhDmnYqqacoLNCSmDbFEAb3VDztmBtGobH" } ],
+	}`)
+	drive1 := &os.FakeDevice{SerialNumber: "SERIAL1"}
+	osi.AddDrive("/dev/sda", drive1)
+
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/mapper/SERIAL1", "/srv/node/swift1")
+
+	osi.RemoveDrive("/dev/sda")
+	c.HandleEvents([]Event{DriveRemovedEvent{DevicePath: "/dev/sda"}})
+	expectMountedAt(t, osi, "/dev/mapper/SERIAL1")
+	if mapped := osi.GetLUKSMappingOf("/dev/sda"); mapped != "" {
+		t.Errorf("expected LUKS container to be closed, but is still open as %s", mapped)
+	}
+
+	osi.AddDrive("/dev/sda", drive1)
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/mapper/SERIAL1", "/srv/node/swift1")
+}
+
+func TestConvergerSuspectDrive(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1 ],
+		kernel-log: { error-policies: [
+			{ name: xfs-corruption, pattern: "(?i)metadata corruption" },
+			{ name: io-error, threshold: 3, interval: 10m },
+		] },
+	}`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	drive := c.findDrive(t, "/dev/sda")
+	now := time.Now()
+
+	// errors below the threshold make the drive suspect, but it stays mounted
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error, dev sda, sector 1234", Time: now}})
+	if drive.Broken || drive.State() != core.DriveSuspect {
+		t.Errorf("expected /dev/sda to be suspect, but got state %q", drive.State())
+	}
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	// duplicate lines are not counted
+	c.HandleEvents([]Event{
+		DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error, dev sda, sector 1234", Time: now},
+		DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error, dev sda, sector 1234", Time: now},
+		DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error, dev sda, sector 5678", Time: now},
+	})
+	if drive.Broken || drive.KernelLogErrorCounts()["io-error"] != 2 {
+		t.Errorf("expected /dev/sda to be suspect with 2 errors, but got broken = %t, errors = %v", drive.Broken, drive.KernelLogErrorCounts())
+	}
+
+	// duplicate lines are also recognized when the kernel log reader (here:
+	// journalctl) prefixes each line with a timestamp
+	c.HandleEvents([]Event{
+		DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "Oct 16 12:34:56 node001 kernel: I/O error, dev sda, sector 5678", Time: now},
+		DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "Oct 16 12:35:02 node001 kernel: I/O error, dev sda, sector 5678", Time: now},
+	})
+	if drive.Broken || drive.KernelLogErrorCounts()["io-error"] != 2 {
+		t.Errorf("expected /dev/sda to be suspect with 2 errors, but got broken = %t, errors = %v", drive.Broken, drive.KernelLogErrorCounts())
+	}
+
+	// errors outside of the interval are forgotten
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sdb", LogLine: "I/O error, dev sdb, sector 42", Time: now.Add(-time.Hour)}})
+	if state := c.findDrive(t, "/dev/sdb").State(); state == core.DriveSuspect {
+		t.Errorf("expected /dev/sdb to not be suspect anymore, but got state %q", state)
+	}
+
+	// reaching the threshold marks the drive as broken
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error, dev sda, sector 9012", Time: now}})
+	if !drive.Broken {
+		t.Error("expected /dev/sda to be broken")
+	}
+	expected := `3 errors of class "io-error" seen in kernel log within 10m0s, last one: I/O error, dev sda, sector 9012`
+	if drive.BrokenReason != expected {
+		t.Errorf("expected broken reason %q, but got %q", expected, drive.BrokenReason)
+	}
+	if len(drive.KernelLogErrors) != 0 {
+		t.Errorf("expected kernel log errors of broken drive to be cleared, but got %v", drive.KernelLogErrors)
+	}
+	expectMountedAt(t, osi, "/dev/sda")
+
+	// policies with the default threshold mark the drive as broken immediately
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sdb", LogLine: "XFS (sdb): Metadata corruption detected", Time: now}})
+	if !c.findDrive(t, "/dev/sdb").Broken {
+		t.Error("expected /dev/sdb to be broken")
+	}
+}
+
+func TestConvergerSMARTHealth(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1, swift2, swift3, swift4 ],
+		smart: { interval: 1h, pending-sectors: { warn: 1, suspect: 10 } },
+	}`)
+	passed, failed := true, false
+	ptr := func(value int64) *int64 { return &value }
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", SMARTHealth: &parsers.SMARTHealth{Passed: &passed, PendingSectors: ptr(0), TemperatureCelsius: ptr(34)}})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2", SMARTHealth: &parsers.SMARTHealth{Passed: &passed, PendingSectors: ptr(12)}})
+	osi.AddDrive("/dev/sdc", &os.FakeDevice{SerialNumber: "SERIAL3", SMARTHealth: &parsers.SMARTHealth{Passed: &failed}})
+	osi.AddDrive("/dev/sdd", &os.FakeDevice{SerialNumber: "SERIAL4"}) // no SMART data
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+		DriveAddedEvent{DevicePath: "/dev/sdc", SerialNumber: "SERIAL3"},
+		DriveAddedEvent{DevicePath: "/dev/sdd", SerialNumber: "SERIAL4"},
+	})
+
+	// the collector reads SMART data for all drives known to the converger
+	events := readSMARTHealth(osi, getKnownDevicePaths())
+	if len(events) != 3 {
+		t.Fatalf("expected 3 DriveHealthEvents, but got %#v", events)
+	}
+	c.HandleEvents(events)
+
+	expectedStates := map[string]core.DriveState{
+		"/dev/sda": core.DriveMounted,
+		"/dev/sdb": core.DriveSuspect,
+		"/dev/sdc": core.DriveBroken,
+		"/dev/sdd": core.DriveMounted,
+	}
+	for devicePath, expected := range expectedStates {
+		if actual := c.findDrive(t, devicePath).State(); actual != expected {
+			t.Errorf("expected %s to be in state %q, but got %q", devicePath, expected, actual)
+		}
+	}
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	expectMountedAt(t, osi, "/dev/sdc")
+	if reason := c.findDrive(t, "/dev/sdc").BrokenReason; reason != "SMART health indicators are critical: SMART health check failed" {
+		t.Errorf("unexpected broken reason for /dev/sdc: %q", reason)
+	}
+
+	status := getDriveStatus(c.findDrive(t, "/dev/sdb"))
+	if status.SMART == nil || *status.SMART.PendingSectors != 12 || status.SMART.SuspectReason != "pending sector count is 12 (threshold for suspect: 10)" {
+		t.Errorf("unexpected SMART status for /dev/sdb: %#v", status.SMART)
+	}
+	if status := getDriveStatus(c.findDrive(t, "/dev/sdd")); status.SMART != nil {
+		t.Errorf("expected no SMART status for /dev/sdd, but got %#v", status.SMART)
+	}
+	temperature := getGaugeValue(t, smartTemperatureGauge.With(prometheus.Labels{"serial": "SERIAL1", "device_path": "/dev/sda"}))
+	if temperature != 34 {
+		t.Errorf("expected SMART temperature metric for SERIAL1 to be 34, but got %g", temperature)
+	}
+
+	// when the indicators improve, the drive is not suspect anymore
+	c.HandleEvents([]Event{DriveHealthEvent{DevicePath: "/dev/sdb", Health: parsers.SMARTHealth{Passed: &passed, PendingSectors: ptr(0)}}})
+	if state := c.findDrive(t, "/dev/sdb").State(); state != core.DriveMounted {
+		t.Errorf("expected /dev/sdb to be in state %q, but got %q", core.DriveMounted, state)
+	}
+}
+
+func TestConvergerFilesystemUsage(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1, swift2 ],
+		nearly-full-threshold: 90,
+	}`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+
+	// usage is measured during the next converger iteration
+	osi.SetFilesystemUsage("/srv/node/swift1", os.FilesystemUsage{
+		TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, TotalInodes: 100, FreeInodes: 95,
+	})
+	osi.SetFilesystemUsage("/srv/node/swift2", os.FilesystemUsage{
+		TotalBytes: 1000, FreeBytes: 50, UsedBytes: 950, TotalInodes: 100, FreeInodes: 80,
+	})
+	c.HandleEvents([]Event{WakeupEvent{}})
+
+	expectedNearlyFull := map[string]bool{"/dev/sda": false, "/dev/sdb": true}
+	for devicePath, expected := range expectedNearlyFull {
+		status := getDriveStatus(c.findDrive(t, devicePath))
+		if status.FilesystemUsage == nil || status.FilesystemUsage.NearlyFull != expected {
+			t.Errorf("expected filesystem usage of %s with nearly_full = %t, but got %#v", devicePath, expected, status.FilesystemUsage)
+		}
+	}
+
+	labels := prometheus.Labels{"serial": "SERIAL1", "device_path": "/dev/sda", "swift_id": "swift1"}
+	if value := getGaugeValue(t, filesystemFreeGauge.With(labels)); value != 600 {
+		t.Errorf("expected free bytes metric for SERIAL1 to be 600, but got %g", value)
+	}
+	labels = prometheus.Labels{"serial": "SERIAL2", "device_path": "/dev/sdb", "swift_id": "swift2"}
+	if value := getGaugeValue(t, filesystemNearlyFullGauge.With(labels)); value != 1 {
+		t.Errorf("expected nearly-full metric for SERIAL2 to be 1, but got %g", value)
+	}
+
+	buf, exists := osi.ReadFile("/var/cache/swift/drive_usage.recon")
+	if !exists {
+		t.Fatal("drive_usage.recon was not written")
+	}
+	expected := `{"/srv/node/swift1":{"size":1000,"used":400,"avail":600,"inodes":100,"inodes_free":95,"nearly_full":false},` +
+		`"/srv/node/swift2":{"size":1000,"used":950,"avail":50,"inodes":100,"inodes_free":80,"nearly_full":true},` +
+		`"nearly_full_drives":1}`
+	if buf != expected {
+		t.Errorf("expected drive_usage.recon to contain %s, but got %s", expected, buf)
+	}
+
+	// running out of inodes also counts as nearly full
+	osi.SetFilesystemUsage("/srv/node/swift1", os.FilesystemUsage{
+		TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, TotalInodes: 100, FreeInodes: 5,
+	})
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if !c.findDrive(t, "/dev/sda").IsNearlyFull() {
+		t.Error("expected /dev/sda to be nearly full")
+	}
+}
+
+func TestConvergerFailAndReinstate(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1, swift2 ]`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+
+	// disk error in kernel log -> drive is unmounted and flagged
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error on sda"}})
+	if !c.findDrive(t, "/dev/sda").Broken {
+		t.Error("expected /dev/sda to be broken")
+	}
+	expectMountedAt(t, osi, "/dev/sda")
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	target, err := osi.ReadSymlink("/run/swift-storage/broken/SERIAL1")
+	if err != nil || target != "/dev/sda" {
+		t.Errorf("expected broken flag for SERIAL1, got %q (err = %v)", target, err)
+	}
+	expectDriveAudit(t, osi, map[string]int{
+		"/run/swift-storage/SERIAL1": 1,
+		"/srv/node/swift2":           0,
+		"drive_audit_errors":         1,
+	})
+
+	// a new drive must not be auto-assigned while a drive is broken
+	osi.AddDrive("/dev/sdc", &os.FakeDevice{SerialNumber: "SERIAL3"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sdc", SerialNumber: "SERIAL3"}})
+	expectMountedAt(t, osi, "/dev/sdc", "/run/swift-storage/SERIAL3")
+
+	// operator deletes the broken flag -> drive comes back
+	err = osi.RemoveFile("/run/swift-storage/broken/SERIAL1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{DriveReinstatedEvent{DevicePath: "/dev/sda"}})
+	if c.findDrive(t, "/dev/sda").Broken {
+		t.Error("expected /dev/sda to not be broken anymore")
+	}
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdc", "/run/swift-storage/SERIAL3")
+}
+
+func TestConvergerFsckBeforeMount(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1, swift2 ],
+		fsck-before-mount: true,
+	}`)
+	drive1 := &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeFilesystem, SwiftID: "swift1"}
+	drive2 := &os.FakeDevice{SerialNumber: "SERIAL2"}
+	osi.AddDrive("/dev/sda", drive1)
+	osi.AddDrive("/dev/sdb", drive2)
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	c.HandleEvents([]Event{WakeupEvent{}})
+
+	// the existing filesystem is checked once before the first mount, the new
+	// filesystem is not checked at all
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	if drive1.FilesystemChecks != 1 || drive2.FilesystemChecks != 0 {
+		t.Errorf("expected 1 and 0 filesystem checks, but got %d and %d", drive1.FilesystemChecks, drive2.FilesystemChecks)
+	}
+
+	// when a broken drive is reinstated, it is checked again; if the check
+	// fails, the drive stays broken
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sda", LogLine: "I/O error on sda"}})
+	expectMountedAt(t, osi, "/dev/sda")
+	osi.InjectFailure(os.FakeCheckFilesystem, "/dev/sda")
+	err := osi.RemoveFile("/run/swift-storage/broken/SERIAL1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{DriveReinstatedEvent{DevicePath: "/dev/sda"}})
+	expectMountedAt(t, osi, "/dev/sda")
+	expected := "xfs filesystem on /dev/sda did not pass the filesystem check (see previous log messages for details), refusing to mount it"
+	if reason := c.findDrive(t, "/dev/sda").BrokenReason; reason != expected {
+		t.Errorf("expected broken reason %q, but got %q", expected, reason)
+	}
+	if drive1.FilesystemChecks != 2 {
+		t.Errorf("expected 2 filesystem checks, but got %d", drive1.FilesystemChecks)
+	}
+
+	// once the filesystem is repaired, the drive can be reinstated
+	osi.ClearFailure(os.FakeCheckFilesystem, "/dev/sda")
+	err = osi.RemoveFile("/run/swift-storage/broken/SERIAL1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{DriveReinstatedEvent{DevicePath: "/dev/sda"}})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	if drive1.FilesystemChecks != 3 {
+		t.Errorf("expected 3 filesystem checks, but got %d", drive1.FilesystemChecks)
+	}
+}
+
+func TestConvergerReplaceWithSpare(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1, spare ]`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	spare := &os.FakeDevice{SerialNumber: "SERIAL2"}
+	osi.AddDrive("/dev/sdb", spare)
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdb", "/run/swift-storage/SERIAL2")
+
+	// the failed drive is removed, and the operator turns the spare into its replacement
+	osi.RemoveDrive("/dev/sda")
+	c.HandleEvents([]Event{DriveRemovedEvent{DevicePath: "/dev/sda"}})
+	err := osi.WriteSwiftID("/run/swift-storage/SERIAL2", "swift1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{WakeupEvent{}})
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift1")
+}
+
+func TestConvergerUnexpectedUnmount(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1 ]`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+
+	// somebody unmounts the drive behind our back -> drive is considered broken
+	err := osi.UnmountDevice("/srv/node/swift1", os.HostScope)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if !c.findDrive(t, "/dev/sda").Broken {
+		t.Error("expected /dev/sda to be broken")
+	}
+	expectMountedAt(t, osi, "/dev/sda")
+}
+
+func TestConvergerShutdownKeepsMounts(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1, swift2 ]`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	// a drive that appears in the same batch as the ShutdownEvent must not be formatted
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		ShutdownEvent{},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	if !c.ShuttingDown {
+		t.Error("expected converger to be shutting down")
+	}
+	if deviceType, _ := osi.ClassifyDevice("/dev/sdb"); deviceType != os.DeviceTypeUnknown {
+		t.Error("expected /dev/sdb to not be formatted during shutdown")
+	}
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdb")
+	if _, exists := osi.ReadFile("/run/swift-storage/state/flag-ready"); !exists {
+		t.Error("expected flag-ready to be kept")
+	}
+	expectDriveAudit(t, osi, map[string]int{
+		"/srv/node/swift1":           0,
+		"/run/swift-storage/SERIAL2": 0,
+		"drive_audit_errors":         0,
+	})
+}
+
+func TestConvergerShutdownRequestedDuringBatch(t *testing.T) {
+	c, osi := setupConverger(t, `swift-id-pool: [ swift1 ]`)
+	shutdownRequested := make(chan struct{})
+	c.ShutdownRequested = shutdownRequested
+
+	// the signal arrives while the batch is being processed, before the
+	// ShutdownEvent is received -> no new operations are started
+	close(shutdownRequested)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeUnknown {
+		t.Error("expected /dev/sda to not be formatted after shutdown was requested")
+	}
+	if c.ShuttingDown {
+		t.Error("expected converger to wait for the ShutdownEvent")
+	}
+}
+
+func TestConvergerShutdownUnmountsAll(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1 ],
+		keys: [ { secret: "bzQoG5HN4onneis5bhDmnYqqacoLNCSmDbFEAb3VDztmBtGobH" } ],
+		shutdown-policy: unmount-all,
+	}`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/mapper/SERIAL1", "/srv/node/swift1")
+
+	c.HandleEvents([]Event{ShutdownEvent{}})
+	expectMountedAt(t, osi, "/dev/mapper/SERIAL1")
+	if mapped := osi.GetLUKSMappingOf("/dev/sda"); mapped != "" {
+		t.Errorf("expected LUKS container to be closed, but is still open as %s", mapped)
+	}
+	if _, exists := osi.ReadFile("/run/swift-storage/state/flag-ready"); exists {
+		t.Error("expected flag-ready to be removed")
+	}
+	target, err := osi.ReadSymlink("/run/swift-storage/state/unmount-propagation/swift1")
+	if err != nil || target != "/dev/sda" {
+		t.Errorf("expected unmount-propagation flag for swift1, got %q (err = %v)", target, err)
+	}
+}
+
+func reloadConfig(t *testing.T, c *Converger, configYAML string) {
+	t.Helper()
+	cfg, err := parseConfiguration([]byte(configYAML))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{ConfigChangedEvent{Path: "/etc/swift-drive-autopilot.yaml", NewConfig: cfg}})
+}
+
+func TestConvergerConfigReload(t *testing.T) {
+	c, osi := setupConverger(t, `{ drives: [ "/dev/sd[a-b]" ], swift-id-pool: [ swift1 ] }`)
+	t.Cleanup(func() { SetDriveGlobs(nil) })
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	expectMountedAt(t, osi, "/dev/sdb", "/run/swift-storage/SERIAL2")
+
+	// extending the pool and rotating the keys takes effect immediately
+	reloadConfig(t, c, `{
+		drives: [ "/dev/sd[a-c]" ],
+		swift-id-pool: [ swift1, swift2 ],
+		keys: [ { secret: "newkey" } ],
+		chown: { user: swift },
+	}`)
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	if owner := osi.OwnerOf("/srv/node/swift2"); owner != "swift:" {
+		t.Errorf("expected /srv/node/swift2 to be owned by swift, but is owned by %q", owner)
+	}
+	for _, d := range c.Drives {
+		if len(d.Keys) != 1 || d.Keys[0].Secret != "newkey" {
+			t.Errorf("expected keys of %s to be updated, but got %v", d.DevicePath, d.Keys)
+		}
+	}
+	if globs := GetDriveGlobs(); len(globs) != 1 || globs[0] != "/dev/sd[a-c]" {
+		t.Errorf("expected drive globs to be updated, but got %v", globs)
+	}
+
+	// changing the chroot is rejected as a whole
+	reloadConfig(t, c, `{ chroot: /host, drives: [ "/dev/sd[a-z]" ], swift-id-pool: [ swift1, swift2, swift3 ] }`)
+	if Config.ChrootPath != "" || len(Config.SwiftIDPool) != 2 {
+		t.Errorf("expected configuration change to be rejected, but got %#v", Config)
+	}
+	if globs := GetDriveGlobs(); len(globs) != 1 || globs[0] != "/dev/sd[a-c]" {
+		t.Errorf("expected drive globs to not be updated, but got %v", globs)
+	}
+}
+
+func TestConvergerFilesystemReload(t *testing.T) {
+	c, osi := setupConverger(t, `{ swift-id-pool: [ swift1, swift2, swift3 ] }`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	// changing the filesystem does not affect drives that are already mounted...
+	reloadConfig(t, c, `{ swift-id-pool: [ swift1, swift2, swift3 ], filesystem: ext4 }`)
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if d := c.findDrive(t, "/dev/sda"); d.Broken {
+		t.Errorf("expected /dev/sda to not be broken, but got broken reason %q", d.BrokenReason)
+	}
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	// ...but new drives are formatted with the new filesystem...
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"}})
+	expectMountedAt(t, osi, "/dev/sdb", "/srv/node/swift2")
+	if _, fsType := osi.ClassifyDevice("/dev/sdb"); fsType != os.FilesystemExt4 {
+		t.Errorf("expected /dev/sdb to be formatted with ext4, but got %q", fsType)
+	}
+
+	// ...and drives with the old filesystem are not mounted anymore
+	osi.AddDrive("/dev/sdc", &os.FakeDevice{SerialNumber: "SERIAL3", Type: os.DeviceTypeFilesystem, Filesystem: os.FilesystemXFS})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sdc", SerialNumber: "SERIAL3"}})
+	expectMountedAt(t, osi, "/dev/sdc")
+	if !c.findDrive(t, "/dev/sdc").Broken {
+		t.Error("expected /dev/sdc to be broken")
+	}
+}
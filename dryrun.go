@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// RunDryRun performs a single converger pass on all drives that are currently
+// present, but does not touch any drive (or any other part of the system).
+// Instead, the actions that would have been taken are written to `out`.
+func RunDryRun(osi os.Interface, out io.Writer) {
+	dryRun := os.NewDryRun(osi)
+
+	// find all drives that are present right now (CollectDrives always reports
+	// on its first work cycle, even if no eligible drives were found)
+	trigger := make(chan struct{}, 1)
+	trigger <- struct{}{}
+	added := make(chan []os.Drive)
+	removed := make(chan []string)
+	go dryRun.CollectDrives(GetDriveGlobs, trigger, added, removed)
+	drives := <-added
+
+	events := make([]Event, len(drives))
+	for idx, drive := range drives {
+		events[idx] = newDriveAddedEvent(drive)
+	}
+	c := &Converger{OS: dryRun}
+	c.HandleEvents(events)
+
+	fmt.Fprintln(out, "Dry run complete. The following actions would have been taken:")
+	for _, action := range dryRun.Plan() {
+		fmt.Fprintln(out, "  - "+action)
+	}
+	statuses := c.getDriveStatuses()
+	if len(statuses) == 0 {
+		fmt.Fprintln(out, "No drives were found that the autopilot would manage.")
+		return
+	}
+	fmt.Fprintln(out, "This would have resulted in the following drive states:")
+	for _, s := range statuses {
+		details := []string{string(s.State)}
+		if s.Model != "" {
+			details = append(details, "model "+s.Model)
+		}
+		if s.WWN != "" {
+			details = append(details, "wwn "+s.WWN)
+		}
+		if s.DeviceType != "" {
+			details = append(details, "type "+s.DeviceType)
+		}
+		if s.Assignment != nil && s.Assignment.SwiftID != "" {
+			details = append(details, "swift-id "+s.Assignment.SwiftID)
+		}
+		if s.MountedPath != "" {
+			details = append(details, "mounted at "+s.MountedPath)
+		}
+		if s.BrokenReason != "" {
+			details = append(details, "broken because: "+s.BrokenReason)
+		}
+		fmt.Fprintf(out, "  - %s (%s): %s\n", s.DevicePath, s.DriveID, strings.Join(details, ", "))
+	}
+}
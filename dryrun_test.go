@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func TestDryRun(t *testing.T) {
+	_, osi := setupConverger(t, `{
+		drives: [ "/dev/sd*" ],
+		swift-id-pool: [ swift1, swift2 ],
+		keys: [ { secret: "bzQoG5HN4onneis5bhDmnYqqacoLNCSmDbFEAb3VDztmBtGobH" } ],
+	}`)
+	SetDriveGlobs(Config.DriveGlobs)
+	t.Cleanup(func() { SetDriveGlobs(nil) })
+
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{
+		SerialNumber: "SERIAL2",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"bzQoG5HN4onneis5bhDmnYqqacoLNCSmDbFEAb3VDztmBtGobH"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	})
+
+	var buf bytes.Buffer
+	RunDryRun(osi, &buf)
+
+	// nothing was actually done
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeUnknown {
+		t.Error("expected /dev/sda to not be touched")
+	}
+	if mapped := osi.GetLUKSMappingOf("/dev/sdb"); mapped != "" {
+		t.Errorf("expected LUKS container on /dev/sdb to not be opened, but is opened as %s", mapped)
+	}
+	if _, exists := osi.ReadFile("/run/swift-storage/state/flag-ready"); exists {
+		t.Error("expected flag-ready to not be written")
+	}
+
+	expected := []string{
+		"  - create LUKS container on /dev/sda",
+		"  - open LUKS container on /dev/sda as SERIAL1",
+		"  - format /dev/mapper/SERIAL1 with xfs (mkfs.xfs -f /dev/mapper/SERIAL1)",
+		"  - mount /dev/mapper/SERIAL1 at /run/swift-storage/SERIAL1 in host mount namespace",
+		"  - open LUKS container on /dev/sdb as SERIAL2",
+		"  - mount /dev/mapper/SERIAL2 at /run/swift-storage/SERIAL2 in host mount namespace",
+		// since the swift-id of /dev/sdb cannot be read without opening it, auto-assignment is inhibited
+		"  - /dev/sda (SERIAL1): unassigned, type luks, mounted at /run/swift-storage/SERIAL1",
+		"  - /dev/sdb (SERIAL2): unassigned, type luks, mounted at /run/swift-storage/SERIAL2",
+	}
+	expectDryRunOutput(t, buf.String(), expected...)
+}
+
+func expectDryRunOutput(t *testing.T, output string, expected ...string) {
+	t.Helper()
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected dry-run output to contain %q, but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestDryRunWithExistingMounts(t *testing.T) {
+	c, osi := setupConverger(t, `{ drives: [ "/dev/sd*" ], swift-id-pool: [ swift1, swift2 ] }`)
+	SetDriveGlobs(Config.DriveGlobs)
+	t.Cleanup(func() { SetDriveGlobs(nil) })
+
+	// /dev/sda was set up by a previous run, /dev/sdb is new
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	expectMountedAt(t, osi, "/dev/sda", "/srv/node/swift1")
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+
+	var buf bytes.Buffer
+	RunDryRun(osi, &buf)
+	if deviceType, _ := osi.ClassifyDevice("/dev/sdb"); deviceType != os.DeviceTypeUnknown {
+		t.Error("expected /dev/sdb to not be touched")
+	}
+	expectMountedAt(t, osi, "/dev/sdb")
+
+	expectDryRunOutput(t, buf.String(),
+		"  - format /dev/sdb with xfs (mkfs.xfs -f /dev/sdb)",
+		"  - write swift-id \"swift2\" into /run/swift-storage/SERIAL2",
+		"  - mount /dev/sdb at /srv/node/swift2 in host mount namespace",
+		"  - /dev/sda (SERIAL1): mounted, type xfs, swift-id swift1, mounted at /srv/node/swift1",
+		"  - /dev/sdb (SERIAL2): mounted, type xfs, swift-id swift2, mounted at /srv/node/swift2",
+	)
+}
+
+func TestDryRunWithoutDrives(t *testing.T) {
+	_, osi := setupConverger(t, `{ drives: [ "/dev/sd*" ], swift-id-pool: [ swift1 ] }`)
+	SetDriveGlobs(Config.DriveGlobs)
+	t.Cleanup(func() { SetDriveGlobs(nil) })
+
+	// this used to block forever because CollectDrives did not report anything
+	osi.AddDrive("/dev/vda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	var buf bytes.Buffer
+	RunDryRun(osi, &buf)
+	expectDryRunOutput(t, buf.String(), "No drives were found that the autopilot would manage.")
+}
+
+func TestDryRunReportsDriveIdentity(t *testing.T) {
+	_, osi := setupConverger(t, `{ drives: [ "/dev/sd*" ], swift-id-pool: [ swift1 ] }`)
+	SetDriveGlobs(Config.DriveGlobs)
+	t.Cleanup(func() { SetDriveGlobs(nil) })
+
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", WWN: "0x5000c500a1b2c3d4", Model: "ST12000NM0008"})
+	var buf bytes.Buffer
+	RunDryRun(osi, &buf)
+	expectDryRunOutput(t, buf.String(),
+		"  - /dev/sda (SERIAL1): mounted, model ST12000NM0008, wwn 0x5000c500a1b2c3d4, type xfs, swift-id swift1, mounted at /srv/node/swift1",
+	)
+}
@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	std_os "os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+	"github.com/sapcc/go-bits/secrets"
+)
+
+// KeySource appears in type Configuration. It describes where the secret of a
+// LUKS key is obtained from. In the config file, it can be given as one of:
+//
+//	secret: "plain text"
+//	secret: { fromEnv: ENVIRONMENT_VARIABLE }
+//	secret: { fromFile: /path/to/file }
+//	secret: { fromCommand: "shell command" }
+//	secret: { fromHTTP: { url: "https://...", tokenFile: /path/to/file } }
+//
+// Except for the first two variants, the secret is not retrieved when the
+// configuration is read, but when Configuration.DriveOptions is called (i.e.
+// once after startup, once per configuration reload, and whenever a key file
+// changes).
+type KeySource struct {
+	impl keySourceImpl
+}
+
+type keySourceImpl interface {
+	Resolve() (string, error)
+	Validate() error
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (s *KeySource) UnmarshalYAML(unmarshal func(any) error) error {
+	var input struct {
+		FromFile    string `yaml:"fromFile"`
+		FromCommand string `yaml:"fromCommand"`
+		FromHTTP    *struct {
+			URL       string `yaml:"url"`
+			TokenFile string `yaml:"tokenFile"`
+		} `yaml:"fromHTTP"`
+	}
+	err := unmarshal(&input)
+	if err != nil {
+		// probably a plain text value, or (when unmarshaling strictly)
+		// { fromEnv: ENVIRONMENT_VARIABLE }
+		return s.unmarshalInline(unmarshal)
+	}
+
+	count := 0
+	if input.FromFile != "" {
+		count++
+		s.impl = fileKeySource(input.FromFile)
+	}
+	if input.FromCommand != "" {
+		count++
+		s.impl = commandKeySource(input.FromCommand)
+	}
+	if input.FromHTTP != nil {
+		count++
+		s.impl = httpKeySource{url: input.FromHTTP.URL, tokenFile: input.FromHTTP.TokenFile}
+	}
+	switch count {
+	case 0:
+		return s.unmarshalInline(unmarshal)
+	case 1:
+		return nil
+	default:
+		return errors.New("only one of fromEnv, fromFile, fromCommand and fromHTTP may be given")
+	}
+}
+
+func (s *KeySource) unmarshalInline(unmarshal func(any) error) error {
+	var value secrets.FromEnv
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+	s.impl = inlineKeySource(value)
+	return nil
+}
+
+// Resolve retrieves the secret from this source.
+func (s KeySource) Resolve() (string, error) {
+	if s.impl == nil {
+		return "", nil
+	}
+	return s.impl.Resolve()
+}
+
+// Validate checks the specification of this source for consistency, without
+// actually retrieving the secret.
+func (s KeySource) Validate() error {
+	if s.impl == nil {
+		return errors.New("is empty")
+	}
+	return s.impl.Validate()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// plain text and fromEnv
+
+type inlineKeySource string
+
+func (s inlineKeySource) Resolve() (string, error) {
+	return string(s), nil
+}
+
+func (s inlineKeySource) Validate() error {
+	if s == "" {
+		return errors.New("is empty")
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// fromFile
+
+// Like all other sources, the file is only read when the keys are obtained.
+// The converger watches the file with statKeyFiles() to obtain the keys again
+// when the file changes (e.g. because a Kubernetes secret was updated).
+type fileKeySource string
+
+func (s fileKeySource) Resolve() (string, error) {
+	buf, err := std_os.ReadFile(string(s))
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(buf), "\n")
+	if value == "" {
+		return "", fmt.Errorf("key file %s is empty", string(s))
+	}
+	return value, nil
+}
+
+func (s fileKeySource) Validate() error {
+	if !filepath.IsAbs(string(s)) {
+		return fmt.Errorf("has invalid fromFile path %q (must be absolute)", string(s))
+	}
+	return nil
+}
+
+// keyFileVersion identifies the contents of a key file. Kubernetes updates
+// mounted secrets by swapping a symlink, which changes the inode, but not
+// necessarily the mtime, so both are compared.
+type keyFileVersion struct {
+	ModTime time.Time
+	Inode   uint64
+}
+
+// statKeyFiles returns the current version of each fromFile key source in the
+// given configuration (or the zero value if the file cannot be stat'ed).
+func statKeyFiles(cfg Configuration) map[string]keyFileVersion {
+	result := make(map[string]keyFileVersion)
+	for _, key := range cfg.Keys {
+		path, ok := key.Secret.impl.(fileKeySource)
+		if !ok {
+			continue
+		}
+		var version keyFileVersion
+		fi, err := std_os.Stat(string(path))
+		if err == nil {
+			version.ModTime = fi.ModTime()
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+				version.Inode = st.Ino
+			}
+		}
+		result[string(path)] = version
+	}
+	return result
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// fromCommand
+
+// The command is executed with `sh -c` outside of the chroot. The command
+// package is not used here since it would log the secret in debug mode.
+type commandKeySource string
+
+const keyCommandTimeout = 30 * time.Second
+
+func (s commandKeySource) Resolve() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", string(s))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// see comment in package command
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Run()
+
+	for line := range strings.SplitSeq(stderr.String(), "\n") {
+		if line != "" {
+			logg.Info("Output from key command: %s", line)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("exec(sh -c %q) failed: %w", string(s), err)
+	}
+	value := strings.TrimSuffix(stdout.String(), "\n")
+	if value == "" {
+		return "", fmt.Errorf("exec(sh -c %q) did not produce a key", string(s))
+	}
+	return value, nil
+}
+
+func (s commandKeySource) Validate() error {
+	return nil // an empty command is not recognized as fromCommand by UnmarshalYAML
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// fromHTTP
+
+// The key is obtained with a GET request. If a token file is given, its
+// contents are sent as a bearer token.
+type httpKeySource struct {
+	url       string
+	tokenFile string
+}
+
+const keyRequestTimeout = 30 * time.Second
+
+func (s httpKeySource) Resolve() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	if s.tokenFile != "" {
+		buf, err := std_os.ReadFile(s.tokenFile)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(buf)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("GET %s failed: %w", s.url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// do not put the response body in the error message, in case it contains
+		// something sensitive
+		return "", fmt.Errorf("GET %s failed: got %s", s.url, resp.Status)
+	}
+	value := strings.TrimSuffix(string(buf), "\n")
+	if value == "" {
+		return "", fmt.Errorf("GET %s did not produce a key", s.url)
+	}
+	return value, nil
+}
+
+func (s httpKeySource) Validate() error {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return fmt.Errorf("has invalid fromHTTP.url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("has invalid fromHTTP.url %q (must be a http:// or https:// URL)", s.url)
+	}
+	if s.tokenFile != "" && !filepath.IsAbs(s.tokenFile) {
+		return fmt.Errorf("has invalid fromHTTP.tokenFile path %q (must be absolute)", s.tokenFile)
+	}
+	return nil
+}
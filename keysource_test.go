@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	std_os "os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func parseKeySource(t *testing.T, secretYAML string) KeySource {
+	t.Helper()
+	cfg, err := parseConfiguration([]byte(`{ keys: [ { secret: ` + secretYAML + ` } ] }`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return cfg.Keys[0].Secret
+}
+
+func expectResolvedKey(t *testing.T, s KeySource, expected string) {
+	t.Helper()
+	actual, err := s.Resolve()
+	if err != nil {
+		t.Errorf("expected key %q, but got error: %s", expected, err.Error())
+	} else if actual != expected {
+		t.Errorf("expected key %q, but got %q", expected, actual)
+	}
+}
+
+func TestKeySourceInline(t *testing.T) {
+	t.Setenv("AUTOPILOT_TEST_KEY", "envkey")
+	expectResolvedKey(t, parseKeySource(t, `plainkey`), "plainkey")
+	expectResolvedKey(t, parseKeySource(t, `{ fromEnv: AUTOPILOT_TEST_KEY }`), "envkey")
+}
+
+func TestKeySourceFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	err := std_os.WriteFile(path, []byte("filekey\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	s := parseKeySource(t, `{ fromFile: "`+path+`" }`)
+	expectResolvedKey(t, s, "filekey")
+
+	// an error is reported if the file goes away
+	err = std_os.Remove(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := s.Resolve(); err == nil {
+		t.Error("expected error for missing key file, but got none")
+	}
+}
+
+func TestKeySourceFromCommand(t *testing.T) {
+	expectResolvedKey(t, parseKeySource(t, `{ fromCommand: "echo commandkey" }`), "commandkey")
+
+	_, err := parseKeySource(t, `{ fromCommand: "exit 1" }`).Resolve()
+	if err == nil {
+		t.Error("expected error for failing key command, but got none")
+	}
+}
+
+func TestKeySourceFromHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secrettoken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("httpkey\n")) //nolint:errcheck // test server
+	}))
+	t.Cleanup(srv.Close)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	err := std_os.WriteFile(tokenPath, []byte("secrettoken\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectResolvedKey(t, parseKeySource(t, `{ fromHTTP: { url: "`+srv.URL+`/key", tokenFile: "`+tokenPath+`" } }`), "httpkey")
+
+	_, err = parseKeySource(t, `{ fromHTTP: { url: "`+srv.URL+`/key" } }`).Resolve()
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("expected error for unauthorized request, but got %v", err)
+	}
+}
+
+func TestKeySourceRejectsAmbiguousSpecification(t *testing.T) {
+	_, err := parseConfiguration([]byte(`{ keys: [ { secret: { fromFile: /etc/key, fromCommand: "echo key" } } ] }`))
+	if err == nil || !strings.Contains(err.Error(), "only one of") {
+		t.Errorf("expected error for ambiguous key source, but got %v", err)
+	}
+}
+
+func TestCheckConfigKeySources(t *testing.T) {
+	path := setupCheckConfig(t, `{
+		drives: [ "/dev/sd[a-z]" ],
+		keys: [
+			{ secret: { fromFile: /etc/swift-drive-autopilot/key } },
+			{ secret: { fromCommand: "cat /etc/key" } },
+			{ secret: { fromHTTP: { url: "http://localhost:8200/key", tokenFile: /etc/token } } },
+			{ secret: { fromFile: etc/key } },
+			{ secret: { fromHTTP: { url: "localhost:8200" } } },
+		],
+	}`)
+	expectCheckConfigErrors(t, path,
+		`keys[3].secret has invalid fromFile path "etc/key" (must be absolute)`,
+		`keys[4].secret has invalid fromHTTP.url "localhost:8200" (must be a http:// or https:// URL)`,
+	)
+}
+
+func TestConvergerUnavailableKeySource(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key")
+	c, osi := setupConverger(t, `{ drives: [ "/dev/sd[a-z]" ], keys: [ { secret: { fromFile: "`+keyPath+`" } } ] }`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+
+	// without the key, the drive must not be set up (it would end up without
+	// encryption), but it must not be marked as broken either
+	expectPendingDrive := func() {
+		t.Helper()
+		if len(c.Drives) != 0 || len(c.PendingDrives) != 1 || c.PendingDrives[0].DevicePath != "/dev/sda" {
+			t.Errorf("expected /dev/sda to be pending, but got drives = %v, pending drives = %v", c.Drives, c.PendingDrives)
+		}
+		if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeUnknown {
+			t.Error("expected drive to not be formatted while key is unavailable")
+		}
+		if _, err := osi.ReadSymlink("/run/swift-storage/broken/SERIAL1"); err == nil {
+			t.Error("expected drive to not be flagged as broken while key is unavailable")
+		}
+	}
+	expectPendingDrive()
+	if statuses := c.getDriveStatuses(); len(statuses) != 1 || statuses[0].State != core.DrivePending {
+		t.Errorf("expected status to report /dev/sda as pending, but got %v", statuses)
+	}
+
+	// the keys are retried on every wakeup
+	c.HandleEvents([]Event{WakeupEvent{}})
+	expectPendingDrive()
+
+	// once the key is available, the drive is set up on the next wakeup
+	err := std_os.WriteFile(keyPath, []byte("filekey\n"), 0600)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if len(c.PendingDrives) != 0 {
+		t.Errorf("expected no pending drives, but got %v", c.PendingDrives)
+	}
+	if d := c.findDrive(t, "/dev/sda"); d.Broken {
+		t.Errorf("expected drive to not be broken, but: %s", d.BrokenReason)
+	}
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeLUKS {
+		t.Error("expected drive to be encrypted once the key is available")
+	}
+}
+
+func TestConvergerRemovesPendingDrive(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key")
+	c, osi := setupConverger(t, `{ drives: [ "/dev/sd[a-z]" ], keys: [ { secret: { fromFile: "`+keyPath+`" } } ] }`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	c.HandleEvents([]Event{DriveRemovedEvent{DevicePath: "/dev/sda"}})
+
+	if len(c.Drives) != 0 || len(c.PendingDrives) != 0 {
+		t.Errorf("expected no drives, but got drives = %v, pending drives = %v", c.Drives, c.PendingDrives)
+	}
+}
+
+func TestConvergerObtainsKeysOncePerConfiguration(t *testing.T) {
+	countPath := filepath.Join(t.TempDir(), "count")
+	configYAML := `{ drives: [ "/dev/sd[a-z]" ], keys: [ { secret: { fromCommand: "echo >> ` + countPath + `; echo commandkey" } } ] }`
+	expectCount := func(expected int) {
+		t.Helper()
+		buf, err := std_os.ReadFile(countPath)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if actual := strings.Count(string(buf), "\n"); actual != expected {
+			t.Errorf("expected key command to have been run %d times, but was run %d times", expected, actual)
+		}
+	}
+
+	c, osi := setupConverger(t, configYAML)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	osi.AddDrive("/dev/sdc", &os.FakeDevice{SerialNumber: "SERIAL3"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sdc", SerialNumber: "SERIAL3"}})
+	expectCount(1)
+
+	// reloading the configuration obtains the keys again
+	reloadConfig(t, c, configYAML)
+	c.HandleEvents([]Event{DriveReinstatedEvent{DevicePath: "/dev/sda"}})
+	expectCount(2)
+}
+
+func TestConvergerObtainsKeysAgainWhenKeyFileChanges(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	writeKeyFile := func(value string) {
+		t.Helper()
+		// replace the file instead of writing it in place, like Kubernetes does
+		tmpPath := filepath.Join(dir, "key.tmp")
+		err := std_os.WriteFile(tmpPath, []byte(value+"\n"), 0600)
+		if err == nil {
+			err = std_os.Rename(tmpPath, keyPath)
+		}
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	writeKeyFile("oldkey")
+
+	c, osi := setupConverger(t, `{ drives: [ "/dev/sd[a-z]" ], keys: [ { secret: { fromFile: "`+keyPath+`" } } ] }`)
+	dev := &os.FakeDevice{SerialNumber: "SERIAL1"}
+	osi.AddDrive("/dev/sda", dev)
+	c.HandleEvents([]Event{DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"}})
+	if len(dev.LUKSKeys) != 1 {
+		t.Fatalf("expected one LUKS key slot, but got %d", len(dev.LUKSKeys))
+	}
+
+	// an unchanged key file is not read again
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if len(dev.LUKSKeys) != 1 {
+		t.Errorf("expected one LUKS key slot, but got %d", len(dev.LUKSKeys))
+	}
+
+	// when the key file changes, the new key is enrolled on the next wakeup
+	// without a configuration reload
+	writeKeyFile("newkey")
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if secret := c.findDrive(t, "/dev/sda").Keys[0].Secret; secret != "newkey" {
+		t.Errorf("expected drive to use key %q, but got %q", "newkey", secret)
+	}
+	if len(dev.LUKSKeys) != 2 || dev.LUKSKeys[1] == "" || dev.LUKSKeys[1] == dev.LUKSKeys[0] {
+		t.Errorf("expected new key to be enrolled in a second key slot, but got %q", dev.LUKSKeys)
+	}
+
+	// if the key file goes away, the previous keys remain in effect
+	err := std_os.Remove(keyPath)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.HandleEvents([]Event{WakeupEvent{}})
+	if d := c.findDrive(t, "/dev/sda"); d.Broken || d.Keys[0].Secret != "newkey" {
+		t.Errorf("expected drive to keep using key %q, but got %q (broken: %t)", "newkey", d.Keys[0].Secret, d.Broken)
+	}
+}
@@ -5,12 +5,17 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	std_os "os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sapcc/go-api-declarations/bininfo"
 	"github.com/sapcc/go-bits/httpext"
 	"github.com/sapcc/go-bits/logg"
 	"github.com/sapcc/go-bits/must"
@@ -24,6 +29,34 @@ import (
 func main() {
 	logg.SetLogger(log.New(std_os.Stdout, log.Prefix(), log.Flags())) // use stdout instead of stderr for backwards-compatibility
 	logg.ShowDebug = osext.GetenvBool("DEBUG")
+	bininfo.HandleVersionArgument()
+
+	// expect one argument (config file name), or the check-config subcommand
+	if len(std_os.Args) == 3 && std_os.Args[1] == "check-config" {
+		std_os.Exit(RunCheckConfig(std_os.Args[2]))
+	}
+	dryRun := false
+	if len(std_os.Args) == 3 && std_os.Args[1] == "--dry-run" {
+		dryRun = true
+		std_os.Args = append(std_os.Args[:1], std_os.Args[2:]...)
+	}
+	if len(std_os.Args) != 2 {
+		fmt.Fprintf(std_os.Stderr, "Usage: %s [--dry-run] <config-file>\n", std_os.Args[0])
+		fmt.Fprintf(std_os.Stderr, "   or: %s check-config <config-file>\n", std_os.Args[0])
+		std_os.Exit(1)
+	}
+	// the config file path needs to be absolute since we chdir below, but
+	// re-read the config file on SIGHUP
+	configPath, err := filepath.Abs(std_os.Args[1])
+	if err != nil {
+		logg.Fatal(err.Error())
+	}
+	Config, err = ReadConfiguration(configPath)
+	if err != nil {
+		logg.Fatal(err.Error())
+	}
+	SetDriveGlobs(Config.DriveGlobs)
+	SetKernelLogPatterns(Config.kernelLogPatterns)
 
 	// set working directory to the chroot directory; this simplifies file
 	// system operations because we can just use relative paths to refer to
@@ -32,11 +65,17 @@ func main() {
 	if Config.ChrootPath != "" {
 		workingDir = Config.ChrootPath
 	}
-	err := std_os.Chdir(workingDir)
+	err = std_os.Chdir(workingDir)
 	if err != nil {
 		logg.Fatal("chdir to %s: %s", workingDir, err.Error())
 	}
 
+	// in dry-run mode, do not touch anything at all
+	if dryRun {
+		RunDryRun(must.Return(os.NewLinux(Config.SerialNumberSources, Config.IgnoredMountPaths)), std_os.Stdout)
+		return
+	}
+
 	// prepare directories that the converger wants to write to
 	command.Command{ExitOnError: true}.Run("mkdir", "-p",
 		"/run/swift-storage/broken",
@@ -46,7 +85,7 @@ func main() {
 	)
 
 	// swift cache path must be accessible from user swift
-	osi := must.Return(os.NewLinux())
+	osi := must.Return(os.NewLinux(Config.SerialNumberSources, Config.IgnoredMountPaths))
 	osi.Chown("/var/cache/swift", Config.Owner.User, Config.Owner.Group)
 
 	// start the metrics endpoint
@@ -54,22 +93,33 @@ func main() {
 		go func() {
 			mux := http.NewServeMux()
 			mux.Handle("/metrics", promhttp.Handler())
+			mux.HandleFunc("/status", ServeStatus)
 			ctx := httpext.ContextWithSIGINT(context.Background(), 1*time.Second)
 			must.Succeed(httpext.ListenAndServeContext(ctx, Config.MetricsListenAddress, mux))
 		}()
 	}
 
+	// SIGINT/SIGTERM stops the collectors and makes the converger shut down
+	// after its current event loop iteration
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// start the collectors
 	queue := make(chan []Event, 10)
-	go CollectDriveEvents(osi, queue)
-	go CollectReinstatements(queue)
-	go ScheduleWakeups(queue)
-	go WatchKernelLog(osi, queue)
+	go CollectDriveEvents(ctx, osi, Config.WatchUevents, queue)
+	go CollectReinstatements(ctx, queue)
+	go ScheduleWakeups(ctx, queue)
+	go WatchKernelLog(ctx, osi, queue)
+	if Config.smartInterval > 0 {
+		go CollectSMARTHealth(ctx, osi, Config.smartInterval, queue)
+	}
+	go CollectConfigChanges(ctx, configPath, queue)
+	go WaitForShutdown(ctx, queue)
 
 	if util.InTestMode() {
 		util.SetupTestMode()
 	}
 
 	// the converger runs in the main thread
-	RunConverger(queue, osi)
+	RunConverger(ctx, queue, osi)
 }
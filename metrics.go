@@ -3,7 +3,11 @@
 
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+)
 
 var eventCounter = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
@@ -13,8 +17,166 @@ var eventCounter = prometheus.NewCounterVec(
 	[]string{"type"},
 )
 
+var drivesGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_drives",
+		Help: "Number of drives known to the autopilot, by state.",
+	},
+	[]string{"state"},
+)
+
+var driveInfoGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_drive_info",
+		Help: "Constant value of 1 for each drive known to the autopilot, labeled with identifying information.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var luksKeyIndexGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_luks_key_index",
+		Help: "Index (in the configured list of keys) of the key that opens the drive's LUKS container.",
+	},
+	[]string{"serial", "device_path"},
+)
+
+var kernelLogErrorsGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_kernel_log_errors",
+		Help: "Number of recent kernel log errors on drives that are suspect (but not yet broken), by error policy.",
+	},
+	[]string{"serial", "device_path", "policy"},
+)
+
+var smartHealthPassedGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_smart_health_passed",
+		Help: "Result of the drive's SMART health self-assessment (1 if passed, 0 if failed).",
+	},
+	[]string{"serial", "device_path"},
+)
+
+var smartTemperatureGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_smart_temperature_celsius",
+		Help: "Current temperature of the drive as reported by SMART.",
+	},
+	[]string{"serial", "device_path"},
+)
+
+var smartReallocatedSectorsGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_smart_reallocated_sectors",
+		Help: "Number of reallocated sectors (or grown defects) of the drive as reported by SMART.",
+	},
+	[]string{"serial", "device_path"},
+)
+
+var smartPendingSectorsGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_smart_pending_sectors",
+		Help: "Number of sectors of the drive that are pending reallocation as reported by SMART.",
+	},
+	[]string{"serial", "device_path"},
+)
+
+var filesystemSizeGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_size_bytes",
+		Help: "Total size of the filesystem on each mounted drive.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var filesystemFreeGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_free_bytes",
+		Help: "Space available to unprivileged users on the filesystem on each mounted drive.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var filesystemUsedGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_used_bytes",
+		Help: "Used space on the filesystem on each mounted drive.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var filesystemInodesGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_inodes",
+		Help: "Total number of inodes on the filesystem on each mounted drive.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var filesystemInodesFreeGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_inodes_free",
+		Help: "Number of free inodes on the filesystem on each mounted drive.",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var filesystemNearlyFullGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_filesystem_nearly_full",
+		Help: "Whether the filesystem on each mounted drive has reached the configured nearly-full-threshold (1 if so, 0 otherwise).",
+	},
+	[]string{"serial", "device_path", "swift_id"},
+)
+
+var kernelLogWatcherGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_kernel_log_watcher_up",
+		Help: "Whether the kernel log is currently being watched for drive errors (1 if so, 0 otherwise).",
+	},
+)
+
+var unusedPoolIDsGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "swift_drive_autopilot_swift_id_pool_unused",
+		Help: "Number of entries in the configured swift-id-pool that are not assigned to any drive.",
+	},
+)
+
+var poolExhaustedCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "swift_drive_autopilot_swift_id_pool_exhausted",
+		Help: "Counts how often a swift-id could not be auto-assigned to a drive because the swift-id-pool was exhausted.",
+	},
+)
+
+var unexpectedMountsCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "swift_drive_autopilot_unexpected_mounts",
+		Help: "Counts how often an unexpected mount below /srv/node was found during consistency checks.",
+	},
+)
+
 func init() {
 	prometheus.MustRegister(eventCounter)
+	prometheus.MustRegister(drivesGauge)
+	prometheus.MustRegister(driveInfoGauge)
+	prometheus.MustRegister(luksKeyIndexGauge)
+	prometheus.MustRegister(kernelLogErrorsGauge)
+	prometheus.MustRegister(smartHealthPassedGauge)
+	prometheus.MustRegister(smartTemperatureGauge)
+	prometheus.MustRegister(smartReallocatedSectorsGauge)
+	prometheus.MustRegister(smartPendingSectorsGauge)
+	prometheus.MustRegister(filesystemSizeGauge)
+	prometheus.MustRegister(filesystemFreeGauge)
+	prometheus.MustRegister(filesystemUsedGauge)
+	prometheus.MustRegister(filesystemInodesGauge)
+	prometheus.MustRegister(filesystemInodesFreeGauge)
+	prometheus.MustRegister(filesystemNearlyFullGauge)
+	prometheus.MustRegister(kernelLogWatcherGauge)
+	prometheus.MustRegister(unusedPoolIDsGauge)
+	prometheus.MustRegister(poolExhaustedCounter)
+	prometheus.MustRegister(unexpectedMountsCounter)
 
 	// make sure that the count for every event type is reported, even as 0, so
 	// that users know which (possibly rare) events can occur
@@ -23,9 +185,106 @@ func init() {
 		DriveRemovedEvent{},
 		DriveReinstatedEvent{},
 		DriveErrorEvent{},
+		DriveHealthEvent{},
 		WakeupEvent{},
+		ConfigChangedEvent{},
+		ShutdownEvent{},
 	}
 	for _, event := range events {
 		eventCounter.With(prometheus.Labels{"type": event.EventType()}).Add(0)
 	}
 }
+
+// ReportMetrics updates the gauges that describe the converger's current state.
+func (c *Converger) ReportMetrics() {
+	counts := make(map[core.DriveState]int)
+	driveInfoGauge.Reset()
+	luksKeyIndexGauge.Reset()
+	kernelLogErrorsGauge.Reset()
+	for _, gauge := range []*prometheus.GaugeVec{smartHealthPassedGauge, smartTemperatureGauge, smartReallocatedSectorsGauge, smartPendingSectorsGauge} {
+		gauge.Reset()
+	}
+	for _, gauge := range []*prometheus.GaugeVec{filesystemSizeGauge, filesystemFreeGauge, filesystemUsedGauge, filesystemInodesGauge, filesystemInodesFreeGauge, filesystemNearlyFullGauge} {
+		gauge.Reset()
+	}
+	for _, d := range c.Drives {
+		state := d.State()
+		counts[state]++
+
+		swiftID := ""
+		if d.Assignment != nil {
+			swiftID = d.Assignment.SwiftID
+		}
+		driveInfoGauge.With(prometheus.Labels{
+			"serial":      d.DriveID,
+			"device_path": d.DevicePath,
+			"swift_id":    swiftID,
+		}).Set(1)
+
+		if u := d.FilesystemUsage; u != nil {
+			labels := prometheus.Labels{
+				"serial":      d.DriveID,
+				"device_path": d.DevicePath,
+				"swift_id":    swiftID,
+			}
+			filesystemSizeGauge.With(labels).Set(float64(u.TotalBytes))
+			filesystemFreeGauge.With(labels).Set(float64(u.FreeBytes))
+			filesystemUsedGauge.With(labels).Set(float64(u.UsedBytes))
+			filesystemInodesGauge.With(labels).Set(float64(u.TotalInodes))
+			filesystemInodesFreeGauge.With(labels).Set(float64(u.FreeInodes))
+			if d.NearlyFullThreshold > 0 {
+				nearlyFull := 0.0
+				if d.IsNearlyFull() {
+					nearlyFull = 1
+				}
+				filesystemNearlyFullGauge.With(labels).Set(nearlyFull)
+			}
+		}
+
+		if keyIndex := d.LUKSKeyIndex(); keyIndex >= 0 {
+			luksKeyIndexGauge.With(prometheus.Labels{
+				"serial":      d.DriveID,
+				"device_path": d.DevicePath,
+			}).Set(float64(keyIndex))
+		}
+
+		if h := d.SMARTHealth; h != nil {
+			labels := prometheus.Labels{
+				"serial":      d.DriveID,
+				"device_path": d.DevicePath,
+			}
+			if h.Passed != nil {
+				passed := 0.0
+				if *h.Passed {
+					passed = 1
+				}
+				smartHealthPassedGauge.With(labels).Set(passed)
+			}
+			if h.TemperatureCelsius != nil {
+				smartTemperatureGauge.With(labels).Set(float64(*h.TemperatureCelsius))
+			}
+			if h.ReallocatedSectors != nil {
+				smartReallocatedSectorsGauge.With(labels).Set(float64(*h.ReallocatedSectors))
+			}
+			if h.PendingSectors != nil {
+				smartPendingSectorsGauge.With(labels).Set(float64(*h.PendingSectors))
+			}
+		}
+
+		for policyName, count := range d.KernelLogErrorCounts() {
+			kernelLogErrorsGauge.With(prometheus.Labels{
+				"serial":      d.DriveID,
+				"device_path": d.DevicePath,
+				"policy":      policyName,
+			}).Set(float64(count))
+		}
+	}
+
+	counts[core.DrivePending] = len(c.PendingDrives)
+
+	// report every state, even as 0, so that alerts on e.g. state="broken" do
+	// not need to handle missing time series
+	for _, state := range core.AllDriveStates {
+		drivesGauge.With(prometheus.Labels{"state": string(state)}).Set(float64(counts[state]))
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func getGaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	var m dto.Metric
+	err := g.Write(&m)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return m.GetGauge().GetValue()
+}
+
+func TestDriveMetrics(t *testing.T) {
+	c, osi := setupConverger(t, `{ swift-id-pool: [ swift1, swift2, spare, swift3 ] }`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2", Type: os.DeviceTypeFilesystem, SwiftID: "swift1"})
+	osi.AddDrive("/dev/sdc", &os.FakeDevice{SerialNumber: "SERIAL3", Type: os.DeviceTypeFilesystem, SwiftID: "swift1"})
+	osi.AddDrive("/dev/sdd", &os.FakeDevice{SerialNumber: "SERIAL4", Type: os.DeviceTypeUnreadable})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+		DriveAddedEvent{DevicePath: "/dev/sdc", SerialNumber: "SERIAL3"},
+		DriveAddedEvent{DevicePath: "/dev/sdd", SerialNumber: "SERIAL4"},
+	})
+
+	expected := map[string]float64{
+		"mounted":    0,
+		"spare":      0,
+		"broken":     1,
+		"unassigned": 1, // auto-assignment is blocked by the broken drive
+		"duplicate":  2,
+		"mismatch":   0,
+	}
+	for state, value := range expected {
+		actual := getGaugeValue(t, drivesGauge.With(prometheus.Labels{"state": state}))
+		if actual != value {
+			t.Errorf("expected swift_drive_autopilot_drives{state=%q} = %g, but got %g", state, value, actual)
+		}
+	}
+
+	info := getGaugeValue(t, driveInfoGauge.With(prometheus.Labels{"serial": "SERIAL2", "device_path": "/dev/sdb", "swift_id": "swift1"}))
+	if info != 1 {
+		t.Errorf("expected drive info metric for SERIAL2 to be 1, but got %g", info)
+	}
+	// swift1 is in use by the duplicate drives, so only swift2, spare and swift3 remain
+	if unused := getGaugeValue(t, unusedPoolIDsGauge); unused != 3 {
+		t.Errorf("expected 3 unused swift-ids in pool, but got %g", unused)
+	}
+}
+
+func TestKernelLogWatcherMetric(t *testing.T) {
+	kernelLogWatcherGauge.Set(0)
+	osi := os.NewFake()
+	queue := make(chan []Event, 10)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go WatchKernelLog(ctx, osi, queue)
+
+	// the watcher reports that it is alive before any events arrive
+	osi.InjectDriveError("/dev/sda", "blk_update_request: I/O error, dev sda, sector 1234")
+	events := <-queue
+	if len(events) != 1 || events[0].(DriveErrorEvent).DevicePath != "/dev/sda" {
+		t.Errorf("expected DriveErrorEvent for /dev/sda, but got %#v", events)
+	}
+	if value := getGaugeValue(t, kernelLogWatcherGauge); value != 1 {
+		t.Errorf("expected swift_drive_autopilot_kernel_log_watcher_up = 1, but got %g", value)
+	}
+}
+
+func TestEventCounterIsPreregistered(t *testing.T) {
+	ch := make(chan prometheus.Metric, 100)
+	eventCounter.Collect(ch)
+	close(ch)
+	reported := make(map[string]bool)
+	for metric := range ch {
+		var m dto.Metric
+		err := metric.Write(&m)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for _, label := range m.GetLabel() {
+			reported[label.GetValue()] = true
+		}
+	}
+
+	for _, eventType := range []string{"drive-added", "drive-removed", "drive-reinstated", "drive-error", "drive-health", "consistency-check", "config-changed", "shutdown"} {
+		if !reported[eventType] {
+			t.Errorf("expected swift_drive_autopilot_events{type=%q} to be reported", eventType)
+		}
+	}
+}
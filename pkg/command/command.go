@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 
 	"github.com/sapcc/go-bits/logg"
 )
@@ -32,16 +33,11 @@ type Command struct {
 func (c Command) Run(cmd ...string) (stdout string, success bool) {
 	cmdName := cmd[0]
 
-	// if we are executing mount, we need to make sure that we are in the
-	// correct mount namespace; for cryptsetup, we even need to be in the
-	// correct IPC namespace (device-mapper wants to talk to udev)
-	if !c.NoNsenter {
-		switch cmd[0] {
-		case "mount", "umount":
-			cmd = append([]string{"nsenter", "--mount=/proc/1/ns/mnt", "--"}, cmd...)
-		case "cryptsetup":
-			cmd = append([]string{"nsenter", "--mount=/proc/1/ns/mnt", "--ipc=/proc/1/ns/ipc", "--"}, cmd...)
-		}
+	// if we are executing cryptsetup, we need to make sure that we are in the
+	// correct mount namespace and IPC namespace (device-mapper wants to talk to
+	// udev); mounts are performed by package os without spawning a process
+	if !c.NoNsenter && cmdName == "cryptsetup" {
+		cmd = append([]string{"nsenter", "--mount=/proc/1/ns/mnt", "--ipc=/proc/1/ns/ipc", "--"}, cmd...)
 	}
 
 	// prepend chroot if requested (note that if there is a ChrootPath, it's our
@@ -62,6 +58,13 @@ func (c Command) Run(cmd ...string) (stdout string, success bool) {
 	execCmd := exec.Command(cmd[0], cmd[1:]...) //nolint:gosec // inputs are not user supplied
 	execCmd.Stdout = stdoutBuf
 	execCmd.Stderr = stderrBuf
+	// Put the child process into its own process group. Otherwise, when the
+	// container runtime (or dumb-init, or the user pressing Ctrl-C) sends
+	// SIGTERM/SIGINT to our process group, commands like mkfs.xfs or
+	// cryptsetup luksFormat would be killed halfway through. We handle these
+	// signals by shutting down gracefully after the current command has
+	// completed instead.
+	execCmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	if c.Stdin != "" {
 		execCmd.Stdin = bytes.NewReader([]byte(c.Stdin))
 	}
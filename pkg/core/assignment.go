@@ -90,9 +90,21 @@ func (a *Assignment) MountPath() string {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// AssignmentStats is returned by UpdateDriveAssignments.
+type AssignmentStats struct {
+	// UnusedPoolIDs counts the entries in the swift-id pool that are not
+	// assigned to any drive.
+	UnusedPoolIDs int
+	// PoolExhausted counts the drives that could not be assigned a swift-id
+	// because all entries in the swift-id pool were used up.
+	PoolExhausted int
+}
+
 // UpdateDriveAssignments scans all drives for their swift-id assignments, and
 // auto-assigns swift-ids from the given pool if required and possible.
-func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interface) {
+func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interface) AssignmentStats {
+	var stats AssignmentStats
+
 	// are there any broken drives?
 	hasBrokenDrives := false
 	for _, drive := range drives {
@@ -105,6 +117,7 @@ func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interf
 	// read existing swift-id assignments
 	drivesBySwiftID := make(map[string]*Drive)
 	hasMismountedDrives := false
+	hasUnknownSwiftIDs := false
 	isAssignedSwiftID := make(map[string]bool)
 	spareIdx := 0
 	for _, drive := range drives {
@@ -118,6 +131,7 @@ func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interf
 		swiftID, err := osi.ReadSwiftID(mountedPath)
 		if err != nil {
 			logg.Error(err.Error())
+			hasUnknownSwiftIDs = true // like with broken drives, this inhibits automatic assignment
 			continue
 		} else if swiftID == "" {
 			if len(swiftIDPool) > 0 {
@@ -174,8 +188,9 @@ func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interf
 	}
 
 	// can we perform auto-assignment?
-	if hasBrokenDrives || hasMismountedDrives || len(swiftIDPool) == 0 {
-		return
+	if hasBrokenDrives || hasMismountedDrives || hasUnknownSwiftIDs || len(swiftIDPool) == 0 {
+		stats.UnusedPoolIDs = countUnusedPoolIDs(swiftIDPool, isAssignedSwiftID)
+		return stats
 	}
 
 	// perform auto-assignment
@@ -197,6 +212,7 @@ func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interf
 			if poolID == "" {
 				//TODO: This may get spammy since it is printed during each converger pass.
 				logg.Error("tried to assign swift-id to %s, but pool is exhausted", drive.DevicePath)
+				stats.PoolExhausted++
 				continue
 			}
 
@@ -216,4 +232,17 @@ func UpdateDriveAssignments(drives []*Drive, swiftIDPool []string, osi os.Interf
 			Assignment{SwiftID: swiftID}.Apply(drive)
 		}
 	}
+
+	stats.UnusedPoolIDs = countUnusedPoolIDs(swiftIDPool, isAssignedSwiftID)
+	return stats
+}
+
+func countUnusedPoolIDs(swiftIDPool []string, isAssignedSwiftID map[string]bool) int {
+	count := 0
+	for _, id := range swiftIDPool {
+		if !isAssignedSwiftID[id] {
+			count++
+		}
+	}
+	return count
 }
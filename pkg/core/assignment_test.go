@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// Sets up one drive per given swift-id (an empty swift-id means an empty
+// drive, "-" means an unreadable drive) and converges them once.
+func setupDrives(t *testing.T, osi *os.Fake, swiftIDs ...string) []*Drive {
+	t.Helper()
+	drives := make([]*Drive, len(swiftIDs))
+	for idx, swiftID := range swiftIDs {
+		devicePath := fmt.Sprintf("/dev/sd%c", 'a'+idx)
+		dev := &os.FakeDevice{SerialNumber: fmt.Sprintf("SERIAL%d", idx+1)}
+		switch swiftID {
+		case "":
+			dev.Type = os.DeviceTypeUnknown
+		case "-":
+			dev.Type = os.DeviceTypeUnreadable
+		default:
+			dev.Type = os.DeviceTypeFilesystem
+			dev.SwiftID = swiftID
+		}
+		osi.AddDrive(devicePath, dev)
+		drives[idx] = NewDrive(devicePath, dev.SerialNumber, DriveOptions{}, osi)
+		drives[idx].Converge(osi)
+	}
+	return drives
+}
+
+func convergeAll(drives []*Drive, swiftIDPool []string, osi os.Interface) AssignmentStats {
+	stats := UpdateDriveAssignments(drives, swiftIDPool, osi)
+	for _, d := range drives {
+		if !d.Broken {
+			d.Converge(osi)
+		}
+	}
+	return stats
+}
+
+func expectStats(t *testing.T, actual, expected AssignmentStats) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("expected UpdateDriveAssignments to return %#v, but got %#v", expected, actual)
+	}
+}
+
+func expectMountPath(t *testing.T, d *Drive, expected string) {
+	t.Helper()
+	if actual := d.MountedPath(); actual != expected {
+		t.Errorf("expected %s to be mounted at %q, but is mounted at %q", d.DevicePath, expected, actual)
+	}
+}
+
+func expectAssignmentError(t *testing.T, d *Drive, expected AssignmentError) {
+	t.Helper()
+	var actual AssignmentError
+	if d.Assignment != nil {
+		actual = d.Assignment.Error
+	}
+	if actual != expected {
+		t.Errorf("expected assignment error for %s to be %q, but got %q", d.DevicePath, expected, actual)
+	}
+}
+
+func TestAssignmentFromPoolIsOrdered(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "", "", "swift2")
+	stats := convergeAll(drives, []string{"swift1", "swift2", "swift3", "swift4"}, osi)
+	expectStats(t, stats, AssignmentStats{UnusedPoolIDs: 1})
+
+	expectMountPath(t, drives[0], "/srv/node/swift1")
+	expectMountPath(t, drives[1], "/srv/node/swift3")
+	expectMountPath(t, drives[2], "/srv/node/swift2")
+	for _, d := range drives {
+		expectAssignmentError(t, d, "")
+	}
+}
+
+func TestAssignmentWithoutPool(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "", "swift1")
+	convergeAll(drives, nil, osi)
+
+	expectMountPath(t, drives[0], "/run/swift-storage/SERIAL1")
+	expectAssignmentError(t, drives[0], AssignmentMissing)
+	expectMountPath(t, drives[1], "/srv/node/swift1")
+}
+
+func TestAssignmentOfSpareDisks(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "", "", "", "")
+	stats := convergeAll(drives, []string{"spare/0", "swift1", "swift2", "spare/1"}, osi)
+	expectStats(t, stats, AssignmentStats{UnusedPoolIDs: 0})
+
+	expectMountPath(t, drives[0], "/run/swift-storage/SERIAL1")
+	expectMountPath(t, drives[1], "/srv/node/swift1")
+	expectMountPath(t, drives[2], "/srv/node/swift2")
+	expectMountPath(t, drives[3], "/run/swift-storage/SERIAL4")
+	for _, idx := range []int{0, 3} {
+		swiftID, err := osi.ReadSwiftID(drives[idx].MountedPath())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if swiftID != "spare" {
+			t.Errorf("expected %s to be assigned as spare, but got swift-id %q", drives[idx].DevicePath, swiftID)
+		}
+	}
+}
+
+func TestAssignmentBlockedByBrokenDrive(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "", "-")
+	stats := convergeAll(drives, []string{"swift1", "swift2"}, osi)
+	expectStats(t, stats, AssignmentStats{UnusedPoolIDs: 2})
+
+	expectMountPath(t, drives[0], "/run/swift-storage/SERIAL1")
+	expectAssignmentError(t, drives[0], AssignmentBlocked)
+	if swiftID, _ := osi.ReadSwiftID(drives[0].MountedPath()); swiftID != "" {
+		t.Errorf("expected no swift-id to be assigned, but got %q", swiftID)
+	}
+}
+
+func TestAssignmentWithExhaustedPool(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "swift1", "")
+	stats := convergeAll(drives, []string{"swift1"}, osi)
+	expectStats(t, stats, AssignmentStats{UnusedPoolIDs: 0, PoolExhausted: 1})
+
+	expectMountPath(t, drives[0], "/srv/node/swift1")
+	expectMountPath(t, drives[1], "/run/swift-storage/SERIAL2")
+	expectAssignmentError(t, drives[1], AssignmentPending)
+}
+
+func TestDuplicateSwiftIDs(t *testing.T) {
+	osi := os.NewFake()
+	drives := setupDrives(t, osi, "swift1", "swift1", "swift2")
+	convergeAll(drives, nil, osi)
+
+	expectMountPath(t, drives[0], "/run/swift-storage/SERIAL1")
+	expectAssignmentError(t, drives[0], AssignmentDuplicate)
+	expectMountPath(t, drives[1], "/run/swift-storage/SERIAL2")
+	expectAssignmentError(t, drives[1], AssignmentDuplicate)
+	expectMountPath(t, drives[2], "/srv/node/swift2")
+}
+
+func TestMismatchingMountPoint(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeFilesystem, SwiftID: "swift1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	// simulate a leftover mount from a previous run that does not match the swift-id
+	for _, scope := range []os.MountScope{os.HostScope, os.LocalScope} {
+		err := osi.MountDevice("/dev/sda", "/srv/node/swift2", nil, scope)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	drives := []*Drive{
+		NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi),
+		NewDrive("/dev/sdb", "SERIAL2", DriveOptions{}, osi),
+	}
+	for _, d := range drives {
+		d.Converge(osi)
+	}
+	convergeAll(drives, []string{"swift1", "swift2", "swift3"}, osi)
+
+	expectMountPath(t, drives[0], "/srv/node/swift2")
+	expectAssignmentError(t, drives[0], AssignmentMismatch)
+	// auto-assignment is inhibited while a drive is mismounted
+	expectMountPath(t, drives[1], "/run/swift-storage/SERIAL2")
+	expectAssignmentError(t, drives[1], AssignmentPending)
+}
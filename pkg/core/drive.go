@@ -7,21 +7,20 @@ import (
 	"crypto/md5" //nolint:gosec // usage is not security related
 	"encoding/hex"
 	std_os "os"
-	"strings"
 
 	"github.com/sapcc/go-bits/logg"
 
-	"github.com/sapcc/swift-drive-autopilot/pkg/command"
 	"github.com/sapcc/swift-drive-autopilot/pkg/os"
 )
 
 // NewDrive initializes a Drive instance.
-func NewDrive(devicePath, serialNumber string, keys []string, osi os.Interface) *Drive {
+func NewDrive(devicePath, serialNumber string, opts DriveOptions, osi os.Interface) *Drive {
 	d := &Drive{
-		DevicePath: devicePath,
-		Device:     newDevice(devicePath, osi, len(keys) > 0),
-		DriveID:    serialNumber,
-		Keys:       keys,
+		DevicePath:   devicePath,
+		Device:       newDevice(devicePath, osi, opts, true),
+		DriveID:      serialNumber,
+		SerialNumber: serialNumber,
+		DriveOptions: opts,
 	}
 
 	// fallback value for DriveID is md5sum of devicePath
@@ -36,16 +35,17 @@ func NewDrive(devicePath, serialNumber string, keys []string, osi os.Interface)
 	// detect unreadable device
 	if d.Device == nil {
 		d.Broken = true
+		d.BrokenReason = "device is not readable"
 	}
 
 	// check if the broken-flag is still present
 	for _, brokenFlagPath := range []string{d.TransientBrokenFlagPath(), d.DurableBrokenFlagPath()} {
-		_, err := std_os.Readlink(strings.TrimPrefix(brokenFlagPath, "/"))
+		_, err := osi.ReadSymlink(brokenFlagPath)
 		switch {
 		case err == nil:
 			// link still exists, so device is broken
 			logg.Info("%s was flagged as broken by a previous run of swift-drive-autopilot", d.DevicePath)
-			d.MarkAsBroken(osi) // this will re-print the log message explaining how to reinstate the drive into the cluster
+			d.MarkAsBroken(osi, "flagged as broken at "+brokenFlagPath) // this will re-print the log message explaining how to reinstate the drive into the cluster
 		case std_os.IsNotExist(err):
 			// ignore this error (no broken-flag means everything's okay)
 		default:
@@ -64,6 +64,33 @@ func (d *Drive) MountedPath() string {
 	return d.Device.MountedPath()
 }
 
+// LUKSKeyIndex returns the index of the key in d.Keys that opens this drive's
+// LUKS container, or -1 if the drive is not encrypted or the key is not known.
+func (d *Drive) LUKSKeyIndex() int {
+	if luksDevice, ok := d.Device.(*LUKSDevice); ok {
+		return luksDevice.KeyIndex()
+	}
+	return -1
+}
+
+// LUKSHeaderMismatches returns a description of each parameter of this drive's
+// LUKS header that differs from d.LUKSProfile.
+func (d *Drive) LUKSHeaderMismatches() []string {
+	if luksDevice, ok := d.Device.(*LUKSDevice); ok {
+		return luksDevice.LUKSHeaderMismatches()
+	}
+	return nil
+}
+
+// MissingMountOptions returns those of d.MountOptions that are not active on
+// the mount of this drive, even after an attempt to remount it.
+func (d *Drive) MissingMountOptions() []string {
+	if r, ok := d.Device.(mountOptionReporter); ok {
+		return r.MissingMountOptions()
+	}
+	return nil
+}
+
 // MountPath returns the path where this drive is supposed to be mounted.
 func (d *Drive) MountPath() string {
 	path := d.Assignment.MountPath()
@@ -90,13 +117,14 @@ func (d *Drive) MountPath() string {
 // any existing mappings or mounts will be teared down.
 func (d *Drive) Converge(osi os.Interface) {
 	if d.Broken {
-		d.Device.Teardown(d, osi)
+		d.Teardown(osi)
 		return
 	}
 
-	ok := d.Device.Setup(d, osi)
-	if !ok {
-		d.MarkAsBroken(osi)
+	err := d.Device.Setup(d, osi)
+	if err != nil {
+		logg.Error(err.Error())
+		d.MarkAsBroken(osi, err.Error())
 		d.Device.Teardown(d, osi)
 		return
 	}
@@ -125,15 +153,22 @@ func (d *Drive) DurableBrokenFlagPath() string {
 	return "/var/lib/swift-storage/broken/" + d.DriveID
 }
 
-// MarkAsBroken sets the d.Broken flag.
-func (d *Drive) MarkAsBroken(osi os.Interface) {
+// MarkAsBroken sets the d.Broken flag. The reason is reported in
+// d.BrokenReason.
+func (d *Drive) MarkAsBroken(osi os.Interface, reason string) {
 	d.Broken = true
+	d.BrokenReason = reason
+	// the drive is not merely suspect anymore
+	d.KernelLogErrors = nil
+	d.SMARTSuspectReason = ""
 	logg.Info("flagging %s as broken because of previous error", d.DevicePath)
 
 	flagPath := d.TransientBrokenFlagPath()
-	_, ok := command.Run("ln", "-sfT", d.DevicePath, flagPath)
-	if ok {
+	err := osi.CreateSymlink(flagPath, d.DevicePath)
+	if err == nil {
 		logg.Info("To reinstate this drive into the cluster, delete the symlink at " + flagPath)
+	} else {
+		logg.Error(err.Error())
 	}
 
 	// reset assignment (and thus require a re-reading of the swift-id file after the
@@ -141,6 +176,64 @@ func (d *Drive) MarkAsBroken(osi os.Interface) {
 	d.Assignment = nil
 }
 
+// DriveState summarizes the state of a drive for the purpose of status
+// reports and metrics.
+type DriveState string
+
+const (
+	// DriveMounted is the state of drives that are mounted below /srv/node.
+	DriveMounted DriveState = "mounted"
+	// DriveSpare is the state of drives that have the swift-id "spare".
+	DriveSpare DriveState = "spare"
+	// DriveBroken is the state of drives that are marked as broken.
+	DriveBroken DriveState = "broken"
+	// DriveSuspect is the state of drives that have recently encountered kernel
+	// log errors (but not enough to be marked as broken), or whose SMART health
+	// indicators are concerning.
+	DriveSuspect DriveState = "suspect"
+	// DriveUnassigned is the state of drives that do not have a swift-id (yet).
+	DriveUnassigned DriveState = "unassigned"
+	// DriveDuplicate is the state of drives whose swift-id is also assigned to
+	// another drive.
+	DriveDuplicate DriveState = "duplicate"
+	// DriveMismatch is the state of drives whose swift-id differs from their
+	// mountpoint below /srv/node.
+	DriveMismatch DriveState = "mismatch"
+	// DrivePending is the state of drives that cannot be set up yet because the
+	// encryption keys could not be obtained. Drive.State() never returns it,
+	// since such drives do not have a Drive instance yet.
+	DrivePending DriveState = "pending"
+)
+
+// AllDriveStates lists all possible values of type DriveState.
+var AllDriveStates = []DriveState{DriveMounted, DriveSpare, DriveBroken, DriveSuspect, DriveUnassigned, DriveDuplicate, DriveMismatch, DrivePending}
+
+// State returns the DriveState of this drive.
+func (d *Drive) State() DriveState {
+	switch {
+	case d.Broken:
+		return DriveBroken
+	case len(d.KernelLogErrors) > 0 || d.SMARTSuspectReason != "":
+		return DriveSuspect
+	case d.Assignment == nil:
+		return DriveUnassigned
+	}
+
+	switch d.Assignment.Error {
+	case "":
+		if d.Assignment.SwiftID == "spare" {
+			return DriveSpare
+		}
+		return DriveMounted
+	case AssignmentDuplicate:
+		return DriveDuplicate
+	case AssignmentMismatch:
+		return DriveMismatch
+	default:
+		return DriveUnassigned
+	}
+}
+
 // EligibleForAutoAssignment returns true if the drive does not have a swift-id
 // yet, but is eligible for having one auto-assigned.
 func (d *Drive) EligibleForAutoAssignment() bool {
@@ -0,0 +1,636 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func expectMountPoints(t *testing.T, osi os.Interface, devicePath string, mountPaths ...string) {
+	t.Helper()
+	for _, scope := range []os.MountScope{os.HostScope, os.LocalScope} {
+		var actual []string
+		for _, m := range osi.GetMountPointsOf(devicePath, scope) {
+			actual = append(actual, m.MountPath)
+		}
+		if len(actual) != len(mountPaths) {
+			t.Errorf("expected %s to be mounted at %v in %s mount namespace, but is mounted at %v", devicePath, mountPaths, scope, actual)
+			continue
+		}
+		for idx, mountPath := range mountPaths {
+			if actual[idx] != mountPath {
+				t.Errorf("expected %s to be mounted at %v in %s mount namespace, but is mounted at %v", devicePath, mountPaths, scope, actual)
+				break
+			}
+		}
+	}
+}
+
+func expectSymlink(t *testing.T, osi os.Interface, path, expectedTarget string) {
+	t.Helper()
+	target, err := osi.ReadSymlink(path)
+	if err != nil {
+		t.Errorf("expected symlink at %s, but got error: %s", path, err.Error())
+	} else if target != expectedTarget {
+		t.Errorf("expected symlink at %s to point to %s, but points to %s", path, expectedTarget, target)
+	}
+}
+
+func TestConvergeFreshDrive(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeFilesystem {
+		t.Error("expected drive to be formatted")
+	}
+	expectMountPoints(t, osi, "/dev/sda", "/run/swift-storage/SERIAL1")
+	if d.MountedPath() != "/run/swift-storage/SERIAL1" {
+		t.Errorf("expected MountedPath() = %q, got %q", "/run/swift-storage/SERIAL1", d.MountedPath())
+	}
+}
+
+func TestConvergeFreshDriveWithLUKS(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "newkey"}, {Secret: "oldkey"}}}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeLUKS {
+		t.Error("expected drive to contain a LUKS container")
+	}
+	if mapped := osi.GetLUKSMappingOf("/dev/sda"); mapped != "/dev/mapper/SERIAL1" {
+		t.Errorf("expected LUKS container to be opened as /dev/mapper/SERIAL1, but got %q", mapped)
+	}
+	expectMountPoints(t, osi, "/dev/sda")
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1", "/run/swift-storage/SERIAL1")
+
+	// Teardown shall unmount and close everything
+	d.Teardown(osi)
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1")
+	if mapped := osi.GetLUKSMappingOf("/dev/sda"); mapped != "" {
+		t.Errorf("expected LUKS container to be closed, but is still opened as %q", mapped)
+	}
+}
+
+func TestConvergeExistingLUKSWithOldKey(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"oldkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "newkey"}, {Secret: "oldkey"}}}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1", "/run/swift-storage/SERIAL1")
+}
+
+func TestConvergeWithWrongKeys(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"retiredkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem},
+	})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "newkey"}}}, osi)
+	d.Converge(osi)
+
+	if !d.Broken {
+		t.Error("expected drive to be broken")
+	}
+	expectSymlink(t, osi, "/run/swift-storage/broken/SERIAL1", "/dev/sda")
+}
+
+func TestConvergeDoesNotFormatForeignDevice(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeForeign, Filesystem: "lvm2"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{
+		SerialNumber: "SERIAL2",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"key"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeForeign, Filesystem: "mdraid"},
+	})
+
+	expectedReasons := map[string]string{
+		"/dev/sda": "refusing to format /dev/sda because it already contains lvm2",
+		"/dev/sdb": "refusing to format /dev/mapper/SERIAL2 because it already contains mdraid",
+	}
+	for idx, devicePath := range []string{"/dev/sda", "/dev/sdb"} {
+		d := NewDrive(devicePath, fmt.Sprintf("SERIAL%d", idx+1), DriveOptions{Keys: []Key{{Secret: "key"}}}, osi)
+		d.Converge(osi)
+		if !d.Broken || d.BrokenReason != expectedReasons[devicePath] {
+			t.Errorf("expected %s to be broken with reason %q, but got broken = %t, reason = %q",
+				devicePath, expectedReasons[devicePath], d.Broken, d.BrokenReason)
+		}
+	}
+	if deviceType, signature := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeForeign || signature != "lvm2" {
+		t.Errorf("expected /dev/sda to not be formatted, but got %v/%q", deviceType, signature)
+	}
+	expectMountPoints(t, osi, "/dev/sda")
+	if mapped := osi.GetLUKSMappingOf("/dev/sdb"); mapped != "" {
+		t.Errorf("expected LUKS container to be closed, but is still opened as %q", mapped)
+	}
+}
+
+func TestConvergeWithFormatFailure(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.InjectFailure(os.FakeFormat, "/dev/sda")
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi)
+	d.Converge(osi)
+
+	if !d.Broken {
+		t.Error("expected drive to be broken")
+	}
+	expectSymlink(t, osi, "/run/swift-storage/broken/SERIAL1", "/dev/sda")
+	expectMountPoints(t, osi, "/dev/sda")
+}
+
+func TestConvergeUnreadableDrive(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeUnreadable})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi)
+	if !d.Broken {
+		t.Error("expected unreadable drive to be broken")
+	}
+	d.Teardown(osi) // must not crash on nil Device
+}
+
+func TestNewDriveWithExistingBrokenFlag(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	err := osi.CreateSymlink("/var/lib/swift-storage/broken/SERIAL1", "/dev/sda")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi)
+	if !d.Broken {
+		t.Error("expected drive with durable broken flag to be broken")
+	}
+	d.Converge(osi)
+	if deviceType, _ := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeUnknown {
+		t.Error("expected broken drive to not be formatted")
+	}
+}
+
+func TestConvergeDetectsReadOnlyMount(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeFilesystem, SwiftID: "swift1"})
+
+	drives := []*Drive{NewDrive("/dev/sda", "SERIAL1", DriveOptions{}, osi)}
+	drives[0].Converge(osi)
+	UpdateDriveAssignments(drives, nil, osi)
+	drives[0].Converge(osi)
+	expectMountPoints(t, osi, "/dev/sda", "/srv/node/swift1")
+
+	osi.RemountReadOnly("/srv/node/swift1")
+	drives[0].Converge(osi)
+
+	if !drives[0].Broken {
+		t.Error("expected drive with read-only mount to be broken")
+	}
+	expectMountPoints(t, osi, "/dev/sda")
+	expectSymlink(t, osi, "/run/swift-storage/state/unmount-propagation/swift1", "/dev/sda")
+}
+
+func TestConvergeFreshDriveWithExt4(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Filesystem: os.FilesystemExt4}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if deviceType, fsType := osi.ClassifyDevice("/dev/sda"); deviceType != os.DeviceTypeFilesystem || fsType != os.FilesystemExt4 {
+		t.Errorf("expected drive to be formatted with ext4, but got %v/%q", deviceType, fsType)
+	}
+	if d.Device.Type() != "ext4" {
+		t.Errorf("expected device type ext4, but got %q", d.Device.Type())
+	}
+	expectMountPoints(t, osi, "/dev/sda", "/run/swift-storage/SERIAL1")
+	expectMountOptions(t, osi, "/run/swift-storage/SERIAL1", "errors=remount-ro")
+}
+
+func TestConvergeWithExt4OverridesDefaultMountOptions(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+
+	opts := DriveOptions{Filesystem: os.FilesystemExt4, MountOptions: []string{"errors=panic"}}
+	d := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	for _, m := range osi.GetMountPointsOf("/dev/sda", os.HostScope) {
+		if m.Options["errors=remount-ro"] {
+			t.Errorf("expected default mount option errors=remount-ro to be overridden, but got %v", m.Options)
+		}
+	}
+	expectMountOptions(t, osi, "/run/swift-storage/SERIAL1", "errors=panic")
+}
+
+func TestConvergeLUKSWithExt4(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "key"}}, Filesystem: os.FilesystemExt4}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if _, fsType := osi.ClassifyDevice("/dev/mapper/SERIAL1"); fsType != os.FilesystemExt4 {
+		t.Errorf("expected LUKS container to contain ext4, but got %q", fsType)
+	}
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1", "/run/swift-storage/SERIAL1")
+}
+
+func TestConvergeRefusesMismatchingFilesystem(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeFilesystem, Filesystem: os.FilesystemXFS})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2", Type: os.DeviceTypeFilesystem, Filesystem: "ext3"})
+
+	for _, devicePath := range []string{"/dev/sda", "/dev/sdb"} {
+		d := NewDrive(devicePath, "SERIAL", DriveOptions{Filesystem: os.FilesystemExt4}, osi)
+		d.Converge(osi)
+
+		if !d.Broken {
+			t.Errorf("expected %s with mismatching filesystem to be broken", devicePath)
+		}
+		expectMountPoints(t, osi, devicePath)
+	}
+}
+
+func expectMountOptions(t *testing.T, osi os.Interface, mountPath string, options ...string) {
+	t.Helper()
+	for _, scope := range []os.MountScope{os.HostScope, os.LocalScope} {
+		for _, m := range osi.GetMountPointsIn(filepath.Dir(mountPath), scope) {
+			if m.MountPath == mountPath {
+				if missing := m.MissingOptions(options); len(missing) > 0 {
+					t.Errorf("expected mount at %s in %s mount namespace to have options %v, but is missing %v", mountPath, scope, options, missing)
+				}
+			}
+		}
+	}
+}
+
+func TestConvergeWithFormatAndMountOptions(t *testing.T) {
+	osi := os.NewFake()
+	dev := &os.FakeDevice{SerialNumber: "SERIAL1"}
+	osi.AddDrive("/dev/sda", dev)
+
+	opts := DriveOptions{
+		FormatOptions: []string{"-i", "size=1024"},
+		MountOptions:  []string{"noatime", "logbufs=8"},
+	}
+	d := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	expectedCommand := []string{"mkfs.xfs", "-f", "-i", "size=1024"}
+	if !slices.Equal(dev.FormatCommand, expectedCommand) {
+		t.Errorf("expected mkfs command %v, but got %v", expectedCommand, dev.FormatCommand)
+	}
+	expectMountPoints(t, osi, "/dev/sda", "/run/swift-storage/SERIAL1")
+	expectMountOptions(t, osi, "/run/swift-storage/SERIAL1", "noatime", "logbufs=8")
+}
+
+func TestConvergeRemountsWithMissingOptions(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1", Type: os.DeviceTypeFilesystem})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2", Type: os.DeviceTypeFilesystem})
+	for _, scope := range []os.MountScope{os.HostScope, os.LocalScope} {
+		err := osi.MountDevice("/dev/sda", "/srv/node/swift1", nil, scope)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		err = osi.MountDevice("/dev/sdb", "/srv/node/swift2", nil, scope)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	osi.InjectFailure(os.FakeRemount, "/srv/node/swift2")
+
+	opts := DriveOptions{MountOptions: []string{"noatime"}}
+	drives := []*Drive{
+		NewDrive("/dev/sda", "SERIAL1", opts, osi),
+		NewDrive("/dev/sdb", "SERIAL2", opts, osi),
+	}
+	for _, d := range drives {
+		d.Converge(osi)
+		d.Converge(osi)
+		if d.Broken {
+			t.Errorf("expected %s to not be broken", d.DevicePath)
+		}
+	}
+
+	// the successful remount fixes the drift...
+	expectMountOptions(t, osi, "/srv/node/swift1", "noatime")
+	if missing := drives[0].MissingMountOptions(); len(missing) > 0 {
+		t.Errorf("expected no missing mount options on /dev/sda, but got %v", missing)
+	}
+	// ...but the failed remount leaves the drift in place, and is reported
+	if missing := drives[1].MissingMountOptions(); !slices.Equal(missing, []string{"noatime"}) {
+		t.Errorf("expected missing mount options [noatime] on /dev/sdb, but got %v", missing)
+	}
+}
+
+func TestConvergeFreshDrivesWithDerivedKeys(t *testing.T) {
+	osi := os.NewFake()
+	devices := map[string]*os.FakeDevice{
+		"/dev/sda": {SerialNumber: "SERIAL1"},
+		"/dev/sdb": {SerialNumber: "SERIAL2"},
+		"/dev/sdc": {SerialNumber: ""},
+	}
+	for devicePath, dev := range devices {
+		osi.AddDrive(devicePath, dev)
+	}
+
+	opts := DriveOptions{Keys: []Key{{Secret: "master", Method: KeyDerivationHKDFSHA256}}}
+	for devicePath, dev := range devices {
+		d := NewDrive(devicePath, dev.SerialNumber, opts, osi)
+		d.Converge(osi)
+		if d.Broken {
+			t.Fatalf("expected %s to not be broken", devicePath)
+		}
+
+		// the container can be opened again by a fresh Drive instance
+		d.Teardown(osi)
+		d = NewDrive(devicePath, dev.SerialNumber, opts, osi)
+		d.Converge(osi)
+		if d.Broken {
+			t.Errorf("expected %s to not be broken after reopening", devicePath)
+		}
+	}
+
+	// each drive with a serial number has its own passphrase, which is not the
+	// master secret
+	if devices["/dev/sda"].LUKSKeys[0] == "master" || devices["/dev/sda"].LUKSKeys[0] == devices["/dev/sdb"].LUKSKeys[0] {
+		t.Errorf("expected unique derived passphrases, but got %q and %q", devices["/dev/sda"].LUKSKeys[0], devices["/dev/sdb"].LUKSKeys[0])
+	}
+	// without a serial number, the master secret is used as a fallback
+	if devices["/dev/sdc"].LUKSKeys[0] != "master" {
+		t.Errorf("expected passphrase %q for drive without serial number, but got %q", "master", devices["/dev/sdc"].LUKSKeys[0])
+	}
+}
+
+func TestConvergeExistingLUKSWithUnderivedKey(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"master"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	})
+
+	opts := DriveOptions{Keys: []Key{{Secret: "master", Method: KeyDerivationHKDFSHA256}}}
+	d := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1", "/run/swift-storage/SERIAL1")
+}
+
+func TestConvergeEnrollsPrimaryLUKSKey(t *testing.T) {
+	osi := os.NewFake()
+	dev := &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"oldkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	}
+	osi.AddDrive("/dev/sda", dev)
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "newkey"}, {Secret: "oldkey"}}}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if !slices.Equal(dev.LUKSKeys, []string{"oldkey", "newkey"}) {
+		t.Errorf("expected key slots %q, but got %q", []string{"oldkey", "newkey"}, dev.LUKSKeys)
+	}
+	if idx := d.LUKSKeyIndex(); idx != 0 {
+		t.Errorf("expected LUKS key index 0, but got %d", idx)
+	}
+
+	// a failure to add the key is not fatal
+	osi = os.NewFake()
+	dev = &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"oldkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	}
+	osi.AddDrive("/dev/sda", dev)
+	osi.InjectFailure(os.FakeAddLUKSKey, "/dev/sda")
+
+	d = NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "newkey"}, {Secret: "oldkey"}}}, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	if !slices.Equal(dev.LUKSKeys, []string{"oldkey"}) {
+		t.Errorf("expected key slots %q, but got %q", []string{"oldkey"}, dev.LUKSKeys)
+	}
+	if idx := d.LUKSKeyIndex(); idx != 1 {
+		t.Errorf("expected LUKS key index 1, but got %d", idx)
+	}
+	expectMountPoints(t, osi, "/dev/mapper/SERIAL1", "/run/swift-storage/SERIAL1")
+}
+
+func TestConvergeRemovesRetiredLUKSKeys(t *testing.T) {
+	osi := os.NewFake()
+	dev := &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"retiredkey", "oldkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	}
+	osi.AddDrive("/dev/sda", dev)
+
+	opts := DriveOptions{
+		Keys:                  []Key{{Secret: "newkey"}, {Secret: "oldkey"}},
+		RemoveRetiredLUKSKeys: true,
+	}
+	d := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	// the retired key is removed, but the old key is kept since it is still configured
+	expected := []string{"", "oldkey", "newkey"}
+	if !slices.Equal(dev.LUKSKeys, expected) {
+		t.Errorf("expected key slots %q, but got %q", expected, dev.LUKSKeys)
+	}
+}
+
+func TestDriveIDFallback(t *testing.T) {
+	osi := os.NewFake()
+	osi.AddDrive("/dev/sda", &os.FakeDevice{})
+
+	// this value must not change since it is used for LUKS mappings, mount paths
+	// and broken flags of drives without a (usable) serial number
+	d := NewDrive("/dev/sda", "", DriveOptions{}, osi)
+	if d.DriveID != "eaea9081eee6950af5661cdcfc71c523" {
+		t.Errorf("expected fallback DriveID for /dev/sda to be the MD5 hash of the device path, but got %q", d.DriveID)
+	}
+}
+
+func TestConvergeRemovesUnderivedLUKSKey(t *testing.T) {
+	osi := os.NewFake()
+	dev := &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"master"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	}
+	osi.AddDrive("/dev/sda", dev)
+
+	key := Key{Secret: "master", Method: KeyDerivationHKDFSHA256}
+	opts := DriveOptions{Keys: []Key{key}, RemoveRetiredLUKSKeys: true}
+	d := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d.Converge(osi)
+
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+	// once the derived passphrase is enrolled, the secret itself is retired
+	derived, _ := key.passphraseFor("SERIAL1")
+	expected := []string{"", derived}
+	if !slices.Equal(dev.LUKSKeys, expected) {
+		t.Errorf("expected key slots %q, but got %q", expected, dev.LUKSKeys)
+	}
+}
+
+func TestConvergeRotatesLUKSKeysWhenKeysChange(t *testing.T) {
+	osi := os.NewFake()
+	dev := &os.FakeDevice{
+		SerialNumber: "SERIAL1",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"oldkey"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift1"},
+	}
+	osi.AddDrive("/dev/sda", dev)
+
+	d := NewDrive("/dev/sda", "SERIAL1", DriveOptions{Keys: []Key{{Secret: "oldkey"}}}, osi)
+	d.Converge(osi)
+	if d.Broken {
+		t.Fatal("expected drive to not be broken")
+	}
+
+	// when a new key is configured at runtime (i.e. by reloading the
+	// configuration), it is enrolled into the container that is already open
+	d.DriveOptions = DriveOptions{Keys: []Key{{Secret: "newkey"}, {Secret: "oldkey"}}}
+	d.Converge(osi)
+	if !slices.Equal(dev.LUKSKeys, []string{"oldkey", "newkey"}) {
+		t.Errorf("expected key slots %q, but got %q", []string{"oldkey", "newkey"}, dev.LUKSKeys)
+	}
+	if idx := d.LUKSKeyIndex(); idx != 0 {
+		t.Errorf("expected LUKS key index 0, but got %d", idx)
+	}
+
+	// when the old key is removed from the configuration and
+	// RemoveRetiredLUKSKeys is enabled, its key slot is removed
+	d.DriveOptions = DriveOptions{Keys: []Key{{Secret: "newkey"}}, RemoveRetiredLUKSKeys: true}
+	d.Converge(osi)
+	if !slices.Equal(dev.LUKSKeys, []string{"", "newkey"}) {
+		t.Errorf("expected key slots %q, but got %q", []string{"", "newkey"}, dev.LUKSKeys)
+	}
+	if d.Broken {
+		t.Errorf("expected drive to not be broken, but: %s", d.BrokenReason)
+	}
+}
+
+func TestConvergeWithLUKSProfile(t *testing.T) {
+	osi := os.NewFake()
+	fresh := &os.FakeDevice{SerialNumber: "SERIAL1"}
+	osi.AddDrive("/dev/sda", fresh)
+	existing := &os.FakeDevice{
+		SerialNumber: "SERIAL2",
+		Type:         os.DeviceTypeLUKS,
+		LUKSKeys:     []string{"key"},
+		LUKSProfile:  os.LUKSProfile{Version: 1, PBKDF: "pbkdf2"},
+		LUKSContents: &os.FakeDevice{Type: os.DeviceTypeFilesystem, SwiftID: "swift2"},
+	}
+	osi.AddDrive("/dev/sdb", existing)
+
+	profile := os.LUKSProfile{
+		Version:         2,
+		SectorSize:      4096,
+		PBKDF:           "pbkdf2",
+		PBKDFIterations: 1000,
+		AllowDiscards:   true,
+	}
+	opts := DriveOptions{Keys: []Key{{Secret: "key"}}, LUKSProfile: profile}
+
+	// new containers are created with the profile and match it
+	d1 := NewDrive("/dev/sda", "SERIAL1", opts, osi)
+	d1.Converge(osi)
+	if d1.Broken {
+		t.Fatal("expected /dev/sda to not be broken")
+	}
+	if fresh.LUKSProfile != profile || fresh.LUKSOpenProfile != profile {
+		t.Errorf("expected LUKS container on /dev/sda to be created and opened with %#v, but got %#v and %#v",
+			profile, fresh.LUKSProfile, fresh.LUKSOpenProfile)
+	}
+	if mismatches := d1.LUKSHeaderMismatches(); len(mismatches) > 0 {
+		t.Errorf("expected no LUKS header mismatches on /dev/sda, but got %q", mismatches)
+	}
+
+	// existing containers are opened with the profile, but not changed
+	d2 := NewDrive("/dev/sdb", "SERIAL2", opts, osi)
+	d2.Converge(osi)
+	if d2.Broken {
+		t.Fatal("expected /dev/sdb to not be broken")
+	}
+	if !existing.LUKSOpenProfile.AllowDiscards {
+		t.Error("expected LUKS container on /dev/sdb to be opened with --allow-discards")
+	}
+	expected := []string{"version is 1 (expected 2)", "sector size is 512 bytes (expected 4096 bytes)"}
+	if mismatches := d2.LUKSHeaderMismatches(); !slices.Equal(mismatches, expected) {
+		t.Errorf("expected LUKS header mismatches %q on /dev/sdb, but got %q", expected, mismatches)
+	}
+
+	// the header is checked again when the profile changes
+	d2.DriveOptions.LUKSProfile = os.LUKSProfile{Version: 1}
+	d2.Converge(osi)
+	if mismatches := d2.LUKSHeaderMismatches(); len(mismatches) > 0 {
+		t.Errorf("expected no LUKS header mismatches on /dev/sdb after profile change, but got %q", mismatches)
+	}
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// ErrorPolicy describes how many kernel log errors of a certain class a drive
+// may encounter before it is marked as broken.
+type ErrorPolicy struct {
+	// Name identifies this class of errors in logs, metrics and status reports.
+	Name string
+	// Pattern selects the kernel log lines that this policy applies to. If nil,
+	// the policy applies to all lines.
+	Pattern *regexp.Regexp
+	// The drive is marked as broken once Threshold errors of this class have
+	// been seen within Interval. Until then, the drive is suspect.
+	Threshold int
+	Interval  time.Duration
+}
+
+// DefaultErrorPolicy applies to kernel log errors that do not match any of
+// the configured error policies: The drive is marked as broken immediately.
+var DefaultErrorPolicy = ErrorPolicy{Name: "default", Threshold: 1}
+
+// findErrorPolicy returns the first policy in d.ErrorPolicies that applies to
+// the given kernel log line.
+func (d *Drive) findErrorPolicy(logLine string) ErrorPolicy {
+	for _, policy := range d.ErrorPolicies {
+		if policy.Pattern == nil || policy.Pattern.MatchString(logLine) {
+			return policy
+		}
+	}
+	return DefaultErrorPolicy
+}
+
+// KernelLogError is a kernel log error that was seen on a drive, but has not
+// caused the drive to be marked as broken (yet).
+type KernelLogError struct {
+	Policy  ErrorPolicy
+	LogLine string
+	Time    time.Time
+}
+
+// kernelLogPrefixRx matches the timestamp prefix that some kernel log readers
+// put in front of each message: "Oct 16 12:34:56 hostname kernel: " (from
+// `journalctl -k`, also with ISO timestamps) or "[  123.456789] " (from dmesg).
+var kernelLogPrefixRx = regexp.MustCompile(`^(?:(?:[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) \S+ kernel: |\[\s*\d+\.\d+\] )`)
+
+// Returns the message of the given kernel log line without its timestamp
+// prefix, so that repeated messages can be recognized as such.
+func kernelLogMessage(logLine string) string {
+	return kernelLogPrefixRx.ReplaceAllString(logLine, "")
+}
+
+// HandleKernelLogError is called when a kernel log error is seen on this
+// drive. The drive is marked as broken once the threshold of the applicable
+// error policy is reached. Identical messages are only counted once within
+// the policy's interval, since the kernel tends to report the same failed I/O
+// multiple times.
+func (d *Drive) HandleKernelLogError(osi os.Interface, logLine string, now time.Time) {
+	if d.Broken {
+		return
+	}
+	d.ExpireKernelLogErrors(now)
+
+	policy := d.findErrorPolicy(logLine)
+	message := kernelLogMessage(logLine)
+	count := 0
+	for _, e := range d.KernelLogErrors {
+		if e.Policy.Name != policy.Name {
+			continue
+		}
+		if kernelLogMessage(e.LogLine) == message {
+			logg.Info("ignoring duplicate kernel log error for %s", d.DevicePath)
+			return
+		}
+		count++
+	}
+	count++ // for this error
+
+	if count >= policy.Threshold {
+		reason := "potential device error seen in kernel log: " + logLine
+		if policy.Threshold > 1 {
+			reason = fmt.Sprintf("%d errors of class %q seen in kernel log within %s, last one: %s",
+				count, policy.Name, policy.Interval, logLine)
+		}
+		d.MarkAsBroken(osi, reason)
+		return
+	}
+
+	d.KernelLogErrors = append(d.KernelLogErrors, KernelLogError{
+		Policy:  policy,
+		LogLine: logLine,
+		Time:    now,
+	})
+	logg.Info("%s is suspect after %d of %d errors of class %q within %s",
+		d.DevicePath, count, policy.Threshold, policy.Name, policy.Interval)
+}
+
+// ExpireKernelLogErrors forgets about those d.KernelLogErrors that have left
+// the interval of their error policy.
+func (d *Drive) ExpireKernelLogErrors(now time.Time) {
+	d.KernelLogErrors = slices.DeleteFunc(d.KernelLogErrors, func(e KernelLogError) bool {
+		return !now.Before(e.Time.Add(e.Policy.Interval))
+	})
+}
+
+// KernelLogErrorCounts returns the number of d.KernelLogErrors for each error
+// policy name.
+func (d *Drive) KernelLogErrorCounts() map[string]int {
+	result := make(map[string]int)
+	for _, e := range d.KernelLogErrors {
+		result[e.Policy.Name]++
+	}
+	return result
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+// ext4Filesystem implements the filesystem interface for ext4.
+type ext4Filesystem struct{}
+
+// formatCommand implements the filesystem interface.
+func (ext4Filesystem) formatCommand(options []string) []string {
+	// `-F` is required because mkfs.ext4 asks for confirmation when the
+	// device is not a partition; `-m 0` disables the reserved blocks for
+	// root since these disks are only written by Swift
+	return append([]string{"mkfs.ext4", "-F", "-m", "0"}, options...)
+}
+
+// checkCommand implements the filesystem interface.
+func (ext4Filesystem) checkCommand() []string {
+	// `-f` is required because e2fsck skips filesystems that are marked clean
+	return []string{"e2fsck", "-f", "-n"}
+}
+
+// defaultMountOptions implements the filesystem interface.
+func (ext4Filesystem) defaultMountOptions() []string {
+	// the default behavior on errors (as recorded in the superblock by mkfs) is
+	// usually to continue, but we want the filesystem to go read-only, so that
+	// Validate() notices the problem and the drive gets marked as broken
+	return []string{"errors=remount-ro"}
+}
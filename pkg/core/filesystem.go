@@ -0,0 +1,316 @@
+// SPDX-FileCopyrightText: 2018 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// filesystem contains the parts of the Device implementation that differ
+// between the supported filesystem types.
+type filesystem interface {
+	// formatCommand returns the mkfs command line (without the device path) for
+	// creating this filesystem with the given additional options.
+	formatCommand(options []string) []string
+	// checkCommand returns the command line (without the device path) for a
+	// read-only check of this filesystem.
+	checkCommand() []string
+	// defaultMountOptions returns the mount options that are used for this
+	// filesystem in addition to drive.MountOptions.
+	defaultMountOptions() []string
+}
+
+// Returns nil for filesystem types that are not supported by the autopilot.
+func filesystemFor(fsType os.FilesystemType) filesystem {
+	switch fsType {
+	case os.FilesystemXFS:
+		return xfsFilesystem{}
+	case os.FilesystemExt4:
+		return ext4Filesystem{}
+	default:
+		return nil
+	}
+}
+
+// filesystemDevice is a device containing a filesystem (or one that will be
+// formatted with a filesystem). The behavior that is specific to a filesystem
+// type is provided by the filesystem interface.
+//
+// When a device contains a filesystem that is not supported by the autopilot,
+// its Setup() will always fail since the filesystem type does not match the
+// configured one.
+type filesystemDevice struct {
+	path      string
+	fsType    os.FilesystemType // as found on the device, or to be created if !formatted
+	formatted bool
+	// whether the filesystem was created by us (and thus does not need to be
+	// checked before mounting it)
+	fresh bool
+
+	// internal state
+	mountPath string
+	// remounts (as "<scope>:<path>:<options>") that we already tried in order to
+	// apply drive.MountOptions (we only try each remount once: if the kernel
+	// does not report an option in the same way as it was given to us, we would
+	// otherwise remount on every single event loop iteration)
+	remounted map[string]bool
+	// mount options from drive.MountOptions that are still missing after
+	// remounting (as of the last Validate)
+	missingMountOptions []string
+}
+
+// Returns nil to indicate unreadable device.
+func newFilesystemDevice(devicePath string, fsType os.FilesystemType, formatted bool) Device {
+	return &filesystemDevice{path: devicePath, fsType: fsType, formatted: formatted}
+}
+
+// DevicePath implements the Device interface.
+func (d *filesystemDevice) DevicePath() string {
+	return d.path
+}
+
+// MountedPath implements the Device interface.
+func (d *filesystemDevice) MountedPath() string {
+	return d.mountPath
+}
+
+// Type implements the Device interface.
+func (d *filesystemDevice) Type() string {
+	return string(d.fsType)
+}
+
+// Setup implements the Device interface.
+func (d *filesystemDevice) Setup(drive *Drive, osi os.Interface) error {
+	// sanity check (and recognize pre-existing mount before attempting our own)
+	err := d.Validate(drive, osi)
+	if err != nil {
+		return err
+	}
+
+	// the filesystem that we create or mount is always the configured one (a
+	// mismatching existing filesystem is rejected below)
+	fs := filesystemFor(drive.FilesystemType())
+	if fs == nil {
+		return fmt.Errorf("cannot set up %s: unsupported filesystem type %q", d.path, drive.FilesystemType())
+	}
+
+	// format on first use (with the filesystem type from the current
+	// configuration, which may have changed since this device was created)
+	if !d.formatted {
+		d.fsType = drive.FilesystemType()
+		// double-check that disk is empty
+		if deviceType, _ := osi.ClassifyDevice(d.path); deviceType != os.DeviceTypeUnknown {
+			return fmt.Errorf("Setup called on %s to create %s filesystem, but is not empty", d.path, d.fsType)
+		}
+
+		ok := osi.FormatDevice(d.path, d.fsType, fs.formatCommand(drive.FormatOptions))
+		if !ok {
+			return fmt.Errorf("could not create %s filesystem on %s", d.fsType, d.path)
+		}
+		d.formatted = true
+		d.fresh = true
+		logg.Debug("%s filesystem created on %s", d.fsType, d.path)
+	}
+
+	// refuse to mount a filesystem other than the configured one (if the type
+	// cannot be determined, we have to trust that it is the right one); this is
+	// only checked before a new mount, so that existing mounts are not torn down
+	// when the configured filesystem is changed at runtime
+	if d.mountPath == "" && d.fsType != "" && d.fsType != drive.FilesystemType() {
+		return fmt.Errorf("found %s filesystem on %s, but the configured filesystem is %s (refusing to mount it)",
+			d.fsType, d.path, drive.FilesystemType())
+	}
+
+	// check an existing filesystem before mounting it for the first time (the
+	// Validate() call above has discovered existing mounts already, so if we
+	// do not know of any mount, the device is not mounted)
+	if drive.FsckBeforeMount && d.mountPath == "" && !d.fresh {
+		fsType := drive.FilesystemType()
+		logg.Info("checking %s filesystem on %s before mounting it", fsType, d.path)
+		if !osi.CheckFilesystem(d.path, fsType, fs.checkCommand()) {
+			return fmt.Errorf("%s filesystem on %s did not pass the filesystem check (see previous log messages for details), refusing to mount it",
+				fsType, d.path)
+		}
+	}
+
+	// determine desired mount path
+	mountPath := drive.MountPath()
+
+	// tear down all mounts not matching the desired mount path (esp. the
+	// temporary mount in /run when moving to the final mount in /srv/node)
+	err = os.ForeachMountScopeOrError(func(scope os.MountScope) error {
+		for _, m := range osi.GetMountPointsOf(d.path, scope) {
+			if m.MountPath != mountPath {
+				err := osi.UnmountDevice(m.MountPath, scope)
+				if err != nil {
+					return fmt.Errorf("could not unmount %s: %w", d.path, err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if d.mountPath != mountPath {
+		d.mountPath = ""
+	}
+
+	// perform the mount
+	mountOptions := mergeMountOptions(fs.defaultMountOptions(), drive.MountOptions)
+	err = os.ForeachMountScopeOrError(func(scope os.MountScope) error {
+		return osi.MountDevice(d.path, mountPath, mountOptions, scope)
+	})
+	if err != nil {
+		return err
+	}
+	d.mountPath = mountPath
+
+	// clear unmount-propagation flag if necessary
+	if filepath.Dir(mountPath) == "/srv/node" {
+		err := osi.RemoveFile(filepath.Join(
+			"/run/swift-storage/state/unmount-propagation",
+			filepath.Base(mountPath),
+		))
+		if err != nil {
+			logg.Error(err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Returns the default mount options of a filesystem, followed by the
+// configured mount options. Defaults are skipped when an option with the same
+// name is configured (e.g. "errors=panic" overrides "errors=remount-ro").
+func mergeMountOptions(defaults, configured []string) []string {
+	result := make([]string, 0, len(defaults)+len(configured))
+	for _, option := range defaults {
+		name, _, _ := strings.Cut(option, "=")
+		isOverridden := slices.ContainsFunc(configured, func(o string) bool {
+			n, _, _ := strings.Cut(o, "=")
+			return n == name
+		})
+		if !isOverridden {
+			result = append(result, option)
+		}
+	}
+	return append(result, configured...)
+}
+
+// Teardown implements the Device interface.
+func (d *filesystemDevice) Teardown(drive *Drive, osi os.Interface) bool {
+	// remove all mounts of this device
+	ok := os.ForeachMountScope(func(scope os.MountScope) bool {
+		for _, m := range osi.GetMountPointsOf(d.path, scope) {
+			if filepath.Dir(m.MountPath) == "/srv/node" {
+				err := osi.CreateSymlink("/run/swift-storage/state/unmount-propagation/"+filepath.Base(m.MountPath), drive.DevicePath)
+				if err != nil {
+					logg.Error(err.Error())
+				}
+			}
+			err := osi.UnmountDevice(m.MountPath, scope)
+			if err != nil {
+				logg.Error("could not unmount %s: %s", d.path, err.Error())
+				return false
+			}
+		}
+		return true
+	})
+
+	if ok {
+		d.mountPath = ""
+	}
+	return ok
+}
+
+// Validate implements the Device interface.
+func (d *filesystemDevice) Validate(drive *Drive, osi os.Interface) error {
+	d.missingMountOptions = nil
+	return os.ForeachMountScopeOrError(func(scope os.MountScope) error {
+		mounts := osi.GetMountPointsOf(d.path, scope)
+
+		if len(mounts) == 0 {
+			if d.mountPath == "" {
+				return nil
+			}
+
+			mountPath := d.mountPath
+			d.mountPath = ""
+			return fmt.Errorf(
+				"expected %s to be mounted at %s, but is not mounted anymore in %s mount namespace",
+				d.path, mountPath, scope,
+			)
+		}
+
+		for _, m := range mounts {
+			if m.Options["ro"] {
+				return fmt.Errorf("mount of %s at %s is read-only in %s mount namespace (could be due to a disk error)", d.path, m.MountPath, scope)
+			}
+
+			// this case is okay - the Device struct may have just been created and
+			// now we know that it is already active (and under which name)
+			if d.mountPath == "" {
+				logg.Info("discovered %s to be mounted at %s already in %s mount namespace", d.path, m.MountPath, scope)
+				d.mountPath = m.MountPath
+				continue
+			}
+
+			if m.MountPath != d.mountPath {
+				return fmt.Errorf(
+					"expected %s to be mounted at %s, but is actually mounted at %s in %s mount namespace",
+					d.path, d.mountPath, m.MountPath, scope,
+				)
+			}
+
+			d.checkMountOptions(m, drive.MountOptions, scope, osi)
+		}
+
+		return nil
+	})
+}
+
+// Remounts the given mount point if it lacks some of the configured mount
+// options. This is not an error since the filesystem is still usable, so the
+// drift is only reported through MissingMountOptions().
+func (d *filesystemDevice) checkMountOptions(m os.MountPoint, options []string, scope os.MountScope, osi os.Interface) {
+	missing := m.MissingOptions(options)
+	if len(missing) == 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", scope, m.MountPath, strings.Join(missing, ","))
+	if !d.remounted[key] {
+		if d.remounted == nil {
+			d.remounted = make(map[string]bool)
+		}
+		d.remounted[key] = true
+
+		logg.Info("mount of %s at %s is missing options %s in %s mount namespace, remounting",
+			d.path, m.MountPath, strings.Join(missing, ","), scope)
+		err := osi.RemountDevice(m.MountPath, missing, scope)
+		if err == nil {
+			return
+		}
+		logg.Error("could not remount %s with options %s: %s", d.path, strings.Join(missing, ","), err.Error())
+	}
+
+	for _, option := range missing {
+		if !slices.Contains(d.missingMountOptions, option) {
+			d.missingMountOptions = append(d.missingMountOptions, option)
+		}
+	}
+}
+
+// MissingMountOptions implements the mountOptionReporter interface.
+func (d *filesystemDevice) MissingMountOptions() []string {
+	return d.missingMountOptions
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// foreignDevice is a device that contains something other than a LUKS
+// container or a filesystem, e.g. a partition table or an LVM physical volume.
+// Since the device may contain valuable data, it is never formatted. Its
+// Setup() always fails, so the drive will be marked as broken.
+type foreignDevice struct {
+	path      string
+	signature string // as reported by os.Interface.ClassifyDevice
+}
+
+// DevicePath implements the Device interface.
+func (d *foreignDevice) DevicePath() string {
+	return d.path
+}
+
+// MountedPath implements the Device interface.
+func (d *foreignDevice) MountedPath() string {
+	return ""
+}
+
+// Setup implements the Device interface.
+func (d *foreignDevice) Setup(drive *Drive, osi os.Interface) error {
+	return fmt.Errorf("refusing to format %s because it already contains %s", d.path, d.signature)
+}
+
+// Teardown implements the Device interface.
+func (d *foreignDevice) Teardown(drive *Drive, osi os.Interface) bool {
+	return true
+}
+
+// Validate implements the Device interface.
+func (d *foreignDevice) Validate(drive *Drive, osi os.Interface) error {
+	return nil
+}
+
+// Type implements the Device interface.
+func (d *foreignDevice) Type() string {
+	return "foreign"
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+
+	"github.com/sapcc/go-bits/logg"
+)
+
+// KeyDerivationMethod describes how the LUKS passphrase for a drive is
+// derived from a configured Key.
+type KeyDerivationMethod string
+
+const (
+	// KeyDerivationNone is the default KeyDerivationMethod. The secret is used
+	// as the LUKS passphrase directly, so it is the same for all drives.
+	KeyDerivationNone KeyDerivationMethod = "none"
+	// KeyDerivationHKDFSHA256 is a KeyDerivationMethod. A unique passphrase is
+	// derived for each drive from the secret and the drive's serial number using
+	// HKDF (RFC 5869) with SHA-256.
+	KeyDerivationHKDFSHA256 KeyDerivationMethod = "hkdf-sha256"
+)
+
+// Key is a LUKS encryption key as given in the configuration.
+type Key struct {
+	Secret string
+	// If empty, KeyDerivationNone is used.
+	Method KeyDerivationMethod
+}
+
+// Returns the LUKS passphrase for the drive with the given serial number, or
+// false if no passphrase can be derived because the serial number is unknown.
+func (k Key) passphraseFor(serialNumber string) (string, bool) {
+	switch k.Method {
+	case KeyDerivationHKDFSHA256:
+		if serialNumber == "" {
+			return "", false
+		}
+		info := "swift-drive-autopilot LUKS passphrase for drive " + serialNumber
+		buf, err := hkdf.Key(sha256.New, []byte(k.Secret), nil, info, 32)
+		if err != nil {
+			// cannot happen since the key length is far below the limit
+			logg.Fatal("cannot derive LUKS passphrase: %s", err.Error())
+		}
+		// cryptsetup reads the passphrase from stdin up to the first newline, so
+		// it needs to be printable
+		return hex.EncodeToString(buf), true
+	default:
+		return k.Secret, true
+	}
+}
+
+// LUKSPassphraseForCreation returns the passphrase that shall be used when
+// creating a new LUKS container on this drive.
+func (d *Drive) LUKSPassphraseForCreation() string {
+	if _, ok := d.Keys[0].passphraseFor(d.SerialNumber); !ok {
+		// we cannot use a passphrase derived from the fallback DriveID because
+		// that is computed from the device path, which is not stable
+		logg.Error("cannot derive a LUKS passphrase for %s because its serial number is unknown, will use the secret directly instead", d.DevicePath)
+	}
+	return d.primaryLUKSPassphrase()
+}
+
+// Returns the passphrase for Keys[0], i.e. the one that all LUKS containers on
+// this drive shall accept.
+func (d *Drive) primaryLUKSPassphrase() string {
+	passphrase, ok := d.Keys[0].passphraseFor(d.SerialNumber)
+	if !ok {
+		return d.Keys[0].Secret
+	}
+	return passphrase
+}
+
+// luksPassphrase appears in the result of Drive.luksPassphrases().
+type luksPassphrase struct {
+	Value    string
+	KeyIndex int // index into Drive.Keys
+}
+
+// Returns the passphrases that shall be tried (in order) when opening an
+// existing LUKS container on this drive. For keys with a KeyDerivationMethod,
+// both the derived passphrase and the secret itself are tried, so that
+// containers that were created before the method was configured can still be
+// opened.
+func (d *Drive) luksPassphrases() []luksPassphrase {
+	var result []luksPassphrase
+	add := func(value string, keyIndex int) {
+		if !slices.ContainsFunc(result, func(p luksPassphrase) bool { return p.Value == value }) {
+			result = append(result, luksPassphrase{value, keyIndex})
+		}
+	}
+	for idx, key := range d.Keys {
+		passphrase, ok := key.passphraseFor(d.SerialNumber)
+		if ok {
+			add(passphrase, idx)
+		}
+		add(key.Secret, idx)
+	}
+	return result
+}
+
+// Returns the passphrases that key slots of existing LUKS containers on this
+// drive may use without being considered retired. Unlike luksPassphrases(),
+// this does not include the secrets of keys with a KeyDerivationMethod, since
+// those are only accepted for opening containers that predate the method.
+func (d *Drive) configuredLUKSPassphrases() []string {
+	result := make([]string, len(d.Keys))
+	for idx, key := range d.Keys {
+		passphrase, ok := key.passphraseFor(d.SerialNumber)
+		if !ok {
+			passphrase = key.Secret
+		}
+		result[idx] = passphrase
+	}
+	return result
+}
+
+// LUKSPassphrasesForOpening returns the values from luksPassphrases().
+func (d *Drive) LUKSPassphrasesForOpening() []string {
+	passphrases := d.luksPassphrases()
+	result := make([]string, len(passphrases))
+	for idx, p := range passphrases {
+		result[idx] = p.Value
+	}
+	return result
+}
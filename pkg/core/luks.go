@@ -5,6 +5,8 @@ package core
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/sapcc/go-bits/logg"
 
@@ -19,6 +21,15 @@ type LUKSDevice struct {
 	// internal state
 	mapped      Device
 	mappingName string
+	// the passphrase that opens this container (nil if not known yet)
+	openedWith *luksPassphrase
+	// the keys (and the RemoveRetiredLUKSKeys setting) that the key slots were
+	// last checked against by rotateKeys()
+	rotatedKeys          []Key
+	rotatedRemoveRetired bool
+	// the profile that the header was last compared against by checkHeader()
+	checkedProfile   *os.LUKSProfile
+	headerMismatches []string
 }
 
 // DevicePath implements the Device interface.
@@ -34,61 +45,180 @@ func (d *LUKSDevice) MountedPath() string {
 	return d.mapped.MountedPath()
 }
 
+// Type implements the Device interface.
+func (d *LUKSDevice) Type() string {
+	return "luks"
+}
+
+// MappedDevicePath returns the path to the device file for the contents of
+// the LUKS container, or "" if the LUKS container is not open.
+func (d *LUKSDevice) MappedDevicePath() string {
+	if d.mapped == nil {
+		return ""
+	}
+	return d.mapped.DevicePath()
+}
+
+// MissingMountOptions implements the mountOptionReporter interface.
+func (d *LUKSDevice) MissingMountOptions() []string {
+	if r, ok := d.mapped.(mountOptionReporter); ok {
+		return r.MissingMountOptions()
+	}
+	return nil
+}
+
 // Setup implements the Device interface.
-func (d *LUKSDevice) Setup(drive *Drive, osi os.Interface) bool {
+func (d *LUKSDevice) Setup(drive *Drive, osi os.Interface) error {
 	// sanity check (and recognize pre-existing mapping before attempting our own)
 	err := d.Validate(drive, osi)
 	if err != nil {
-		logg.Error(err.Error())
-		return false
+		return err
 	}
 	if len(drive.Keys) == 0 {
-		logg.Error("LUKSDevice.Setup called on %s, but no keys specified!", d.path)
-		return false
+		return fmt.Errorf("LUKSDevice.Setup called on %s, but no keys specified", d.path)
 	}
 
 	// format on first use
 	if !d.formatted {
 		// double-check that disk is empty
-		if osi.ClassifyDevice(d.path) != os.DeviceTypeUnknown {
-			logg.Error("LUKSDevice.Setup called on %s, but is not empty!", d.path)
-			return false
+		if deviceType, _ := osi.ClassifyDevice(d.path); deviceType != os.DeviceTypeUnknown {
+			return fmt.Errorf("LUKSDevice.Setup called on %s, but is not empty", d.path)
 		}
 
 		// format with the preferred key
-		ok := osi.CreateLUKSContainer(d.path, drive.Keys[0])
-		if ok {
-			d.formatted = true
-		} else {
-			return false
+		ok := osi.CreateLUKSContainer(d.path, drive.LUKSPassphraseForCreation(), drive.LUKSProfile)
+		if !ok {
+			return fmt.Errorf("could not create LUKS container on %s", d.path)
 		}
+		d.formatted = true
 	}
 
 	// decrypt if necessary
 	if d.mapped == nil {
-		mappedDevicePath, ok := osi.OpenLUKSContainer(d.path, drive.DriveID, drive.Keys)
-		if ok {
-			logg.Info("LUKS container at %s opened as %s", d.path, mappedDevicePath)
-			d.mapped = newDevice(mappedDevicePath, osi, false)
-			d.mappingName = drive.DriveID
-		} else {
-			logg.Error(
+		passphrases := drive.luksPassphrases()
+		mappedDevicePath, idx, ok := osi.OpenLUKSContainer(d.path, drive.DriveID, drive.LUKSPassphrasesForOpening(), drive.LUKSProfile)
+		if !ok {
+			return fmt.Errorf(
 				"exec(cryptsetup luksOpen %s %s) failed: none of the configured keys was accepted",
 				d.path, drive.DriveID,
 			)
-			return false
 		}
+		logg.Info("LUKS container at %s opened as %s", d.path, mappedDevicePath)
+		d.mapped = newDevice(mappedDevicePath, osi, drive.DriveOptions, false)
+		d.mappingName = drive.DriveID
+		d.openedWith = &passphrases[idx]
 	}
 
 	// did that work?
 	if d.mapped == nil {
-		return false
+		return fmt.Errorf("contents of LUKS container in %s are not readable", d.path)
+	}
+
+	// this is not critical for the operation of the drive, so errors are only logged
+	if !slices.Equal(d.rotatedKeys, drive.Keys) || d.rotatedRemoveRetired != drive.RemoveRetiredLUKSKeys {
+		d.rotateKeys(drive, osi)
+		d.rotatedKeys = slices.Clone(drive.Keys)
+		d.rotatedRemoveRetired = drive.RemoveRetiredLUKSKeys
+	}
+	if d.checkedProfile == nil || *d.checkedProfile != drive.LUKSProfile {
+		d.checkHeader(drive, osi)
 	}
 
 	// descend into decrypted drive
 	return d.mapped.Setup(drive, osi)
 }
 
+// KeyIndex returns the index of the key in Drive.Keys that opens this
+// container, or -1 if it is not known.
+func (d *LUKSDevice) KeyIndex() int {
+	if d.openedWith == nil {
+		return -1
+	}
+	return d.openedWith.KeyIndex
+}
+
+// Ensures that the container can be opened with the primary key, i.e.
+// drive.Keys[0]. If drive.RemoveRetiredLUKSKeys is set, key slots that cannot
+// be opened with any of drive.Keys are removed.
+func (d *LUKSDevice) rotateKeys(drive *Drive, osi os.Interface) {
+	passphrases := drive.luksPassphrases()
+
+	// if the keys have changed since the container was opened, the passphrase
+	// that opened it may not be configured anymore (but it still opens the
+	// container, so it can be used to enroll the new primary key)
+	if d.openedWith != nil {
+		idx := slices.IndexFunc(passphrases, func(p luksPassphrase) bool { return p.Value == d.openedWith.Value })
+		if idx >= 0 {
+			d.openedWith = &passphrases[idx]
+		} else {
+			d.openedWith = &luksPassphrase{Value: d.openedWith.Value, KeyIndex: -1}
+		}
+	}
+
+	// if the container was opened by a previous run of the autopilot, we need to
+	// find out which passphrase opens it
+	if d.openedWith == nil {
+		for idx, p := range passphrases {
+			if _, ok := osi.FindLUKSKeySlot(d.path, p.Value); ok {
+				d.openedWith = &passphrases[idx]
+				break
+			}
+		}
+		if d.openedWith == nil {
+			logg.Error("none of the configured keys is accepted by the LUKS container on %s (cannot rotate keys)", d.path)
+			return
+		}
+	}
+
+	// enroll the primary key if necessary
+	primary := drive.primaryLUKSPassphrase()
+	if d.openedWith.Value != primary {
+		logg.Info("LUKS container on %s does not accept the current key yet, adding it", d.path)
+		if !osi.AddLUKSKey(d.path, d.openedWith.Value, primary, drive.LUKSProfile) {
+			logg.Error("could not add current key to LUKS container on %s", d.path)
+			return
+		}
+		d.openedWith = &luksPassphrase{Value: primary, KeyIndex: 0}
+	}
+
+	if !drive.RemoveRetiredLUKSKeys {
+		return
+	}
+
+	// find all key slots belonging to configured keys
+	slotIsConfigured := make(map[int]bool)
+	primaryFound := false
+	for _, passphrase := range drive.configuredLUKSPassphrases() {
+		slot, ok := osi.FindLUKSKeySlot(d.path, passphrase)
+		if ok {
+			slotIsConfigured[slot] = true
+			primaryFound = primaryFound || passphrase == primary
+		}
+	}
+	if !primaryFound {
+		// should not happen because of the step above, but let's be extra careful
+		// since we're about to destroy key slots
+		logg.Error("cannot find key slot of current key in LUKS container on %s (will not remove any key slots)", d.path)
+		return
+	}
+
+	header, ok := osi.GetLUKSHeader(d.path)
+	if !ok {
+		logg.Error("cannot list key slots of LUKS container on %s", d.path)
+		return
+	}
+	for _, keySlot := range header.KeySlots {
+		slot := keySlot.Index
+		if slotIsConfigured[slot] {
+			continue
+		}
+		logg.Info("removing key slot %d from LUKS container on %s since it does not belong to any configured key", slot, d.path)
+		if !osi.RemoveLUKSKeySlot(d.path, slot, primary) {
+			logg.Error("could not remove key slot %d from LUKS container on %s", slot, d.path)
+		}
+	}
+}
+
 // Teardown implements the Device interface.
 func (d *LUKSDevice) Teardown(drive *Drive, osi os.Interface) bool {
 	// need to teardown contents of mapped device first
@@ -129,7 +259,7 @@ func (d *LUKSDevice) Validate(drive *Drive, osi os.Interface) error {
 	case d.mapped == nil:
 		// existing mapping is now discovered for the first time -> update ourselves
 		logg.Info("discovered %s to be mapped to %s already", d.path, mappedDevicePath)
-		d.mapped = newDevice(mappedDevicePath, osi, false)
+		d.mapped = newDevice(mappedDevicePath, osi, drive.DriveOptions, false)
 	case mappedDevicePath != d.mapped.DevicePath():
 		// our internal state tells a different story!
 		return fmt.Errorf("LUKS container in %s should be open at %s, but is actually open at %s",
@@ -154,3 +284,27 @@ func (d *LUKSDevice) Validate(drive *Drive, osi os.Interface) error {
 	}
 	return d.mapped.Validate(drive, osi)
 }
+
+// Compares the LUKS header with drive.LUKSProfile. Existing containers are
+// never reformatted, so any drift is only reported through
+// LUKSHeaderMismatches().
+func (d *LUKSDevice) checkHeader(drive *Drive, osi os.Interface) {
+	header, ok := osi.GetLUKSHeader(d.path)
+	if !ok {
+		logg.Error("cannot read header of LUKS container on %s", d.path)
+		return
+	}
+	profile := drive.LUKSProfile
+	d.checkedProfile = &profile
+	d.headerMismatches = profile.Mismatches(header)
+	if len(d.headerMismatches) > 0 {
+		logg.Info("LUKS container on %s does not match the configured profile: %s",
+			d.path, strings.Join(d.headerMismatches, ", "))
+	}
+}
+
+// LUKSHeaderMismatches returns a description of each parameter of the LUKS
+// header that differs from the configured profile.
+func (d *LUKSDevice) LUKSHeaderMismatches() []string {
+	return d.headerMismatches
+}
@@ -3,7 +3,10 @@
 
 package core
 
-import "github.com/sapcc/swift-drive-autopilot/pkg/os"
+import (
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
 
 // Device is implemented by each model class that represents the contents of a
 // device. Each method in the interface takes a reference to the drive that
@@ -15,34 +18,95 @@ type Device interface {
 	// MountedPath returns the path where this device (or its contents) are mounted.
 	MountedPath() string
 	// Setup is called by the converger when the drive is not broken. It shall
-	// idempotently prepare the drive for consumption by Swift.
-	Setup(drive *Drive, osi os.Interface) (ok bool)
+	// idempotently prepare the drive for consumption by Swift. If an error is
+	// returned, the drive will be marked as broken.
+	Setup(drive *Drive, osi os.Interface) error
 	// Teardown is called by the converger when the drive is broken. It shall
 	// idempotently shutdown all mounts and mappings for this drive.
 	Teardown(drive *Drive, osi os.Interface) (ok bool)
 	// Validate is called by the converger when the drive is not broken, to
 	// determine whether it has become broken.
 	Validate(drive *Drive, osi os.Interface) error
+	// Type returns a short identifier for this kind of device (e.g. "luks" or
+	// "xfs"). This is only used for reporting purposes.
+	Type() string
+}
+
+// mountOptionReporter is implemented by Device implementations that mount a
+// filesystem.
+type mountOptionReporter interface {
+	// MissingMountOptions returns those of drive.MountOptions that are not active
+	// on the mount of this device, even after an attempt to remount it.
+	MissingMountOptions() []string
 }
 
 // Returns nil to indicate unreadable device.
-func newDevice(devicePath string, osi os.Interface, preferLUKS bool) Device {
-	switch osi.ClassifyDevice(devicePath) {
+func newDevice(devicePath string, osi os.Interface, opts DriveOptions, allowLUKS bool) Device {
+	deviceType, fsType := osi.ClassifyDevice(devicePath)
+	switch deviceType {
 	case os.DeviceTypeUnreadable:
 		break
 	case os.DeviceTypeUnknown:
-		if preferLUKS {
+		if allowLUKS && len(opts.Keys) > 0 {
 			return &LUKSDevice{path: devicePath, formatted: false}
 		}
-		return &XFSDevice{path: devicePath, formatted: false}
+		return newFilesystemDevice(devicePath, opts.FilesystemType(), false)
 	case os.DeviceTypeLUKS:
 		return &LUKSDevice{path: devicePath, formatted: true}
 	case os.DeviceTypeFilesystem:
-		return &XFSDevice{path: devicePath, formatted: true}
+		return newFilesystemDevice(devicePath, fsType, true)
+	case os.DeviceTypeForeign:
+		return &foreignDevice{path: devicePath, signature: string(fsType)}
 	}
 	return nil
 }
 
+// DriveOptions contains the parts of the configuration that affect how each
+// drive is set up.
+type DriveOptions struct {
+	// Keys contains the LUKS encryption keys that may be used with this drive. When
+	// creating a new LUKS container on this drive, Keys[0] must be used. An empty
+	// slice indicates that encryption is not configured.
+	Keys []Key
+	// RemoveRetiredLUKSKeys indicates whether key slots of LUKS containers that
+	// cannot be opened with any of the Keys shall be removed.
+	RemoveRetiredLUKSKeys bool
+	// LUKSProfile contains the parameters for creating and opening LUKS
+	// containers. Existing containers whose header does not match are reported
+	// through Drive.LUKSHeaderMismatches(), but not changed.
+	LUKSProfile os.LUKSProfile
+	// Filesystem is the type of filesystem that is created on empty drives.
+	// Drives containing a different type of filesystem will not be mounted.
+	// If empty, FilesystemXFS is used.
+	Filesystem os.FilesystemType
+	// FormatOptions contains additional arguments for mkfs.
+	FormatOptions []string
+	// MountOptions contains the options (e.g. "noatime") that the filesystem
+	// shall be mounted with. Existing mounts lacking these options are remounted.
+	MountOptions []string
+	// FsckBeforeMount indicates whether an existing filesystem shall be checked
+	// for errors before it is mounted. Filesystems that are already mounted or
+	// that have just been created are not checked.
+	FsckBeforeMount bool
+	// ErrorPolicies decide which kernel log errors cause the drive to be marked
+	// as broken. The first policy that matches an error is used. Errors that do
+	// not match any policy are handled according to DefaultErrorPolicy.
+	ErrorPolicies []ErrorPolicy
+	// SMARTPolicy decides how the drive's SMART health indicators are acted upon.
+	SMARTPolicy SMARTPolicy
+	// NearlyFullThreshold is the percentage of used space or inodes at which the
+	// drive's filesystem is reported as nearly full, or 0 if it shall never be.
+	NearlyFullThreshold int
+}
+
+// FilesystemType returns o.Filesystem, or the default value if it is empty.
+func (o DriveOptions) FilesystemType() os.FilesystemType {
+	if o.Filesystem == "" {
+		return os.FilesystemXFS
+	}
+	return o.Filesystem
+}
+
 // Drive enhances os.Drive with a state machine that coordinates the setup and
 // teardown of the drive's mount.
 type Drive struct {
@@ -51,13 +115,35 @@ type Drive struct {
 
 	// state machine
 	Broken bool
+	// BrokenReason explains why this drive is broken. Only set if Broken is true.
+	BrokenReason string
+	// KernelLogErrors contains the errors that were seen on this drive within the
+	// interval of their error policy. The drive is suspect while this is not
+	// empty.
+	KernelLogErrors []KernelLogError
+	// SMARTHealth contains the SMART health indicators that were last read from
+	// this drive, or nil if they have not been read (yet).
+	SMARTHealth *parsers.SMARTHealth
+	// SMARTSuspectReason is non-empty if the drive is suspect because of its
+	// SMART health indicators.
+	SMARTSuspectReason string
+	// FilesystemUsage contains the usage of this drive's filesystem as of the
+	// last converger iteration, or nil if the filesystem is not mounted.
+	FilesystemUsage *os.FilesystemUsage
 
 	// DriveID identifies this drive in derived filenames.
 	DriveID string
+	// SerialNumber is the drive's serial number as reported by the OS, or "" if
+	// it is not known. (In the latter case, a fallback value is used for DriveID.)
+	SerialNumber string
+	// WWN and Model are reported by the OS for informational purposes. Either
+	// may be "" if not known.
+	WWN   string
+	Model string
 	// Assignment identifies this drive's location within the Swift ring.
 	Assignment *Assignment
-	// Keys contains the LUKS encryption keys that may be used with this drive. When
-	// creating a new LUKS container on this drive, Keys[0] must be used. An empty
-	// slice indicates that encryption is not configured.
-	Keys []string
+	// DriveOptions can be changed at runtime when the configuration is reloaded.
+	// Changes only take effect when a new container or filesystem is created or
+	// an existing container is opened.
+	DriveOptions
 }
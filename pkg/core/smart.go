@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// SMARTAction describes how the autopilot reacts to concerning SMART health
+// indicators of a drive.
+type SMARTAction string
+
+const (
+	// SMARTActionNone means that the indicator is not concerning.
+	SMARTActionNone SMARTAction = ""
+	// SMARTActionWarn means that a warning is logged.
+	SMARTActionWarn SMARTAction = "warn"
+	// SMARTActionSuspect means that the drive is reported in DriveSuspect state.
+	SMARTActionSuspect SMARTAction = "suspect"
+	// SMARTActionBroken means that the drive is marked as broken.
+	SMARTActionBroken SMARTAction = "broken"
+)
+
+// severity orders SMARTActions from harmless to severe.
+func (a SMARTAction) severity() int {
+	switch a {
+	case SMARTActionWarn:
+		return 1
+	case SMARTActionSuspect:
+		return 2
+	case SMARTActionBroken:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// SMARTThresholds appears in type SMARTPolicy. Each field contains the value
+// of a SMART health indicator at or above which the respective action is taken,
+// or 0 if this action shall never be taken.
+type SMARTThresholds struct {
+	Warn    int64 `yaml:"warn"`
+	Suspect int64 `yaml:"suspect"`
+	Broken  int64 `yaml:"broken"`
+}
+
+func (t SMARTThresholds) evaluate(value int64) (SMARTAction, int64) {
+	switch {
+	case t.Broken > 0 && value >= t.Broken:
+		return SMARTActionBroken, t.Broken
+	case t.Suspect > 0 && value >= t.Suspect:
+		return SMARTActionSuspect, t.Suspect
+	case t.Warn > 0 && value >= t.Warn:
+		return SMARTActionWarn, t.Warn
+	default:
+		return SMARTActionNone, 0
+	}
+}
+
+// SMARTPolicy describes how the autopilot reacts to the SMART health
+// indicators of a drive.
+type SMARTPolicy struct {
+	// FailedHealthCheck is the action that is taken when the drive's own health
+	// self-assessment fails.
+	FailedHealthCheck  SMARTAction
+	ReallocatedSectors SMARTThresholds
+	PendingSectors     SMARTThresholds
+	TemperatureCelsius SMARTThresholds
+}
+
+// Evaluate returns the most severe action that is warranted by the given
+// SMART health indicators, and a description of the indicators that caused
+// this action.
+func (p SMARTPolicy) Evaluate(h parsers.SMARTHealth) (SMARTAction, string) {
+	result := SMARTActionNone
+	var reasons []string
+	consider := func(action SMARTAction, reason string) {
+		if action == SMARTActionNone {
+			return
+		}
+		if action.severity() > result.severity() {
+			result = action
+			reasons = nil
+		}
+		if action == result {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if h.Passed != nil && !*h.Passed {
+		consider(p.FailedHealthCheck, "SMART health check failed")
+	}
+	check := func(value *int64, thresholds SMARTThresholds, description string) {
+		if value == nil {
+			return
+		}
+		action, threshold := thresholds.evaluate(*value)
+		consider(action, fmt.Sprintf("%s is %d (threshold for %s: %d)", description, *value, action, threshold))
+	}
+	check(h.ReallocatedSectors, p.ReallocatedSectors, "reallocated sector count")
+	check(h.PendingSectors, p.PendingSectors, "pending sector count")
+	check(h.TemperatureCelsius, p.TemperatureCelsius, "temperature in °C")
+
+	return result, strings.Join(reasons, ", ")
+}
+
+// HandleSMARTHealth is called whenever the SMART health indicators of this
+// drive have been read. Depending on d.SMARTPolicy, this may log a warning,
+// mark the drive as suspect or mark it as broken.
+func (d *Drive) HandleSMARTHealth(osi os.Interface, h parsers.SMARTHealth) {
+	d.SMARTHealth = &h
+	d.SMARTSuspectReason = ""
+	if d.Broken {
+		return
+	}
+
+	action, reason := d.SMARTPolicy.Evaluate(h)
+	switch action {
+	case SMARTActionWarn:
+		logg.Info("WARNING: SMART health indicators of %s are concerning: %s", d.DevicePath, reason)
+	case SMARTActionSuspect:
+		logg.Info("%s is suspect because of SMART health indicators: %s", d.DevicePath, reason)
+		d.SMARTSuspectReason = reason
+	case SMARTActionBroken:
+		d.MarkAsBroken(osi, "SMART health indicators are critical: "+reason)
+	}
+}
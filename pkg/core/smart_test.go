@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+func TestSMARTPolicyEvaluate(t *testing.T) {
+	policy := SMARTPolicy{
+		FailedHealthCheck:  SMARTActionBroken,
+		ReallocatedSectors: SMARTThresholds{Warn: 1, Suspect: 50, Broken: 500},
+		PendingSectors:     SMARTThresholds{Warn: 1, Suspect: 10},
+		TemperatureCelsius: SMARTThresholds{Warn: 55},
+	}
+	passed, failed := true, false
+	ptr := func(value int64) *int64 { return &value }
+
+	testCases := []struct {
+		Health parsers.SMARTHealth
+		Action SMARTAction
+		Reason string
+	}{
+		{parsers.SMARTHealth{}, SMARTActionNone, ""},
+		{parsers.SMARTHealth{Passed: &passed, TemperatureCelsius: ptr(34), ReallocatedSectors: ptr(0), PendingSectors: ptr(0)}, SMARTActionNone, ""},
+		{
+			parsers.SMARTHealth{Passed: &passed, TemperatureCelsius: ptr(58), ReallocatedSectors: ptr(3)},
+			SMARTActionWarn,
+			"reallocated sector count is 3 (threshold for warn: 1), temperature in °C is 58 (threshold for warn: 55)",
+		},
+		{
+			parsers.SMARTHealth{Passed: &passed, TemperatureCelsius: ptr(58), ReallocatedSectors: ptr(3), PendingSectors: ptr(12)},
+			SMARTActionSuspect,
+			"pending sector count is 12 (threshold for suspect: 10)",
+		},
+		{
+			parsers.SMARTHealth{Passed: &passed, ReallocatedSectors: ptr(1000), PendingSectors: ptr(1000)},
+			SMARTActionBroken,
+			"reallocated sector count is 1000 (threshold for broken: 500)",
+		},
+		{
+			parsers.SMARTHealth{Passed: &failed, ReallocatedSectors: ptr(600)},
+			SMARTActionBroken,
+			"SMART health check failed, reallocated sector count is 600 (threshold for broken: 500)",
+		},
+	}
+	for idx, tc := range testCases {
+		action, reason := policy.Evaluate(tc.Health)
+		if action != tc.Action || reason != tc.Reason {
+			t.Errorf("test case %d: expected (%q, %q), but got (%q, %q)", idx, tc.Action, tc.Reason, action, reason)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package core
+
+import (
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+// UpdateFilesystemUsage measures the usage of the filesystem on this drive. If
+// the drive is broken or its filesystem is not mounted, d.FilesystemUsage is
+// reset to nil.
+func (d *Drive) UpdateFilesystemUsage(osi os.Interface) {
+	wasNearlyFull := d.IsNearlyFull()
+	d.FilesystemUsage = nil
+
+	mountedPath := d.MountedPath()
+	if d.Broken || mountedPath == "" {
+		return
+	}
+	usage, err := osi.GetFilesystemUsage(mountedPath)
+	if err != nil {
+		logg.Error("cannot measure filesystem usage of %s: %s", d.DevicePath, err.Error())
+		return
+	}
+	d.FilesystemUsage = &usage
+
+	if d.IsNearlyFull() && !wasNearlyFull {
+		logg.Info("WARNING: filesystem on %s (mounted at %s) is nearly full: %d%% of space and %d%% of inodes are used",
+			d.DevicePath, mountedPath, usedPercent(usage.UsedBytes, usage.FreeBytes),
+			usedPercent(usage.TotalInodes-usage.FreeInodes, usage.FreeInodes))
+	}
+}
+
+// IsNearlyFull returns whether at least d.NearlyFullThreshold percent of the
+// space or inodes of this drive's filesystem are used. It always returns false
+// if no threshold is configured or the usage is not known.
+func (d *Drive) IsNearlyFull() bool {
+	u := d.FilesystemUsage
+	if d.NearlyFullThreshold <= 0 || u == nil {
+		return false
+	}
+	threshold := uint64(d.NearlyFullThreshold) //nolint:gosec // checked to be positive above
+	return usedPercent(u.UsedBytes, u.FreeBytes) >= threshold ||
+		usedPercent(u.TotalInodes-u.FreeInodes, u.FreeInodes) >= threshold
+}
+
+// usedPercent computes the usage in percent like `df` does, i.e. rounded up.
+func usedPercent(used, free uint64) uint64 {
+	total := used + free
+	if total == 0 {
+		return 0
+	}
+	return (used*100 + total - 1) / total
+}
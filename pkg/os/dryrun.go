@@ -0,0 +1,512 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// DryRun is an Interface implementation that wraps another Interface. All
+// read-only operations are passed through to the wrapped Interface, but all
+// mutating operations are only recorded in the plan (see Plan()) instead of
+// being executed.
+//
+// To give the converger a consistent picture, DryRun simulates the effect of
+// the recorded operations on subsequent read-only operations, e.g. a device
+// that would have been formatted is reported as containing a filesystem. Some
+// things cannot be known without actually touching the drive, though:
+//
+//   - An existing LUKS container that is not yet opened is assumed to contain a
+//     filesystem (of unknown type) once it would have been opened.
+//   - The swift-id and usage of an existing filesystem that is not yet mounted
+//     cannot be read.
+//   - Filesystem checks are assumed to pass.
+//
+// DryRun is not safe for concurrent use, except for CollectDrives(),
+// CollectDriveErrors() and ReadSMARTHealth() which are passed through.
+type DryRun struct {
+	base                Interface
+	separateMountScopes bool
+	plan                []string
+
+	// devices that would have been formatted or encrypted (including mapped
+	// devices of LUKS containers that would have been opened)
+	deviceTypes     map[string]DeviceType
+	filesystemTypes map[string]FilesystemType
+	// devices that would have been formatted or encrypted in this run, so their
+	// contents are known to be empty
+	freshDevices map[string]bool
+	// device path -> mapped device path
+	openedLUKS map[string]string
+	// mapping names
+	closedLUKS map[string]bool
+	// device path -> key slots of LUKS containers that were created or changed
+	luksKeySlots map[string]map[int]dryRunKeySlot
+	// device path -> headers of LUKS containers that were created (without key slots)
+	luksHeaders map[string]parsers.LUKSHeader
+	// mounts that would have been created
+	addedMounts map[MountScope][]MountPoint
+	// mount paths of existing mounts that would have been removed
+	removedMounts map[MountScope]map[string]bool
+	// mount path -> options that would have been added to existing mounts
+	remountedOptions map[MountScope]map[string][]string
+	// device path -> swift-id
+	writtenSwiftIDs map[string]string
+}
+
+// NewDryRun wraps the given Interface into a DryRun.
+func NewDryRun(base Interface) *DryRun {
+	separateMountScopes := true
+	if l, ok := base.(*Linux); ok {
+		separateMountScopes = l.mountScopesAreSeparate()
+	}
+
+	return &DryRun{
+		base:                base,
+		separateMountScopes: separateMountScopes,
+		deviceTypes:         make(map[string]DeviceType),
+		filesystemTypes:     make(map[string]FilesystemType),
+		freshDevices:        make(map[string]bool),
+		openedLUKS:          make(map[string]string),
+		closedLUKS:          make(map[string]bool),
+		luksKeySlots:        make(map[string]map[int]dryRunKeySlot),
+		luksHeaders:         make(map[string]parsers.LUKSHeader),
+		addedMounts:         make(map[MountScope][]MountPoint),
+		removedMounts:       map[MountScope]map[string]bool{HostScope: {}, LocalScope: {}},
+		remountedOptions:    map[MountScope]map[string][]string{HostScope: {}, LocalScope: {}},
+		writtenSwiftIDs:     make(map[string]string),
+	}
+}
+
+// Plan returns descriptions of all mutating operations that were recorded so
+// far, in the order in which they were requested.
+func (d *DryRun) Plan() []string {
+	return d.plan
+}
+
+func (d *DryRun) record(msg string, args ...any) {
+	d.plan = append(d.plan, fmt.Sprintf(msg, args...))
+}
+
+// CollectDrives implements the Interface interface.
+func (d *DryRun) CollectDrives(devicePathGlobs func() []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string) {
+	d.base.CollectDrives(devicePathGlobs, trigger, added, removed)
+}
+
+// CollectDriveErrors implements the Interface interface.
+func (d *DryRun) CollectDriveErrors(patterns func() KernelLogPatterns, errors chan<- []DriveError, alive chan<- bool) {
+	d.base.CollectDriveErrors(patterns, errors, alive)
+}
+
+// ReadSMARTHealth implements the Interface interface.
+func (d *DryRun) ReadSMARTHealth(devicePath string) (parsers.SMARTHealth, error) {
+	return d.base.ReadSMARTHealth(devicePath)
+}
+
+// ClassifyDevice implements the Interface interface.
+func (d *DryRun) ClassifyDevice(devicePath string) (DeviceType, FilesystemType) {
+	if deviceType, exists := d.deviceTypes[devicePath]; exists {
+		return deviceType, d.filesystemTypes[devicePath]
+	}
+	return d.base.ClassifyDevice(devicePath)
+}
+
+// FormatDevice implements the Interface interface.
+func (d *DryRun) FormatDevice(devicePath string, fsType FilesystemType, command []string) bool {
+	d.record("format %s with %s (%s %s)", devicePath, fsType, strings.Join(command, " "), devicePath)
+	d.deviceTypes[devicePath] = DeviceTypeFilesystem
+	d.filesystemTypes[devicePath] = fsType
+	d.freshDevices[devicePath] = true
+	return true
+}
+
+// CheckFilesystem implements the Interface interface.
+func (d *DryRun) CheckFilesystem(devicePath string, fsType FilesystemType, command []string) bool {
+	// this is read-only, but it can take a long time for large drives
+	d.record("check %s filesystem on %s (%s %s)", fsType, devicePath, strings.Join(command, " "), devicePath)
+	return true
+}
+
+// MountDevice implements the Interface interface.
+func (d *DryRun) MountDevice(devicePath, mountPath string, options []string, scope MountScope) error {
+	// check if already mounted
+	for _, m := range d.GetMountPointsOf(devicePath, scope) {
+		if m.MountPath == mountPath {
+			return nil
+		}
+	}
+
+	if len(options) == 0 {
+		d.record("mount %s at %s in %s mount namespace", devicePath, mountPath, scope)
+	} else {
+		d.record("mount %s at %s with options %s in %s mount namespace", devicePath, mountPath, strings.Join(options, ","), scope)
+	}
+	for _, s := range d.affectedScopes(scope) {
+		delete(d.removedMounts[s], mountPath)
+		delete(d.remountedOptions[s], mountPath)
+		d.addedMounts[s] = append(d.addedMounts[s], MountPoint{
+			DevicePath: devicePath,
+			MountPath:  mountPath,
+			Options:    makeOptionSet(options),
+		})
+	}
+	return nil
+}
+
+// RemountDevice implements the Interface interface.
+func (d *DryRun) RemountDevice(mountPath string, options []string, scope MountScope) error {
+	d.record("remount %s with options %s in %s mount namespace", mountPath, strings.Join(options, ","), scope)
+	for _, s := range d.affectedScopes(scope) {
+		d.remountedOptions[s][mountPath] = append(d.remountedOptions[s][mountPath], options...)
+		for idx, m := range d.addedMounts[s] {
+			if m.MountPath == mountPath {
+				d.addedMounts[s][idx] = m.withOptions(options)
+			}
+		}
+	}
+	return nil
+}
+
+// UnmountDevice implements the Interface interface.
+func (d *DryRun) UnmountDevice(mountPath string, scope MountScope) error {
+	// check if already unmounted
+	if d.deviceMountedAt(mountPath, scope) == "" {
+		return nil
+	}
+
+	d.record("unmount %s in %s mount namespace", mountPath, scope)
+	for _, s := range d.affectedScopes(scope) {
+		d.addedMounts[s] = slices.DeleteFunc(d.addedMounts[s], func(m MountPoint) bool {
+			return m.MountPath == mountPath
+		})
+		d.removedMounts[s][mountPath] = true
+		delete(d.remountedOptions[s], mountPath)
+	}
+	return nil
+}
+
+// Returns which mount scopes are affected by a mount or unmount in the given scope.
+func (d *DryRun) affectedScopes(scope MountScope) []MountScope {
+	if d.separateMountScopes {
+		return []MountScope{scope}
+	}
+	return []MountScope{HostScope, LocalScope}
+}
+
+func (d *DryRun) deviceMountedAt(mountPath string, scope MountScope) string {
+	for _, m := range d.GetMountPointsIn(mountPath, scope) {
+		if m.MountPath == mountPath {
+			return m.DevicePath
+		}
+	}
+	return ""
+}
+
+// RefreshMountPoints implements the Interface interface.
+func (d *DryRun) RefreshMountPoints() {
+	d.base.RefreshMountPoints()
+}
+
+// GetMountPointsIn implements the Interface interface.
+func (d *DryRun) GetMountPointsIn(mountPathPrefix string, scope MountScope) []MountPoint {
+	result := d.filterMountPoints(d.base.GetMountPointsIn(mountPathPrefix, scope), scope)
+	for _, m := range d.addedMounts[scope] {
+		if strings.HasPrefix(m.MountPath, mountPathPrefix) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// GetMountPointsOf implements the Interface interface.
+func (d *DryRun) GetMountPointsOf(devicePath string, scope MountScope) []MountPoint {
+	result := d.filterMountPoints(d.base.GetMountPointsOf(devicePath, scope), scope)
+	for _, m := range d.addedMounts[scope] {
+		if m.DevicePath == devicePath {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func (d *DryRun) filterMountPoints(mountPoints []MountPoint, scope MountScope) []MountPoint {
+	var result []MountPoint
+	for _, m := range mountPoints {
+		if !d.removedMounts[scope][m.MountPath] {
+			result = append(result, m.withOptions(d.remountedOptions[scope][m.MountPath]))
+		}
+	}
+	return result
+}
+
+// CreateLUKSContainer implements the Interface interface.
+func (d *DryRun) CreateLUKSContainer(devicePath, key string, profile LUKSProfile) bool {
+	if args := profile.formatArgs(); len(args) == 0 {
+		d.record("create LUKS container on %s", devicePath)
+	} else {
+		d.record("create LUKS container on %s (cryptsetup options: %s)", devicePath, strings.Join(args, " "))
+	}
+	d.deviceTypes[devicePath] = DeviceTypeLUKS
+	d.freshDevices[devicePath] = true
+	d.luksKeySlots[devicePath] = map[int]dryRunKeySlot{0: {key: key, known: true, pbkdf: profile.PBKDF}}
+	// we do not know the defaults of cryptsetup, so only the parameters from
+	// the profile can be reported
+	d.luksHeaders[devicePath] = parsers.LUKSHeader{
+		Version:    profile.Version,
+		Cipher:     profile.Cipher,
+		KeySize:    profile.KeySize,
+		SectorSize: profile.SectorSize,
+	}
+	return true
+}
+
+// OpenLUKSContainer implements the Interface interface.
+func (d *DryRun) OpenLUKSContainer(devicePath, mappingName string, keys []string, profile LUKSProfile) (string, int, bool) {
+	// find out which key would work (for existing containers, this can be
+	// checked without opening the container)
+	keyIndex := slices.IndexFunc(keys, func(key string) bool {
+		_, ok := d.FindLUKSKeySlot(devicePath, key)
+		return ok
+	})
+	if keyIndex < 0 {
+		return "", -1, false
+	}
+
+	if args := profile.openArgs(); len(args) == 0 {
+		d.record("open LUKS container on %s as %s", devicePath, mappingName)
+	} else {
+		d.record("open LUKS container on %s as %s (cryptsetup options: %s)", devicePath, mappingName, strings.Join(args, " "))
+	}
+	mappedDevicePath := "/dev/mapper/" + mappingName
+	d.openedLUKS[devicePath] = mappedDevicePath
+	delete(d.closedLUKS, mappingName)
+
+	if d.freshDevices[devicePath] {
+		d.deviceTypes[mappedDevicePath] = DeviceTypeUnknown
+		d.freshDevices[mappedDevicePath] = true
+	} else if _, exists := d.deviceTypes[mappedDevicePath]; !exists {
+		// we cannot look inside the container without opening it, so we assume
+		// that it contains the filesystem that we put there at some point
+		d.deviceTypes[mappedDevicePath] = DeviceTypeFilesystem
+	}
+	return mappedDevicePath, keyIndex, true
+}
+
+// CloseLUKSContainer implements the Interface interface.
+func (d *DryRun) CloseLUKSContainer(mappingName string) bool {
+	d.record("close LUKS container %s", mappingName)
+	mappedDevicePath := "/dev/mapper/" + mappingName
+	for devicePath, path := range d.openedLUKS {
+		if path == mappedDevicePath {
+			delete(d.openedLUKS, devicePath)
+		}
+	}
+	d.closedLUKS[mappingName] = true
+	return true
+}
+
+// RefreshLUKSMappings implements the Interface interface.
+func (d *DryRun) RefreshLUKSMappings() {
+	d.base.RefreshLUKSMappings()
+}
+
+// GetLUKSMappingOf implements the Interface interface.
+func (d *DryRun) GetLUKSMappingOf(devicePath string) string {
+	if mappedDevicePath, exists := d.openedLUKS[devicePath]; exists {
+		return mappedDevicePath
+	}
+	mappedDevicePath := d.base.GetLUKSMappingOf(devicePath)
+	if mappedDevicePath != "" && d.closedLUKS[filepath.Base(mappedDevicePath)] {
+		return ""
+	}
+	return mappedDevicePath
+}
+
+// dryRunKeySlot appears in type DryRun.
+type dryRunKeySlot struct {
+	key   string
+	known bool // false for existing key slots (whose key we do not know)
+	pbkdf string
+}
+
+// Returns the simulated key slots of the LUKS container on the given device,
+// initializing them from the base Interface on first use.
+func (d *DryRun) keySlotsOf(devicePath string) (map[int]dryRunKeySlot, bool) {
+	if slots, exists := d.luksKeySlots[devicePath]; exists {
+		return slots, true
+	}
+	header, ok := d.base.GetLUKSHeader(devicePath)
+	if !ok {
+		return nil, false
+	}
+	slots := make(map[int]dryRunKeySlot, len(header.KeySlots))
+	for _, slot := range header.KeySlots {
+		slots[slot.Index] = dryRunKeySlot{pbkdf: slot.PBKDF}
+	}
+	d.luksKeySlots[devicePath] = slots
+	return slots, true
+}
+
+// GetLUKSHeader implements the Interface interface.
+func (d *DryRun) GetLUKSHeader(devicePath string) (parsers.LUKSHeader, bool) {
+	header, exists := d.luksHeaders[devicePath]
+	if !exists {
+		var ok bool
+		header, ok = d.base.GetLUKSHeader(devicePath)
+		if !ok {
+			return parsers.LUKSHeader{}, false
+		}
+	}
+	slots, ok := d.keySlotsOf(devicePath)
+	if !ok {
+		return parsers.LUKSHeader{}, false
+	}
+	header.KeySlots = nil
+	for _, slot := range slices.Sorted(maps.Keys(slots)) {
+		header.KeySlots = append(header.KeySlots, parsers.LUKSKeySlot{Index: slot, PBKDF: slots[slot].pbkdf})
+	}
+	return header, true
+}
+
+// FindLUKSKeySlot implements the Interface interface.
+func (d *DryRun) FindLUKSKeySlot(devicePath, key string) (int, bool) {
+	slots, exists := d.luksKeySlots[devicePath]
+	if !exists {
+		return d.base.FindLUKSKeySlot(devicePath, key)
+	}
+	for _, slot := range slices.Sorted(maps.Keys(slots)) {
+		if slots[slot].known && slots[slot].key == key {
+			return slot, true
+		}
+	}
+	if d.freshDevices[devicePath] {
+		return -1, false
+	}
+	// the key may be in one of the existing key slots, unless that slot would
+	// have been removed
+	slot, ok := d.base.FindLUKSKeySlot(devicePath, key)
+	if ok {
+		_, exists := slots[slot]
+		return slot, exists
+	}
+	return -1, false
+}
+
+// AddLUKSKey implements the Interface interface.
+func (d *DryRun) AddLUKSKey(devicePath, existingKey, newKey string, profile LUKSProfile) bool {
+	if args := profile.keySlotArgs(); len(args) == 0 {
+		d.record("add key to LUKS container on %s", devicePath)
+	} else {
+		d.record("add key to LUKS container on %s (cryptsetup options: %s)", devicePath, strings.Join(args, " "))
+	}
+	slots, ok := d.keySlotsOf(devicePath)
+	if !ok {
+		return false
+	}
+	for slot := 0; ; slot++ {
+		if _, exists := slots[slot]; !exists {
+			slots[slot] = dryRunKeySlot{key: newKey, known: true, pbkdf: profile.PBKDF}
+			return true
+		}
+	}
+}
+
+// RemoveLUKSKeySlot implements the Interface interface.
+func (d *DryRun) RemoveLUKSKeySlot(devicePath string, slot int, key string) bool {
+	d.record("remove key slot %d from LUKS container on %s", slot, devicePath)
+	slots, ok := d.keySlotsOf(devicePath)
+	if !ok {
+		return false
+	}
+	delete(slots, slot)
+	return true
+}
+
+// GetFilesystemUsage implements the Interface interface.
+func (d *DryRun) GetFilesystemUsage(mountPath string) (FilesystemUsage, error) {
+	devicePath := d.deviceMountedAt(mountPath, LocalScope)
+	if devicePath == "" {
+		return d.base.GetFilesystemUsage(mountPath)
+	}
+
+	// like in ReadSwiftID(), we can only look at devices that are actually
+	// mounted somewhere
+	if !d.freshDevices[devicePath] {
+		for _, m := range d.base.GetMountPointsOf(devicePath, LocalScope) {
+			return d.base.GetFilesystemUsage(m.MountPath)
+		}
+	}
+	return FilesystemUsage{}, fmt.Errorf("cannot measure filesystem usage of %s in dry-run mode because it is not mounted yet", devicePath)
+}
+
+// ReadSwiftID implements the Interface interface.
+func (d *DryRun) ReadSwiftID(mountPath string) (string, error) {
+	devicePath := d.deviceMountedAt(mountPath, LocalScope)
+	if devicePath == "" {
+		return d.base.ReadSwiftID(mountPath)
+	}
+	if swiftID, exists := d.writtenSwiftIDs[devicePath]; exists {
+		return swiftID, nil
+	}
+	if d.freshDevices[devicePath] {
+		return "", nil
+	}
+
+	// the device has existing contents -> we can look at them if the device is
+	// actually mounted somewhere
+	for _, m := range d.base.GetMountPointsOf(devicePath, LocalScope) {
+		return d.base.ReadSwiftID(m.MountPath)
+	}
+	return "", fmt.Errorf("cannot read swift-id of %s in dry-run mode because it is not mounted yet", devicePath)
+}
+
+// WriteSwiftID implements the Interface interface.
+func (d *DryRun) WriteSwiftID(mountPath, swiftID string) error {
+	d.record("write swift-id %q into %s", swiftID, mountPath)
+	if devicePath := d.deviceMountedAt(mountPath, LocalScope); devicePath != "" {
+		d.writtenSwiftIDs[devicePath] = swiftID
+	}
+	return nil
+}
+
+// Chown implements the Interface interface.
+func (d *DryRun) Chown(path, owner, group string) {
+	d.record("chown %s to %s:%s", path, owner, group)
+}
+
+// ReadSymlink implements the Interface interface.
+func (d *DryRun) ReadSymlink(path string) (string, error) {
+	return d.base.ReadSymlink(path)
+}
+
+// CreateSymlink implements the Interface interface.
+func (d *DryRun) CreateSymlink(path, target string) error {
+	d.record("create symlink %s -> %s", path, target)
+	return nil
+}
+
+// RemoveFile implements the Interface interface.
+func (d *DryRun) RemoveFile(path string) error {
+	// avoid cluttering the plan with no-ops (this is mostly relevant for
+	// unmount-propagation flags, so it's okay that this only recognizes symlinks
+	// as existing files reliably)
+	_, err := d.base.ReadSymlink(path)
+	if err == nil || !os.IsNotExist(err) {
+		d.record("remove %s", path)
+	}
+	return nil
+}
+
+// WriteFile implements the Interface interface.
+func (d *DryRun) WriteFile(path string, contents []byte) error {
+	d.record("write %s", path)
+	return nil
+}
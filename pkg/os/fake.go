@@ -0,0 +1,704 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// Fake is an Interface implementation that simulates drives, LUKS containers
+// and mounts in memory. It is used by unit tests to exercise the converger
+// without requiring root privileges or loop devices.
+//
+// Unlike Linux, Fake does not cache any state between calls to
+// RefreshMountPoints() and RefreshLUKSMappings(). All changes made through the
+// Fake's test helper methods are visible to the caller immediately. Mounts in
+// the host and local mount namespaces are tracked separately, i.e. Fake
+// behaves like Linux with SeparateMountNamespaces.
+type Fake struct {
+	mutex        sync.Mutex
+	drives       map[string]*FakeDevice // only physical drives, by device path
+	devices      map[string]*FakeDevice // physical drives and mapped devices, by device path
+	mountPoints  map[MountScope][]MountPoint
+	luksMappings map[string]string // device path -> mapped device path
+	files        map[string]string
+	symlinks     map[string]string
+	owners       map[string]string
+	failures     map[fakeFailure]bool
+	driveErrors  chan []DriveError
+}
+
+// FakeDevice describes the contents of a device simulated by type Fake.
+type FakeDevice struct {
+	// SerialNumber, WWN and Model are reported by CollectDrives. Only relevant
+	// for physical drives.
+	SerialNumber string
+	WWN          string
+	Model        string
+	// Type is reported by ClassifyDevice. A FakeDevice with
+	// DeviceTypeUnreadable cannot be mapped, formatted or mounted.
+	Type DeviceType
+
+	// LUKSKeys contains the keys that open the LUKS container on this device,
+	// indexed by key slot (inactive key slots are represented by ""). Only
+	// relevant for DeviceTypeLUKS.
+	LUKSKeys []string
+	// LUKSProfile records the profile that was given to CreateLUKSContainer.
+	// Its format parameters are reported by GetLUKSHeader, and its PBKDF is
+	// reported for all key slots. Only relevant for DeviceTypeLUKS.
+	LUKSProfile LUKSProfile
+	// LUKSOpenProfile records the profile that was given to OpenLUKSContainer.
+	LUKSOpenProfile LUKSProfile
+	// LUKSContents is the device that appears when the LUKS container on this
+	// device is opened. Only relevant for DeviceTypeLUKS.
+	LUKSContents *FakeDevice
+
+	// Filesystem is reported by ClassifyDevice for DeviceTypeFilesystem. If
+	// empty, FilesystemXFS is reported. For DeviceTypeForeign, it names the
+	// signature that is reported (e.g. "lvm2").
+	Filesystem FilesystemType
+	// FormatCommand records the command that was given to FormatDevice.
+	FormatCommand []string
+	// FilesystemChecks counts the calls to CheckFilesystem for this device.
+	FilesystemChecks int
+
+	// SwiftID is the content of the swift-id file in the filesystem on this
+	// device. Only relevant for DeviceTypeFilesystem.
+	SwiftID string
+	// FilesystemUsage is reported by GetFilesystemUsage while the filesystem on
+	// this device is mounted. Only relevant for DeviceTypeFilesystem.
+	FilesystemUsage FilesystemUsage
+
+	// SMARTHealth is reported by ReadSMARTHealth. If nil, ReadSMARTHealth fails.
+	// Only relevant for physical drives.
+	SMARTHealth *parsers.SMARTHealth
+}
+
+// FakeOperation identifies a mutating operation of type Fake for the purpose
+// of failure injection.
+type FakeOperation string
+
+const (
+	// FakeFormat identifies FormatDevice().
+	FakeFormat FakeOperation = "format"
+	// FakeCheckFilesystem identifies CheckFilesystem().
+	FakeCheckFilesystem FakeOperation = "check-filesystem"
+	// FakeMount identifies MountDevice().
+	FakeMount FakeOperation = "mount"
+	// FakeUnmount identifies UnmountDevice().
+	FakeUnmount FakeOperation = "unmount"
+	// FakeRemount identifies RemountDevice().
+	FakeRemount FakeOperation = "remount"
+	// FakeCreateLUKS identifies CreateLUKSContainer().
+	FakeCreateLUKS FakeOperation = "create-luks"
+	// FakeOpenLUKS identifies OpenLUKSContainer().
+	FakeOpenLUKS FakeOperation = "open-luks"
+	// FakeCloseLUKS identifies CloseLUKSContainer().
+	FakeCloseLUKS FakeOperation = "close-luks"
+	// FakeAddLUKSKey identifies AddLUKSKey().
+	FakeAddLUKSKey FakeOperation = "add-luks-key"
+	// FakeRemoveLUKSKeySlot identifies RemoveLUKSKeySlot().
+	FakeRemoveLUKSKeySlot FakeOperation = "remove-luks-key-slot"
+	// FakeWriteSwiftID identifies WriteSwiftID().
+	FakeWriteSwiftID FakeOperation = "write-swift-id"
+)
+
+type fakeFailure struct {
+	Operation FakeOperation
+	Path      string
+}
+
+// NewFake initializes a Fake without any drives.
+func NewFake() *Fake {
+	return &Fake{
+		drives:       make(map[string]*FakeDevice),
+		devices:      make(map[string]*FakeDevice),
+		mountPoints:  make(map[MountScope][]MountPoint),
+		luksMappings: make(map[string]string),
+		files:        make(map[string]string),
+		symlinks:     make(map[string]string),
+		owners:       make(map[string]string),
+		failures:     make(map[fakeFailure]bool),
+		driveErrors:  make(chan []DriveError, 10),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// test helpers
+
+// AddDrive simulates the insertion of a physical drive. The same FakeDevice
+// may be added again after RemoveDrive() to simulate the reinsertion of a
+// drive with its previous contents.
+func (f *Fake) AddDrive(devicePath string, dev *FakeDevice) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.drives[devicePath] = dev
+	f.devices[devicePath] = dev
+}
+
+// RemoveDrive simulates the removal of a physical drive. Mounts and mappings
+// of the drive are not cleaned up automatically, same as on a real system.
+func (f *Fake) RemoveDrive(devicePath string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.drives, devicePath)
+	delete(f.devices, devicePath)
+}
+
+// InjectFailure makes all subsequent executions of the given operation on the
+// given path fail. The path is the mount path for FakeUnmount, FakeRemount and
+// FakeWriteSwiftID, the mapping name for FakeCloseLUKS, and the device path
+// for all other operations.
+func (f *Fake) InjectFailure(op FakeOperation, path string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failures[fakeFailure{op, path}] = true
+}
+
+// ClearFailure reverts a previous InjectFailure() call.
+func (f *Fake) ClearFailure(op FakeOperation, path string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.failures, fakeFailure{op, path})
+}
+
+// InjectDriveError simulates a kernel log message that will be reported by
+// CollectDriveErrors.
+func (f *Fake) InjectDriveError(devicePath, message string) {
+	f.driveErrors <- []DriveError{{DevicePath: devicePath, Message: message}}
+}
+
+// RemountReadOnly simulates a filesystem that has been remounted read-only by
+// the kernel (e.g. because of a disk error).
+func (f *Fake) RemountReadOnly(mountPath string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, scope := range []MountScope{HostScope, LocalScope} {
+		for idx, m := range f.mountPoints[scope] {
+			if m.MountPath == mountPath {
+				f.mountPoints[scope][idx].Options = map[string]bool{"ro": true}
+			}
+		}
+	}
+}
+
+// SetFilesystemUsage changes the FilesystemUsage of the device that is mounted
+// at the given path.
+func (f *Fake) SetFilesystemUsage(mountPath string, usage FilesystemUsage) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if dev := f.deviceMountedAt(mountPath); dev != nil {
+		dev.FilesystemUsage = usage
+	}
+}
+
+// ReadFile returns the contents of a file written with WriteFile().
+func (f *Fake) ReadFile(path string) (contents string, exists bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	contents, exists = f.files[path]
+	return
+}
+
+// OwnerOf returns the ownership that was set with Chown(), in the format
+// "user:group".
+func (f *Fake) OwnerOf(path string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.owners[path]
+}
+
+func (f *Fake) fails(op FakeOperation, path string) bool {
+	if f.failures[fakeFailure{op, path}] {
+		logg.Error("simulated failure: %s %s", op, path)
+		return true
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// implementation of Interface
+
+// CollectDrives implements the Interface interface.
+func (f *Fake) CollectDrives(devicePathGlobs func() []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string) {
+	knownDrives := make(map[string]bool)
+	isFirstRun := true
+
+	for range trigger {
+		globs := devicePathGlobs()
+		f.mutex.Lock()
+		existingDrives := make(map[string]Drive)
+		for devicePath, dev := range f.drives {
+			for _, pattern := range globs {
+				if ok, _ := filepath.Match(pattern, devicePath); ok {
+					existingDrives[devicePath] = Drive{
+						DevicePath:   devicePath,
+						SerialNumber: dev.SerialNumber,
+						WWN:          dev.WWN,
+						Model:        dev.Model,
+					}
+					break
+				}
+			}
+		}
+		f.mutex.Unlock()
+
+		var removedDrives []string
+		for devicePath := range knownDrives {
+			if _, exists := existingDrives[devicePath]; !exists {
+				removedDrives = append(removedDrives, devicePath)
+				delete(knownDrives, devicePath)
+			}
+		}
+		if len(removedDrives) > 0 {
+			sort.Strings(removedDrives)
+			removed <- removedDrives
+		}
+
+		var addedDrives []Drive
+		for devicePath, drive := range existingDrives {
+			if !knownDrives[devicePath] {
+				knownDrives[devicePath] = true
+				addedDrives = append(addedDrives, drive)
+			}
+		}
+		if len(addedDrives) > 0 || isFirstRun {
+			sort.Slice(addedDrives, func(i, j int) bool {
+				return addedDrives[i].DevicePath < addedDrives[j].DevicePath
+			})
+			added <- addedDrives
+		}
+		isFirstRun = false
+	}
+}
+
+// CollectDriveErrors implements the Interface interface.
+func (f *Fake) CollectDriveErrors(patterns func() KernelLogPatterns, errors chan<- []DriveError, alive chan<- bool) {
+	alive <- true
+	for errs := range f.driveErrors {
+		errors <- errs
+	}
+}
+
+// ClassifyDevice implements the Interface interface.
+func (f *Fake) ClassifyDevice(devicePath string) (DeviceType, FilesystemType) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists {
+		return DeviceTypeUnreadable, ""
+	}
+	if dev.Type == DeviceTypeForeign {
+		return dev.Type, dev.Filesystem
+	}
+	if dev.Type != DeviceTypeFilesystem {
+		return dev.Type, ""
+	}
+	if dev.Filesystem == "" {
+		return dev.Type, FilesystemXFS
+	}
+	return dev.Type, dev.Filesystem
+}
+
+// ReadSMARTHealth implements the Interface interface.
+func (f *Fake) ReadSMARTHealth(devicePath string) (parsers.SMARTHealth, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.SMARTHealth == nil {
+		return parsers.SMARTHealth{}, fmt.Errorf("cannot read SMART data from %s", devicePath)
+	}
+	return *dev.SMARTHealth, nil
+}
+
+// FormatDevice implements the Interface interface.
+func (f *Fake) FormatDevice(devicePath string, fsType FilesystemType, command []string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type == DeviceTypeUnreadable || f.fails(FakeFormat, devicePath) {
+		return false
+	}
+	*dev = FakeDevice{
+		SerialNumber:  dev.SerialNumber,
+		WWN:           dev.WWN,
+		Model:         dev.Model,
+		SMARTHealth:   dev.SMARTHealth,
+		Type:          DeviceTypeFilesystem,
+		Filesystem:    fsType,
+		FormatCommand: slices.Clone(command),
+	}
+	return true
+}
+
+// CheckFilesystem implements the Interface interface.
+func (f *Fake) CheckFilesystem(devicePath string, fsType FilesystemType, command []string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeFilesystem {
+		return false
+	}
+	dev.FilesystemChecks++
+	for _, scope := range []MountScope{HostScope, LocalScope} {
+		for _, m := range f.mountPoints[scope] {
+			if m.DevicePath == devicePath {
+				logg.Error("cannot check filesystem on %s: device is mounted at %s", devicePath, m.MountPath)
+				return false
+			}
+		}
+	}
+	return !f.fails(FakeCheckFilesystem, devicePath)
+}
+
+// MountDevice implements the Interface interface.
+func (f *Fake) MountDevice(devicePath, mountPath string, options []string, scope MountScope) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, m := range f.mountPoints[scope] {
+		if m.DevicePath == devicePath && m.MountPath == mountPath {
+			return nil
+		}
+	}
+
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeFilesystem {
+		return fmt.Errorf("cannot mount %s: expected a filesystem", devicePath)
+	}
+	if f.fails(FakeMount, devicePath) {
+		return fmt.Errorf("mount of %s to %s in %s mount namespace failed: simulated failure", devicePath, mountPath, scope)
+	}
+	f.mountPoints[scope] = append(f.mountPoints[scope], MountPoint{
+		DevicePath: devicePath,
+		MountPath:  mountPath,
+		Options:    makeOptionSet(options),
+	})
+	return nil
+}
+
+// RemountDevice implements the Interface interface.
+func (f *Fake) RemountDevice(mountPath string, options []string, scope MountScope) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fails(FakeRemount, mountPath) {
+		return fmt.Errorf("remount of %s in %s mount namespace failed: simulated failure", mountPath, scope)
+	}
+	for idx, m := range f.mountPoints[scope] {
+		if m.MountPath == mountPath {
+			f.mountPoints[scope][idx] = m.withOptions(options)
+			return nil
+		}
+	}
+	return fmt.Errorf("remount of %s in %s mount namespace failed: not mounted", mountPath, scope)
+}
+
+// UnmountDevice implements the Interface interface.
+func (f *Fake) UnmountDevice(mountPath string, scope MountScope) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fails(FakeUnmount, mountPath) {
+		return fmt.Errorf("unmount of %s in %s mount namespace failed: simulated failure", mountPath, scope)
+	}
+	f.mountPoints[scope] = slices.DeleteFunc(f.mountPoints[scope], func(m MountPoint) bool {
+		return m.MountPath == mountPath
+	})
+	return nil
+}
+
+// RefreshMountPoints implements the Interface interface.
+func (f *Fake) RefreshMountPoints() {
+	// nothing to do, mount points are always up-to-date
+}
+
+// GetMountPointsIn implements the Interface interface.
+func (f *Fake) GetMountPointsIn(mountPathPrefix string, scope MountScope) []MountPoint {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !strings.HasSuffix(mountPathPrefix, "/") {
+		mountPathPrefix += "/"
+	}
+
+	var result []MountPoint
+	for _, m := range f.mountPoints[scope] {
+		if strings.HasPrefix(m.MountPath, mountPathPrefix) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// GetMountPointsOf implements the Interface interface.
+func (f *Fake) GetMountPointsOf(devicePath string, scope MountScope) []MountPoint {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var result []MountPoint
+	for _, m := range f.mountPoints[scope] {
+		if m.DevicePath == devicePath {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// CreateLUKSContainer implements the Interface interface.
+func (f *Fake) CreateLUKSContainer(devicePath, key string, profile LUKSProfile) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type == DeviceTypeUnreadable || f.fails(FakeCreateLUKS, devicePath) {
+		return false
+	}
+	*dev = FakeDevice{
+		SerialNumber: dev.SerialNumber,
+		WWN:          dev.WWN,
+		Model:        dev.Model,
+		SMARTHealth:  dev.SMARTHealth,
+		Type:         DeviceTypeLUKS,
+		LUKSKeys:     []string{key},
+		LUKSProfile:  profile,
+		LUKSContents: &FakeDevice{Type: DeviceTypeUnknown},
+	}
+	return true
+}
+
+// OpenLUKSContainer implements the Interface interface.
+func (f *Fake) OpenLUKSContainer(devicePath, mappingName string, keys []string, profile LUKSProfile) (string, int, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeLUKS || f.fails(FakeOpenLUKS, devicePath) {
+		return "", -1, false
+	}
+	keyIndex := slices.IndexFunc(keys, func(key string) bool {
+		return key != "" && slices.Contains(dev.LUKSKeys, key)
+	})
+	if keyIndex < 0 {
+		return "", -1, false
+	}
+
+	dev.LUKSOpenProfile = profile
+	mappedDevicePath := "/dev/mapper/" + mappingName
+	f.devices[mappedDevicePath] = dev.LUKSContents
+	f.luksMappings[devicePath] = mappedDevicePath
+	return mappedDevicePath, keyIndex, true
+}
+
+// CloseLUKSContainer implements the Interface interface.
+func (f *Fake) CloseLUKSContainer(mappingName string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fails(FakeCloseLUKS, mappingName) {
+		return false
+	}
+
+	mappedDevicePath := "/dev/mapper/" + mappingName
+	for _, scope := range []MountScope{HostScope, LocalScope} {
+		for _, m := range f.mountPoints[scope] {
+			if m.DevicePath == mappedDevicePath {
+				logg.Error("cannot close %s: still mounted at %s in %s mount namespace", mappedDevicePath, m.MountPath, scope)
+				return false
+			}
+		}
+	}
+
+	delete(f.devices, mappedDevicePath)
+	for devicePath, path := range f.luksMappings {
+		if path == mappedDevicePath {
+			delete(f.luksMappings, devicePath)
+		}
+	}
+	return true
+}
+
+// RefreshLUKSMappings implements the Interface interface.
+func (f *Fake) RefreshLUKSMappings() {
+	// nothing to do, LUKS mappings are always up-to-date
+}
+
+// GetLUKSMappingOf implements the Interface interface.
+func (f *Fake) GetLUKSMappingOf(devicePath string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.luksMappings[devicePath]
+}
+
+// GetLUKSHeader implements the Interface interface.
+func (f *Fake) GetLUKSHeader(devicePath string) (parsers.LUKSHeader, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeLUKS {
+		return parsers.LUKSHeader{}, false
+	}
+
+	// for unset parameters, report the defaults of cryptsetup
+	p := dev.LUKSProfile
+	h := parsers.LUKSHeader{
+		Version:    cmp.Or(p.Version, 2),
+		Cipher:     cmp.Or(p.Cipher, "aes-xts-plain64"),
+		KeySize:    cmp.Or(p.KeySize, 512),
+		SectorSize: cmp.Or(p.SectorSize, 512),
+	}
+	for slot, key := range dev.LUKSKeys {
+		if key != "" {
+			h.KeySlots = append(h.KeySlots, parsers.LUKSKeySlot{Index: slot, PBKDF: cmp.Or(p.PBKDF, "argon2id")})
+		}
+	}
+	return h, true
+}
+
+// FindLUKSKeySlot implements the Interface interface.
+func (f *Fake) FindLUKSKeySlot(devicePath, key string) (int, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeLUKS || key == "" {
+		return -1, false
+	}
+	slot := slices.Index(dev.LUKSKeys, key)
+	return slot, slot >= 0
+}
+
+// AddLUKSKey implements the Interface interface.
+func (f *Fake) AddLUKSKey(devicePath, existingKey, newKey string, profile LUKSProfile) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeLUKS || f.fails(FakeAddLUKSKey, devicePath) {
+		return false
+	}
+	if existingKey == "" || !slices.Contains(dev.LUKSKeys, existingKey) {
+		return false
+	}
+	if slot := slices.Index(dev.LUKSKeys, ""); slot >= 0 {
+		dev.LUKSKeys[slot] = newKey
+	} else {
+		dev.LUKSKeys = append(dev.LUKSKeys, newKey)
+	}
+	return true
+}
+
+// RemoveLUKSKeySlot implements the Interface interface.
+func (f *Fake) RemoveLUKSKeySlot(devicePath string, slot int, key string) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev, exists := f.devices[devicePath]
+	if !exists || dev.Type != DeviceTypeLUKS || f.fails(FakeRemoveLUKSKeySlot, devicePath) {
+		return false
+	}
+	if slot < 0 || slot >= len(dev.LUKSKeys) || dev.LUKSKeys[slot] == "" {
+		return false
+	}
+	// the authorizing key must be in a different slot
+	otherSlot := slices.Index(dev.LUKSKeys, key)
+	if key == "" || otherSlot < 0 || otherSlot == slot {
+		return false
+	}
+	dev.LUKSKeys[slot] = ""
+	return true
+}
+
+// Returns the device that is mounted at the given path in the local mount
+// namespace (where ReadSwiftID and WriteSwiftID operate), or nil.
+func (f *Fake) deviceMountedAt(mountPath string) *FakeDevice {
+	for _, m := range f.mountPoints[LocalScope] {
+		if m.MountPath == mountPath {
+			return f.devices[m.DevicePath]
+		}
+	}
+	return nil
+}
+
+// GetFilesystemUsage implements the Interface interface.
+func (f *Fake) GetFilesystemUsage(mountPath string) (FilesystemUsage, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev := f.deviceMountedAt(mountPath)
+	if dev == nil {
+		return FilesystemUsage{}, fmt.Errorf("statfs %s: no filesystem mounted at %s", mountPath, mountPath)
+	}
+	return dev.FilesystemUsage, nil
+}
+
+// ReadSwiftID implements the Interface interface.
+func (f *Fake) ReadSwiftID(mountPath string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev := f.deviceMountedAt(mountPath)
+	if dev == nil {
+		return "", nil
+	}
+	return dev.SwiftID, nil
+}
+
+// WriteSwiftID implements the Interface interface.
+func (f *Fake) WriteSwiftID(mountPath, swiftID string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	dev := f.deviceMountedAt(mountPath)
+	if dev == nil {
+		return fmt.Errorf("write %s/swift-id: no filesystem mounted at %s", mountPath, mountPath)
+	}
+	if f.fails(FakeWriteSwiftID, mountPath) {
+		return fmt.Errorf("write %s/swift-id: simulated failure", mountPath)
+	}
+	dev.SwiftID = swiftID
+	return nil
+}
+
+// Chown implements the Interface interface.
+func (f *Fake) Chown(path, owner, group string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.owners[path] = owner + ":" + group
+}
+
+// ReadSymlink implements the Interface interface.
+func (f *Fake) ReadSymlink(path string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	target, exists := f.symlinks[path]
+	if !exists {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrNotExist}
+	}
+	return target, nil
+}
+
+// CreateSymlink implements the Interface interface.
+func (f *Fake) CreateSymlink(path, target string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.files, path)
+	f.symlinks[path] = target
+	return nil
+}
+
+// RemoveFile implements the Interface interface.
+func (f *Fake) RemoveFile(path string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.files, path)
+	delete(f.symlinks, path)
+	return nil
+}
+
+// WriteFile implements the Interface interface.
+func (f *Fake) WriteFile(path string, contents []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.symlinks, path)
+	f.files[path] = string(contents)
+	return nil
+}
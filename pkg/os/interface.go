@@ -3,6 +3,12 @@
 
 package os
 
+import (
+	"maps"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
 // Interface describes the set of OS-level operations that can be executed by
 // the autopilot. The default implementation for production is struct Linux in
 // this package.
@@ -15,24 +21,47 @@ package os
 type Interface interface {
 	// CollectDrives is run in a separate goroutine and reports drives as they are
 	// added or removed. (When first started, all existing drives shall be
-	// reported as "added".) It shall not return. The `trigger` channel is used by
-	// the caller to trigger each work cycle of CollectDrives.
-	CollectDrives(devicePathGlobs []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string)
+	// reported as "added", even if there are none, i.e. the first work cycle
+	// always sends on `added`.) It shall not return. The `trigger` channel is used by
+	// the caller to trigger each work cycle of CollectDrives. The
+	// `devicePathGlobs` callback is invoked at the start of each work cycle, so
+	// that the set of globs can change at runtime.
+	CollectDrives(devicePathGlobs func() []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string)
 	// CollectDriveErrors is run in a separate goroutine and reports drive errors
-	// that are observed in the kernel log. It shall not return.
-	CollectDriveErrors(errors chan<- []DriveError)
+	// that are observed in the kernel log. The `patterns` callback is invoked for
+	// each kernel log line, so that the set of patterns can change at runtime.
+	// Whenever reading the kernel log starts or stops working, this is reported
+	// through the `alive` channel. It shall not return.
+	CollectDriveErrors(patterns func() KernelLogPatterns, errors chan<- []DriveError, alive chan<- bool)
 
 	// ClassifyDevice examines the contents of the given device to detect existing
-	// LUKS containers or filesystems.
-	ClassifyDevice(devicePath string) DeviceType
-	// FormatDevice creates an XFS filesystem on this device. Existing containers
-	// or filesystems will be overwritten.
-	FormatDevice(devicePath string) (ok bool)
-
-	// MountDevice mounts this device at the given location.
-	MountDevice(devicePath, mountPath string, scope MountScope) (ok bool)
+	// LUKS containers or filesystems. For DeviceTypeFilesystem, the type of
+	// filesystem is reported as well (or "" if it cannot be determined). For
+	// DeviceTypeForeign, the second return value names the signature that was
+	// found (e.g. "lvm2" or "gpt"), or "unrecognized data" if the device contains
+	// data without any known signature.
+	ClassifyDevice(devicePath string) (DeviceType, FilesystemType)
+	// FormatDevice creates a filesystem of the given type on this device by
+	// running the given mkfs command with the device path appended. Existing
+	// containers or filesystems will be overwritten.
+	FormatDevice(devicePath string, fsType FilesystemType, command []string) (ok bool)
+	// CheckFilesystem checks the filesystem of the given type on this device by
+	// running the given read-only check command (e.g. `xfs_repair -n`) with the
+	// device path appended. The device must not be mounted. Any problems that
+	// are found are logged.
+	CheckFilesystem(devicePath string, fsType FilesystemType, command []string) (ok bool)
+	// ReadSMARTHealth reads the SMART health indicators of the given drive.
+	// This may be called concurrently with all other methods.
+	ReadSMARTHealth(devicePath string) (parsers.SMARTHealth, error)
+
+	// MountDevice mounts this device at the given location, using the given
+	// mount options (e.g. "noatime"). The mount point is created if necessary.
+	MountDevice(devicePath, mountPath string, options []string, scope MountScope) error
+	// RemountDevice remounts the device that is mounted at the given location,
+	// in order to add the given mount options to it.
+	RemountDevice(mountPath string, options []string, scope MountScope) error
 	// UnmountDevice unmounts the device that is mounted at the given location.
-	UnmountDevice(mountPath string, scope MountScope) (ok bool)
+	UnmountDevice(mountPath string, scope MountScope) error
 	// RefreshMountPoints examines the system to find any mounts that have changed
 	// since we last looked.
 	RefreshMountPoints()
@@ -40,13 +69,18 @@ type Interface interface {
 	GetMountPointsIn(mountPathPrefix string, scope MountScope) []MountPoint
 	// GetMountPointsOf returns all active mount points for this device.
 	GetMountPointsOf(devicePath string, scope MountScope) []MountPoint
+	// GetFilesystemUsage returns the capacity and usage of the filesystem that
+	// is mounted at the given location in the local mount namespace.
+	GetFilesystemUsage(mountPath string) (FilesystemUsage, error)
 
 	// CreateLUKSContainer creates a LUKS container on the given device, using the
-	// given encryption key. Existing data on the device will be overwritten.
-	CreateLUKSContainer(devicePath, key string) (ok bool)
-	// OpenLUKSContainer opens the LUKS container on the given device. The given
-	// keys are tried in order until one works.
-	OpenLUKSContainer(devicePath, mappingName string, keys []string) (mappedDevicePath string, ok bool)
+	// given encryption key and the format parameters from the given profile.
+	// Existing data on the device will be overwritten.
+	CreateLUKSContainer(devicePath, key string, profile LUKSProfile) (ok bool)
+	// OpenLUKSContainer opens the LUKS container on the given device, using the
+	// activation flags from the given profile. The given keys are tried in order
+	// until one works. The index of the key that worked is returned.
+	OpenLUKSContainer(devicePath, mappingName string, keys []string, profile LUKSProfile) (mappedDevicePath string, keyIndex int, ok bool)
 	// CloseLUKSContainer closes the LUKS container with the given mapping name.
 	CloseLUKSContainer(mappingName string) (ok bool)
 	// RefreshLUKSMappings examines the system to find any LUKS mappings that have
@@ -55,6 +89,19 @@ type Interface interface {
 	// GetLUKSMappingOf returns the device path of the active LUKS mapping for
 	// this device, or "" if no such mapping exists.
 	GetLUKSMappingOf(devicePath string) (mappedDevicePath string)
+	// GetLUKSHeader returns the header (including all active key slots) of the
+	// LUKS container on the given device.
+	GetLUKSHeader(devicePath string) (header parsers.LUKSHeader, ok bool)
+	// FindLUKSKeySlot returns the number of the key slot that can be unlocked
+	// with the given key, or ok = false if the key does not unlock any slot.
+	FindLUKSKeySlot(devicePath, key string) (slot int, ok bool)
+	// AddLUKSKey adds newKey to a free key slot of the LUKS container on the
+	// given device, using the key slot parameters from the given profile. The
+	// existingKey must unlock one of the active key slots.
+	AddLUKSKey(devicePath, existingKey, newKey string, profile LUKSProfile) (ok bool)
+	// RemoveLUKSKeySlot wipes the given key slot of the LUKS container on the
+	// given device. The given key must unlock one of the other key slots.
+	RemoveLUKSKeySlot(devicePath string, slot int, key string) (ok bool)
 
 	// ReadSwiftID returns the swift-id in this directory, or an empty string if
 	// the file does not exist.
@@ -65,6 +112,19 @@ type Interface interface {
 	// contain a name or an ID (as decimal integer literal) or be empty (to leave
 	// that field unchanged).
 	Chown(path, owner, group string)
+
+	// ReadSymlink returns the target of the symlink at the given path. If the
+	// symlink does not exist, an error satisfying os.IsNotExist() is returned.
+	ReadSymlink(path string) (target string, err error)
+	// CreateSymlink creates a symlink at the given path pointing to the given
+	// target, replacing any existing file at that path (like `ln -sfT`).
+	CreateSymlink(path, target string) error
+	// RemoveFile removes the file at the given path. It is not an error if the
+	// file does not exist.
+	RemoveFile(path string) error
+	// WriteFile writes the given contents into the file at the given path,
+	// replacing any existing contents.
+	WriteFile(path string, contents []byte) error
 }
 
 // Drive contains information about a drive as detected by the OS.
@@ -72,8 +132,40 @@ type Drive struct {
 	DevicePath   string
 	FoundAtPath  string // only used in log messages
 	SerialNumber string
+	WWN          string // may be empty if not known
+	Model        string // may be empty if not known
 }
 
+// SerialNumberSource identifies a method for finding the serial number of a
+// drive. The sources are tried in the order given in the configuration, and
+// the first serial number that is found becomes the DriveID.
+type SerialNumberSource string
+
+const (
+	// SerialFromSysfs reads the serial number from sysfs, i.e. from the Unit
+	// Serial Number VPD page of SCSI drives, or from the NVMe identify data.
+	SerialFromSysfs SerialNumberSource = "sysfs-serial"
+	// SerialFromUdev reads the ID_SERIAL_SHORT (or, if missing, ID_SERIAL)
+	// property from the udev database.
+	SerialFromUdev SerialNumberSource = "udev-serial"
+	// WWNFromSysfs uses the WWID from sysfs as the serial number.
+	WWNFromSysfs SerialNumberSource = "sysfs-wwid"
+	// WWNFromUdev uses the ID_WWN property from the udev database as the
+	// serial number.
+	WWNFromUdev SerialNumberSource = "udev-wwn"
+	// SerialFromSmartctl runs `smartctl -i` and reads the serial number from its
+	// output. This requires smartctl to be installed in the autopilot's container.
+	SerialFromSmartctl SerialNumberSource = "smartctl"
+)
+
+// AllSerialNumberSources lists all possible values of type SerialNumberSource.
+var AllSerialNumberSources = []SerialNumberSource{SerialFromSysfs, SerialFromUdev, WWNFromSysfs, WWNFromUdev, SerialFromSmartctl}
+
+// DefaultSerialNumberSources is used unless configured otherwise. The WWN
+// sources are not included by default since drives would get a different
+// DriveID than with previous versions if the other sources fail for them.
+var DefaultSerialNumberSources = []SerialNumberSource{SerialFromSysfs, SerialFromUdev, SerialFromSmartctl}
+
 // DriveError represents a drive error that was found e.g. in a kernel log.
 type DriveError struct {
 	DevicePath string
@@ -85,8 +177,10 @@ type DriveError struct {
 type DeviceType int
 
 const (
-	// DeviceTypeUnknown describes a device that is readable, but contains neither
-	// a LUKS container nor a filesystem.
+	// DeviceTypeUnknown describes a device that is readable and blank, i.e. it
+	// does not contain any data where signatures would be (or it is the
+	// contents of a LUKS container without any known signature). Only devices
+	// of this type are formatted.
 	DeviceTypeUnknown DeviceType = iota
 	// DeviceTypeUnreadable is returned by ClassifyDevice() when the device is
 	// unreadable.
@@ -96,6 +190,23 @@ const (
 	// DeviceTypeFilesystem describes a device that contains an admissible
 	// filesystem.
 	DeviceTypeFilesystem
+	// DeviceTypeForeign describes a device that contains neither a LUKS
+	// container nor a filesystem, but some other known signature (e.g. a
+	// partition table or an LVM physical volume) or data without any known
+	// signature. Such devices are neither formatted nor mounted.
+	DeviceTypeForeign
+)
+
+// FilesystemType describes the type of filesystem on a device with
+// DeviceTypeFilesystem. Filesystems not listed below are reported by the name
+// that package prober gives them (e.g. "ext3" or "btrfs").
+type FilesystemType string
+
+const (
+	// FilesystemXFS is the FilesystemType for XFS. This is the default.
+	FilesystemXFS FilesystemType = "xfs"
+	// FilesystemExt4 is the FilesystemType for ext4.
+	FilesystemExt4 FilesystemType = "ext4"
 )
 
 // MountPoint describes an active mount point that is present on the system.
@@ -103,6 +214,61 @@ type MountPoint struct {
 	DevicePath string
 	MountPath  string
 	Options    map[string]bool
+	// MountID and DeviceNumber (as "major:minor") are taken from the mount
+	// table. They are only filled by type Linux.
+	MountID      int
+	DeviceNumber string
+}
+
+// FilesystemUsage describes the capacity and usage of a mounted filesystem, as
+// reported by statfs(2). Like in `df`, FreeBytes only counts the space that is
+// available to unprivileged users, so UsedBytes and FreeBytes may not add up
+// to TotalBytes.
+type FilesystemUsage struct {
+	TotalBytes  uint64
+	FreeBytes   uint64
+	UsedBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+// Returns the Options for a new MountPoint that was mounted with the given
+// mount options.
+func makeOptionSet(options []string) map[string]bool {
+	result := map[string]bool{"rw": true}
+	for _, option := range options {
+		result[option] = true
+	}
+	return result
+}
+
+// Returns a copy of this MountPoint with the given options added. (The
+// Options map is not modified in place since other copies of this MountPoint
+// may refer to it.)
+func (m MountPoint) withOptions(options []string) MountPoint {
+	if len(options) == 0 {
+		return m
+	}
+	newOptions := make(map[string]bool, len(m.Options)+len(options))
+	maps.Copy(newOptions, m.Options)
+	for _, option := range options {
+		newOptions[option] = true
+	}
+	m.Options = newOptions
+	return m
+}
+
+// MissingOptions returns those of the given mount options that are not active
+// on this mount point. Options that are only meaningful to userspace (e.g.
+// "nofail") are never reported as missing since the kernel does not know them.
+func (m MountPoint) MissingOptions(options []string) []string {
+	var result []string
+	for _, option := range options {
+		if !m.Options[option] && !isUserspaceMountOption(option) {
+			result = append(result, option)
+		}
+	}
+	return result
 }
 
 // MountScope describes whether a mount happens in the autopilot's mount
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"regexp"
+)
+
+// KernelLogPatterns describes which lines in the kernel log are reported as
+// drive errors by CollectDriveErrors.
+type KernelLogPatterns struct {
+	// A line is reported if it matches any of the ErrorPatterns and none of the
+	// IgnorePatterns.
+	ErrorPatterns  []*regexp.Regexp
+	IgnorePatterns []*regexp.Regexp
+	// The name of the affected device (e.g. "sda") is taken from the first
+	// capture group of the matching error pattern. If the error pattern does
+	// not have any capture groups, the first capture group of the first
+	// matching DevicePattern is used instead.
+	DevicePatterns []*regexp.Regexp
+}
+
+// DefaultKernelLogPatterns returns the KernelLogPatterns that are used unless
+// configured otherwise.
+func DefaultKernelLogPatterns() KernelLogPatterns {
+	return KernelLogPatterns{
+		ErrorPatterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\b(?:error|metadata corruption detected|unmount and run xfs_repair)\b`),
+			// NVMe controller failures, e.g. "nvme nvme0: I/O 828 QID 2 timeout, aborting"
+			regexp.MustCompile(`(?i)\bnvme\d+: (?:I/O \d+ QID \d+ timeout|controller is down|removing after probe failure|device not ready)`),
+		},
+		DevicePatterns: []*regexp.Regexp{
+			regexp.MustCompile(`\b(sd[a-z]{1,2})\b`),
+			regexp.MustCompile(`\b(nvme\d+n\d+(?:p\d+)?)\b`),
+			// NVMe controllers (errors are reported for all namespaces of the
+			// controller, see isNVMeController)
+			regexp.MustCompile(`\b(nvme\d+)\b`),
+		},
+	}
+}
+
+// Partitions are reported as errors on the whole disk, e.g. "sda1" -> "sda"
+// or "nvme0n1p1" -> "nvme0n1". (The default patterns of swift-drive-audit
+// match partition names.)
+var partitionNameRx = regexp.MustCompile(`^(?:(sd[a-z]+)\d+|(nvme\d+n\d+|mmcblk\d+)p\d+)$`)
+
+var nvmeControllerPathRx = regexp.MustCompile(`^/dev/nvme\d+$`)
+
+// isNVMeController returns whether the given DriveError.DevicePath refers to
+// an NVMe controller (e.g. "/dev/nvme0") rather than a block device. Errors on
+// a controller affect all of its namespaces (e.g. "/dev/nvme0n1").
+func isNVMeController(devicePath string) bool {
+	return nvmeControllerPathRx.MatchString(devicePath)
+}
+
+// Match checks whether the given kernel log line reports a drive error. If
+// so, the DriveError is returned.
+func (p KernelLogPatterns) Match(line string) *DriveError {
+	for _, rx := range p.ErrorPatterns {
+		match := rx.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		for _, ignoreRx := range p.IgnorePatterns {
+			if ignoreRx.MatchString(line) {
+				return nil
+			}
+		}
+
+		var deviceName string
+		if len(match) > 1 {
+			deviceName = match[1]
+		} else {
+			for _, deviceRx := range p.DevicePatterns {
+				if match := deviceRx.FindStringSubmatch(line); len(match) > 1 {
+					deviceName = match[1]
+					break
+				}
+			}
+		}
+		if deviceName == "" {
+			continue
+		}
+		if match := partitionNameRx.FindStringSubmatch(deviceName); match != nil {
+			deviceName = match[1] + match[2] // only one of them is non-empty
+		}
+		return &DriveError{
+			DevicePath: "/dev/" + deviceName,
+			Message:    line,
+		}
+	}
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/sapcc/go-bits/logg"
 
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
 	"github.com/sapcc/swift-drive-autopilot/pkg/util"
 )
 
@@ -20,11 +21,33 @@ type Linux struct {
 	ActiveMountPoints    map[MountScope][]MountPoint
 	ActiveLUKSMappings   map[string]string
 	MountPropagationMode MountPropagationMode
+	SerialNumberSources  []SerialNumberSource
+	// IgnoredMountPaths contains paths below which mount points are not
+	// considered (e.g. because they have been duplicated by a container runtime).
+	IgnoredMountPaths []string
+	// chrootPath is the absolute path of the chroot directory in our own mount
+	// namespace.
+	chrootPath string
+}
+
+// DefaultIgnoredMountPaths is the default for Linux.IgnoredMountPaths. Mount
+// points below these paths are usually duplicates that container runtimes
+// create when passing volumes into containers.
+var DefaultIgnoredMountPaths = []string{
+	"/var/lib/docker",
+	"/var/lib/rkt",
+	"/var/lib/kubelet",
 }
 
 // NewLinux initializes the OS interface for Linux.
-func NewLinux() (*Linux, error) {
-	mpm, err := detectMountPropagationMode()
+func NewLinux(serialNumberSources []SerialNumberSource, ignoredMountPaths []string) (*Linux, error) {
+	chrootPath, err := sys_os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine chroot directory: %s", err.Error())
+	}
+	chrootPath = filepath.Clean(chrootPath)
+
+	mpm, err := detectMountPropagationMode(chrootPath)
 	if err != nil {
 		return nil, fmt.Errorf("mount propagation detection failed: %s", err.Error())
 	}
@@ -34,6 +57,9 @@ func NewLinux() (*Linux, error) {
 
 	return &Linux{
 		MountPropagationMode: mpm,
+		SerialNumberSources:  serialNumberSources,
+		IgnoredMountPaths:    ignoredMountPaths,
+		chrootPath:           chrootPath,
 	}, nil
 }
 
@@ -72,12 +98,7 @@ const (
 	SeparateMountNamespaces = "separate"
 )
 
-func detectMountPropagationMode() (MountPropagationMode, error) {
-	chrootPath, err := sys_os.Getwd()
-	if err != nil {
-		return "", err
-	}
-	chrootPath = filepath.Clean(chrootPath)
+func detectMountPropagationMode(chrootPath string) (MountPropagationMode, error) {
 	if chrootPath == "/" {
 		return OneMountNamespace, nil
 	}
@@ -86,35 +107,20 @@ func detectMountPropagationMode() (MountPropagationMode, error) {
 	if err != nil {
 		return "", err
 	}
+	mounts, err := parsers.ParseMountInfo(string(buf))
+	if err != nil {
+		return "", err
+	}
 
-	// parse mountinfo; format is documented at
-	// <https://www.kernel.org/doc/Documentation/filesystems/proc.txt>
-	for line := range strings.SplitSeq(string(buf), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// find the bind-mount for the chrootPath
-		fields := strings.Fields(line)
-		if filepath.Clean(fields[4]) != chrootPath {
+	// find the bind-mount for the chrootPath
+	for _, m := range mounts {
+		if filepath.Clean(m.MountPoint) != chrootPath {
 			continue
 		}
-
 		// check the optional fields on the chroot's bind-mount
-		for idx := 6; fields[idx] != "-"; idx++ {
-			field := fields[idx]
-			if strings.HasPrefix(field, "shared:") {
-				return ConnectedMountNamespaces, nil
-			}
-			if strings.HasPrefix(field, "master:") { // indicates (r)slave mount propagation
-				return ConnectedMountNamespaces, nil
-			}
-			if strings.HasPrefix(field, "propagate_from:") {
-				return ConnectedMountNamespaces, nil
-			}
+		if m.HasPropagation() {
+			return ConnectedMountNamespaces, nil
 		}
-
 		// no evidence for connected mount namespaces
 		return SeparateMountNamespaces, nil
 	}
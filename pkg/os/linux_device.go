@@ -4,39 +4,85 @@
 package os
 
 import (
+	"io"
+	"maps"
+	"os"
+	"slices"
 	"strings"
 
+	"github.com/sapcc/go-bits/logg"
+
 	"github.com/sapcc/swift-drive-autopilot/pkg/command"
+	"github.com/sapcc/swift-drive-autopilot/pkg/prober"
 )
 
 // ClassifyDevice implements the Interface interface.
-func (l *Linux) ClassifyDevice(devicePath string) DeviceType {
-	// ask file(1) to identify the contents of this device
-	//BUT: do not run file(1) in the chroot (e.g. CoreOS does not have file(1))
-	relDevicePath := strings.TrimPrefix(devicePath, "/")
-	desc, ok := command.Command{
-		NoChroot: true,
-	}.Run("file", "-bLs", relDevicePath)
-	if !ok {
-		return DeviceTypeUnreadable
+func (l *Linux) ClassifyDevice(devicePath string) (DeviceType, FilesystemType) {
+	result, err := probeDevice(devicePath)
+	if err != nil {
+		logg.Error("cannot examine contents of %s: %s", devicePath, err.Error())
+		return DeviceTypeUnreadable, ""
+	}
+
+	// the contents of a LUKS container that was never written to are not zero,
+	// but consist of whatever the underlying data decrypts to
+	isLUKSContents := slices.Contains(slices.Collect(maps.Values(l.ActiveLUKSMappings)), devicePath)
+	if isLUKSContents && result.Type == prober.TypeNone {
+		return DeviceTypeUnknown, ""
 	}
 
-	// convert into DeviceType
+	deviceType := classifyProbeResult(result)
 	switch {
-	case strings.HasPrefix(desc, "LUKS encrypted file"):
+	case deviceType == DeviceTypeForeign && result.Type == prober.TypeNone:
+		return deviceType, "unrecognized data"
+	case deviceType == DeviceTypeFilesystem, deviceType == DeviceTypeForeign:
+		return deviceType, FilesystemType(result.Type)
+	default:
+		return deviceType, ""
+	}
+}
+
+func classifyProbeResult(result prober.Result) DeviceType {
+	switch {
+	case result.Type == prober.TypeNone && result.Blank:
+		return DeviceTypeUnknown
+	case result.Type == prober.TypeNone:
+		// the device may contain valuable data in a format that we do not know
+		return DeviceTypeForeign
+	case result.Type.IsLUKS():
 		return DeviceTypeLUKS
-	case strings.Contains(desc, "filesystem data"):
+	case result.Type.IsFilesystem():
 		return DeviceTypeFilesystem
 	default:
-		return DeviceTypeUnknown
+		// partition tables, LVM, mdraid etc.
+		return DeviceTypeForeign
 	}
 }
 
+// Looks for known signatures on the given device.
+func probeDevice(devicePath string) (prober.Result, error) {
+	// make path relative to current directory (== chroot directory)
+	file, err := os.Open(strings.TrimPrefix(devicePath, "/"))
+	if err != nil {
+		return prober.Result{}, err
+	}
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return prober.Result{}, err
+	}
+	return prober.Probe(file, size)
+}
+
 // FormatDevice implements the Interface interface.
-func (l *Linux) FormatDevice(devicePath string) bool {
-	//TODO: remove `-f` (currently needed to work around
-	//https://github.com/karelzak/util-linux/issues/1159 until Flatcar updates
-	// util-linux to 2.36 or newer
-	_, ok := command.Run("mkfs.xfs", "-f", devicePath)
+func (l *Linux) FormatDevice(devicePath string, fsType FilesystemType, cmd []string) bool {
+	_, ok := command.Run(append(slices.Clone(cmd), devicePath)...)
+	return ok
+}
+
+// CheckFilesystem implements the Interface interface.
+func (l *Linux) CheckFilesystem(devicePath string, fsType FilesystemType, cmd []string) bool {
+	_, ok := command.Run(append(slices.Clone(cmd), devicePath)...)
 	return ok
 }
@@ -16,23 +16,17 @@ import (
 	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
 )
 
-// When a drive has a partition table, there will be a line like "Disklabel
-// type: gpt" in the output of `sfdisk -l`. For unpartitioned devices, this line
-// is missing.
-var driveWithPartitionTableRx = regexp.MustCompile(`(?mi)^Disklabel type`)
-
-// This is used to extract a drive's serial number from `smartctl -i`.
-var serialNumberRx = regexp.MustCompile(`(?m)^Serial number:\s*(\S+)\s*$`)
-
 // CollectDrives implements the Interface interface.
-func (l *Linux) CollectDrives(devicePathGlobs []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string) {
+func (l *Linux) CollectDrives(devicePathGlobs func() []string, trigger <-chan struct{}, added chan<- []Drive, removed chan<- []string) {
 	knownDrives := make(map[string]string)
+	isFirstRun := true
 
 	// work loop
 	for range trigger {
 		// expand globs to find drives
+		globs := devicePathGlobs()
 		existingDrives := make(map[string]string)
-		for _, pattern := range devicePathGlobs {
+		for _, pattern := range globs {
 			// make pattern relative to current directory (== chroot directory)
 			pattern = strings.TrimPrefix(pattern, "/")
 
@@ -53,7 +47,7 @@ func (l *Linux) CollectDrives(devicePathGlobs []string, trigger <-chan struct{},
 		// (https://github.com/sapcc/swift-drive-autopilot/issues/23)
 		if len(existingDrives) == 0 {
 			logg.Fatal("no drives found matching the configured patterns: %s",
-				strings.Join(devicePathGlobs, ", "),
+				strings.Join(globs, ", "),
 			)
 		}
 
@@ -80,16 +74,18 @@ func (l *Linux) CollectDrives(devicePathGlobs []string, trigger <-chan struct{},
 			}
 			knownDrives[globbedPath] = devicePath
 
-			// ignore devices with partitions
-			stdout, _ := command.Command{ExitOnError: false}.Run("sfdisk", "-l", devicePath)
+			// ignore devices with partitions or other foreign signatures
+			probeResult, err := probeDevice(devicePath)
 			switch {
-			case driveWithPartitionTableRx.MatchString(stdout):
+			case err == nil && probeResult.Type.IsPartitionTable():
 				logg.Info("ignoring drive %s because it contains partitions", devicePath)
-			case strings.TrimSpace(stdout) == "":
-				// if `sfdisk -l` does not print anything at all, then the device is
-				// not readable and should be ignored (e.g. on some servers, we have
-				///dev/sdX which is a KVM remote volume that's usually not
-				// accessible, i.e. open() fails with ENOMEDIUM; we want to ignore those)
+			case err == nil && classifyProbeResult(probeResult) == DeviceTypeForeign:
+				logg.Info("ignoring drive %s because it contains %s", devicePath, probeResult)
+			case err != nil:
+				// if the device cannot be read, it should be ignored (e.g. on some
+				// servers, we have /dev/sdX which is a KVM remote volume that's usually
+				// not accessible, i.e. open() fails with ENOMEDIUM; we want to ignore
+				// those)
 				//
 				// HOWEVER If the problem is an IO error and the drive has a LUKS
 				// container already opened from before the IO error, we can see that in
@@ -105,35 +101,27 @@ func (l *Linux) CollectDrives(devicePathGlobs []string, trigger <-chan struct{},
 					}
 					addedDrives = append(addedDrives, drive)
 				}
-				logg.Info("ignoring drive %s because it is not readable", devicePath)
+				logg.Info("ignoring drive %s because it is not readable: %s", devicePath, err.Error())
 			default:
-				// drive is eligible -> find serial number and report it
+				// drive is eligible -> find serial number etc. and report it
 				drive := Drive{
 					DevicePath:  devicePath,
 					FoundAtPath: globbedPath,
 				}
-
-				// read serial number using smartctl (using the relative path and skipping
-				// nsenter and chroot here since the host may not have smartctl in its PATH)
-				relDevicePath := strings.TrimPrefix(devicePath, "/")
-				stdout, ok := command.Command{SkipLog: true, NoChroot: true, NoNsenter: true}.Run("smartctl", "-d", "scsi", "-i", relDevicePath)
-				if ok {
-					match := serialNumberRx.FindStringSubmatch(stdout)
-					if match != nil {
-						drive.SerialNumber = sanitizeSerialNumber(match[1])
-					}
-				}
-
+				l.readDriveIdentity(&drive)
 				addedDrives = append(addedDrives, drive)
 			}
 		}
 
-		if len(addedDrives) > 0 {
+		// on the first run, report even if there are no eligible drives, so that
+		// the caller knows that the initial scan is complete
+		if len(addedDrives) > 0 || isFirstRun {
 			sort.Slice(addedDrives, func(i, j int) bool { // test needs to be deterministic
 				return addedDrives[i].DevicePath < addedDrives[j].DevicePath
 			})
 			added <- addedDrives
 		}
+		isFirstRun = false
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/sapcc/go-bits/logg"
+	"golang.org/x/sys/unix"
 
 	"github.com/sapcc/swift-drive-autopilot/pkg/command"
 )
@@ -37,6 +38,25 @@ func swiftIDPathIn(mountPath string) string {
 	return strings.TrimPrefix(path, "/")
 }
 
+// GetFilesystemUsage implements the Interface interface.
+func (l *Linux) GetFilesystemUsage(mountPath string) (FilesystemUsage, error) {
+	var st unix.Statfs_t
+	// make path relative to working directory to account for chrootPath
+	err := unix.Statfs(strings.TrimPrefix(mountPath, "/"), &st)
+	if err != nil {
+		return FilesystemUsage{}, &os.PathError{Op: "statfs", Path: mountPath, Err: err}
+	}
+
+	blockSize := uint64(st.Frsize) //nolint:gosec // block size is never negative
+	return FilesystemUsage{
+		TotalBytes:  st.Blocks * blockSize,
+		FreeBytes:   st.Bavail * blockSize,
+		UsedBytes:   (st.Blocks - st.Bfree) * blockSize,
+		TotalInodes: st.Files,
+		FreeInodes:  st.Ffree,
+	}, nil
+}
+
 // Chown implements the Interface interface.
 func (l *Linux) Chown(path, user, group string) {
 	var (
@@ -64,3 +84,34 @@ func (l *Linux) Chown(path, user, group string) {
 	logg.Debug("%s %s to %s", cmd, path, arg)
 	command.Run(cmd, arg, path)
 }
+
+// ReadSymlink implements the Interface interface.
+func (l *Linux) ReadSymlink(path string) (string, error) {
+	return os.Readlink(strings.TrimPrefix(path, "/"))
+}
+
+// CreateSymlink implements the Interface interface.
+func (l *Linux) CreateSymlink(path, target string) error {
+	// make path relative to working directory to account for chrootPath
+	path = strings.TrimPrefix(path, "/")
+
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// RemoveFile implements the Interface interface.
+func (l *Linux) RemoveFile(path string) error {
+	err := os.Remove(strings.TrimPrefix(path, "/"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// WriteFile implements the Interface interface.
+func (l *Linux) WriteFile(path string, contents []byte) error {
+	return os.WriteFile(strings.TrimPrefix(path, "/"), contents, 0644)
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"cmp"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/command"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// This matches device paths of NVMe namespaces, e.g. "/dev/nvme0n1".
+var nvmeNamespacePathRx = regexp.MustCompile(`^/dev/nvme\d+n\d+$`)
+
+// Fills the SerialNumber, WWN and Model fields of the given drive. The serial
+// number is taken from the first of l.SerialNumberSources that knows it.
+func (l *Linux) readDriveIdentity(drive *Drive) {
+	// make path relative to current directory (== chroot directory)
+	sysPath := "sys/block/" + strings.TrimPrefix(drive.DevicePath, "/dev/")
+	isNVMe := nvmeNamespacePathRx.MatchString(drive.DevicePath)
+	udevProperties := readUdevProperties(sysPath)
+
+	for _, source := range l.SerialNumberSources {
+		var serial string
+		switch source {
+		case SerialFromSysfs:
+			serial = readSysfsSerialNumber(sysPath, isNVMe)
+		case SerialFromUdev:
+			serial = cmp.Or(udevProperties["ID_SERIAL_SHORT"], udevProperties["ID_SERIAL"])
+		case WWNFromSysfs:
+			serial = readSysfsWWID(sysPath)
+		case WWNFromUdev:
+			serial = udevProperties["ID_WWN"]
+		case SerialFromSmartctl:
+			serial = readSmartctlSerialNumber(drive.DevicePath, isNVMe)
+		}
+		if serial == "" {
+			continue
+		}
+
+		// older versions read the serial number of SCSI/SATA drives only from
+		// `smartctl -i`, which does not work when it contains whitespace, so these
+		// drives were identified by the fallback ID; to keep their DriveID stable
+		// (it is used for LUKS mappings, mount paths and broken flags), we do not
+		// use their serial number now either
+		if source == SerialFromSysfs && !isNVMe && !parsers.SmartctlCanReportSerialNumber(serial) {
+			logg.Info("not using serial number %q of %s since it contains whitespace (for compatibility with earlier versions)", serial, drive.DevicePath)
+			break
+		}
+
+		// NVMe namespaces do not have a serial number of their own, so we get the
+		// serial number of the controller (or of the subsystem, when native NVMe
+		// multipathing is used). Since all namespaces of a controller share that
+		// serial number, the namespace ID is appended for all namespaces except
+		// the first one. (WWIDs are unique per namespace, so they can be used as-is.)
+		if isNVMe && (source == SerialFromSysfs || source == SerialFromUdev || source == SerialFromSmartctl) {
+			nsid := readSysfsAttribute(sysPath + "/nsid")
+			if nsid != "" && nsid != "1" {
+				serial += "_n" + nsid
+			}
+		}
+
+		drive.SerialNumber = sanitizeSerialNumber(serial)
+		logg.Debug("serial number of %s is %s (from %s)", drive.DevicePath, drive.SerialNumber, source)
+		break
+	}
+
+	drive.WWN = cmp.Or(readSysfsWWID(sysPath), udevProperties["ID_WWN"])
+	drive.Model = cmp.Or(readSysfsAttribute(sysPath+"/device/model"), udevProperties["ID_MODEL"])
+}
+
+// Reads the given file in sysfs and returns its contents without surrounding
+// whitespace, or "" if it cannot be read.
+func readSysfsAttribute(path string) string {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+func readSysfsSerialNumber(sysPath string, isNVMe bool) string {
+	if isNVMe {
+		return readSysfsAttribute(sysPath + "/device/serial")
+	}
+
+	buf, err := os.ReadFile(sysPath + "/device/vpd_pg80")
+	if err == nil {
+		serial, err := parsers.ParseSCSIUnitSerialNumber(buf)
+		if err == nil {
+			return serial
+		}
+		logg.Debug("cannot parse %s/device/vpd_pg80: %s", sysPath, err.Error())
+	}
+	// virtio-blk devices report their serial number here
+	return readSysfsAttribute(sysPath + "/serial")
+}
+
+func readSysfsWWID(sysPath string) string {
+	// NVMe namespaces have the WWID on the block device, SCSI drives have it
+	// on the SCSI device
+	return cmp.Or(readSysfsAttribute(sysPath+"/wwid"), readSysfsAttribute(sysPath+"/device/wwid"))
+}
+
+func readUdevProperties(sysPath string) map[string]string {
+	// the udev database is indexed by major:minor device number, e.g. "8:0"
+	majorMinor := readSysfsAttribute(sysPath + "/dev")
+	if majorMinor == "" {
+		return nil
+	}
+	buf, err := os.ReadFile("run/udev/data/b" + majorMinor)
+	if err != nil {
+		return nil
+	}
+	return parsers.ParseUdevData(string(buf))
+}
+
+func readSmartctlSerialNumber(devicePath string, isNVMe bool) string {
+	deviceType := "scsi"
+	if isNVMe {
+		deviceType = "nvme"
+	}
+
+	// using the relative path and skipping nsenter and chroot here since the
+	// host may not have smartctl in its PATH
+	relDevicePath := strings.TrimPrefix(devicePath, "/")
+	stdout, ok := command.Command{SkipLog: true, NoChroot: true, NoNsenter: true}.Run("smartctl", "-d", deviceType, "-i", relDevicePath)
+	if !ok {
+		return ""
+	}
+	return parsers.ParseSmartctlSerialNumber(stdout)
+}
@@ -5,66 +5,262 @@ package os
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/sapcc/go-bits/logg"
-	"github.com/sapcc/go-bits/must"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+	"github.com/sapcc/swift-drive-autopilot/pkg/util"
 )
 
-var klogErrorRx = regexp.MustCompile(`(?i)\b(?:error|metadata corruption detected|unmount and run xfs_repair)\b`)
-var klogDeviceRx = regexp.MustCompile(`\b(sd[a-z]{1,2})\b`)
+// How long to wait before restarting a kernel log reader that has failed.
+const kernelLogRestartInterval = 5 * time.Second
 
 // CollectDriveErrors implements the Interface interface.
-func (l *Linux) CollectDriveErrors(errors chan<- []DriveError) {
-	// assemble commandline for journalctl (similar to logic in Command.Run()
-	// which we cannot use here because we need a pipe on stdout)
-	command := []string{"chroot", ".", "nsenter", "--ipc=/proc/1/ns/ipc", "--", "journalctl", "-kf"}
-	if os.Geteuid() != 0 {
-		command = append([]string{"sudo"}, command...)
-	}
-
-	cmd := exec.Command(command[0], command[1:]...)
-	cmd.Stderr = os.Stderr
-	stdout := must.Return(cmd.StdoutPipe())
-	must.Succeed(cmd.Start())
-
+func (l *Linux) CollectDriveErrors(patterns func() KernelLogPatterns, errors chan<- []DriveError, alive chan<- bool) {
 	// wait for a few seconds before starting to read stuff, so that all the
 	// DriveAddedEvents have already been sent
 	time.Sleep(3 * time.Second)
 
-	reader := bufio.NewReader(stdout)
+	// prefer reading /dev/kmsg directly, but fall back to journalctl if we are
+	// not allowed to (e.g. because of kernel.dmesg_restrict)
+	var reader kernelLogReader = &kmsgReader{}
+	err := reader.Open()
+	if err != nil {
+		logg.Info("cannot read kernel log from %s, will use journalctl instead: %s", reader, err.Error())
+		reader = &journalReader{}
+		err = reader.Open()
+	}
+	if !util.InTestMode() && err == nil {
+		logg.Info("reading kernel log from %s", reader)
+	}
+
 	for {
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			logg.Error(err.Error())
+		if err != nil {
+			logg.Error("cannot read kernel log from %s (will retry in %s): %s", reader, kernelLogRestartInterval, err.Error())
+			alive <- false
+			time.Sleep(kernelLogRestartInterval)
+			err = reader.Open()
+			continue
 		}
-		//NOTE: no special handling of io.EOF here; we will encounter it very
-		// frequently anyway while we're waiting for new log lines
-		line = strings.TrimSpace(line)
-		if line == "" {
+		alive <- true
+
+		for {
+			var line string
+			line, err = reader.ReadMessage()
+			if err != nil {
+				break
+			}
+			logg.Debug("received kernel log line: '%s'", line)
+			if driveError := patterns().Match(line); driveError != nil {
+				errors <- expandNVMeControllerError(*driveError)
+			}
+		}
+
+		// the reader has failed -> restart it
+		reader.Close()
+		err = fmt.Errorf("reader failed: %w", err)
+	}
+}
+
+// The entries in /sys/class/nvme/nvmeX that refer to namespaces. With native
+// NVMe multipathing, these are the per-path devices "nvme<subsys>c<ctrl>n<ns>"
+// whose block device is "nvme<subsys>n<ns>".
+var nvmeNamespaceEntryRx = regexp.MustCompile(`^nvme(\d+)(?:c\d+)?n(\d+)$`)
+
+// If the given error was reported for an NVMe controller, report it for all
+// namespaces of that controller instead.
+func expandNVMeControllerError(driveError DriveError) []DriveError {
+	if !isNVMeController(driveError.DevicePath) {
+		return []DriveError{driveError}
+	}
+
+	// make path relative to current directory (== chroot directory)
+	controllerName := strings.TrimPrefix(driveError.DevicePath, "/dev/")
+	entries, err := os.ReadDir("sys/class/nvme/" + controllerName)
+	if err != nil {
+		logg.Error("cannot find namespaces of NVMe controller %s: %s", controllerName, err.Error())
+		return []DriveError{driveError}
+	}
+
+	var result []DriveError
+	for _, entry := range entries {
+		match := nvmeNamespaceEntryRx.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		result = append(result, DriveError{
+			DevicePath: fmt.Sprintf("/dev/nvme%sn%s", match[1], match[2]),
+			Message:    driveError.Message,
+		})
+	}
+	if len(result) == 0 {
+		logg.Info("NVMe controller %s does not have any namespaces", controllerName)
+		return []DriveError{driveError}
+	}
+	return result
+}
+
+// kernelLogReader is a backend for Linux.CollectDriveErrors.
+type kernelLogReader interface {
+	fmt.Stringer // for log messages
+	// Open starts reading the kernel log (or restarts after a failure).
+	Open() error
+	// ReadMessage blocks until the next message appears in the kernel log. An
+	// error is only returned if the reader has failed and needs to be reopened.
+	ReadMessage() (string, error)
+	// Close releases the resources held by the reader.
+	Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// /dev/kmsg
+
+type kmsgReader struct {
+	file *os.File
+	// sequence number of the last record that was read (0 if none)
+	lastSequence uint64
+	buf          []byte
+}
+
+func (r *kmsgReader) String() string {
+	return "/dev/kmsg"
+}
+
+func (r *kmsgReader) Open() error {
+	// make path relative to current directory (== chroot directory)
+	file, err := os.Open("dev/kmsg")
+	if err != nil {
+		return err
+	}
+	// On first start, skip all existing messages (errors that happened before
+	// our start have been handled by the previous instance of the autopilot).
+	// On restart, read from the start and skip records by sequence number
+	// instead, so that no messages are lost.
+	if r.lastSequence == 0 {
+		_, err = file.Seek(0, io.SeekEnd)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	r.file = file
+	if r.buf == nil {
+		// each read() returns exactly one record, which is at most 8 KiB long
+		r.buf = make([]byte, 8192)
+	}
+	return nil
+}
+
+func (r *kmsgReader) ReadMessage() (string, error) {
+	for {
+		n, err := r.file.Read(r.buf)
+		switch {
+		case errors.Is(err, syscall.EPIPE):
+			// the ring buffer overflowed and records were lost; reading continues
+			// with the oldest record that is still available
+			logg.Info("some kernel log messages were lost because /dev/kmsg was not read fast enough")
+			continue
+		case errors.Is(err, syscall.EINTR):
 			continue
+		case err != nil:
+			return "", err
 		}
 
-		// we're looking for log lines with "error" and a disk device name like "sda"
-		logg.Debug("received kernel log line: '%s'", line)
-		if !klogErrorRx.MatchString(line) {
+		record, err := parsers.ParseKmsgRecord(string(r.buf[:n]))
+		if err != nil {
+			logg.Error("cannot parse record from /dev/kmsg: %s", err.Error())
 			continue
 		}
-		match := klogDeviceRx.FindStringSubmatch(line)
-		if match == nil {
+		if record.Sequence <= r.lastSequence {
+			// already seen before a restart
+			continue
+		}
+		r.lastSequence = record.Sequence
+		if record.Facility != 0 {
+			// written into /dev/kmsg by userspace (e.g. by systemd), so this does
+			// not report the kernel's view on a drive (`journalctl -k` also skips
+			// these records)
 			continue
 		}
+		return record.Message, nil
+	}
+}
 
-		errors <- []DriveError{{
-			DevicePath: "/dev/" + match[1],
-			Message:    line,
-		}}
+func (r *kmsgReader) Close() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
 	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// journalctl
+
+type journalReader struct {
+	cmd    *exec.Cmd
+	reader *bufio.Reader
+}
+
+func (r *journalReader) String() string {
+	return "journalctl"
+}
 
-	//NOTE: the loop above will never return, so I don't bother with cmd.Wait()
+func (r *journalReader) Open() error {
+	// assemble commandline for journalctl (similar to logic in Command.Run()
+	// which we cannot use here because we need a pipe on stdout)
+	command := []string{"chroot", ".", "nsenter", "--ipc=/proc/1/ns/ipc", "--", "journalctl", "-kf"}
+	if os.Geteuid() != 0 {
+		command = append([]string{"sudo"}, command...)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	r.cmd = cmd
+	r.reader = bufio.NewReader(stdout)
+	return nil
+}
+
+func (r *journalReader) ReadMessage() (string, error) {
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			// EOF means that journalctl has exited
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return line, nil
+		}
+	}
+}
+
+func (r *journalReader) Close() {
+	if r.cmd == nil {
+		return
+	}
+	// journalctl has usually exited already when we get here, but make sure
+	// that it does not linger
+	_ = r.cmd.Process.Kill() //nolint:errcheck // the process may already be gone
+	err := r.cmd.Wait()
+	if err != nil {
+		logg.Error("journalctl exited: %s", err.Error())
+	}
+	r.cmd = nil
 }
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestKmsgReaderSkipsUserspaceRecords(t *testing.T) {
+	// like /dev/kmsg, a SOCK_SEQPACKET socket returns one record per read()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	writer := os.NewFile(uintptr(fds[0]), "kmsg-writer")
+	defer writer.Close()
+	r := &kmsgReader{file: os.NewFile(uintptr(fds[1]), "kmsg-reader"), buf: make([]byte, 8192)}
+	defer r.Close()
+
+	records := []string{
+		"3,1,100,-;blk_update_request: I/O error, dev sda, sector 1234\n",
+		// facility 1 (user) and 3 (daemon): written by userspace processes
+		"11,2,200,-;blk_update_request: I/O error, dev sdb, sector 1234\n",
+		"30,3,300,-;systemd[1]: I/O error, dev sdc\n",
+		"4,4,400,-;blk_update_request: I/O error, dev sdd, sector 1234\n",
+	}
+	for _, record := range records {
+		_, err := writer.WriteString(record)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	for _, expected := range []string{
+		"blk_update_request: I/O error, dev sda, sector 1234",
+		"blk_update_request: I/O error, dev sdd, sector 1234",
+	} {
+		actual, err := r.ReadMessage()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if actual != expected {
+			t.Errorf("expected message %q, but got %q", expected, actual)
+		}
+	}
+	if r.lastSequence != 4 {
+		t.Errorf("expected last sequence number 4, but got %d", r.lastSequence)
+	}
+}
@@ -5,6 +5,7 @@ package os
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/sapcc/go-bits/logg"
@@ -15,20 +16,24 @@ import (
 )
 
 // CreateLUKSContainer implements the Interface interface.
-func (l *Linux) CreateLUKSContainer(devicePath, key string) bool {
-	_, ok := command.Command{Stdin: key + "\n"}.Run("cryptsetup", "luksFormat", devicePath)
+func (l *Linux) CreateLUKSContainer(devicePath, key string, profile LUKSProfile) bool {
+	args := append([]string{"cryptsetup", "luksFormat"}, profile.formatArgs()...)
+	_, ok := command.Command{Stdin: key + "\n"}.Run(append(args, devicePath)...)
 	return ok
 }
 
 // OpenLUKSContainer implements the Interface interface.
-func (l *Linux) OpenLUKSContainer(devicePath, mappingName string, keys []string) (string, bool) {
+func (l *Linux) OpenLUKSContainer(devicePath, mappingName string, keys []string, profile LUKSProfile) (string, int, bool) {
+	args := append([]string{"cryptsetup", "luksOpen"}, profile.openArgs()...)
+	args = append(args, devicePath, mappingName)
+
 	// try each key until one works
 	for idx, key := range keys {
 		logg.Debug("trying to luksOpen %s as %s with key %d...", devicePath, mappingName, idx)
 		_, ok := command.Command{
 			Stdin:   key + "\n",
 			SkipLog: true,
-		}.Run("cryptsetup", "luksOpen", devicePath, mappingName)
+		}.Run(args...)
 		if ok {
 			mappedDevicePath := "/dev/mapper/" + mappingName
 			// remember this mapping
@@ -36,12 +41,12 @@ func (l *Linux) OpenLUKSContainer(devicePath, mappingName string, keys []string)
 				l.ActiveLUKSMappings = make(map[string]string)
 			}
 			l.ActiveLUKSMappings[devicePath] = mappedDevicePath
-			return mappedDevicePath, true
+			return mappedDevicePath, idx, true
 		}
 	}
 
 	// no key worked
-	return "", false
+	return "", -1, false
 }
 
 // CloseLUKSContainer implements the Interface interface.
@@ -127,3 +132,52 @@ func (l *Linux) GetLUKSMappingOf(devicePath string) string {
 	logg.Debug("discovered LUKS device path for %s is %q", devicePath, l.ActiveLUKSMappings[devicePath])
 	return l.ActiveLUKSMappings[devicePath]
 }
+
+// GetLUKSHeader implements the Interface interface.
+func (l *Linux) GetLUKSHeader(devicePath string) (parsers.LUKSHeader, bool) {
+	stdout, ok := command.Run("cryptsetup", "luksDump", devicePath)
+	if !ok {
+		return parsers.LUKSHeader{}, false
+	}
+	header, err := parsers.ParseLUKSDump(stdout)
+	if err != nil {
+		logg.Error("cannot parse `cryptsetup luksDump %s` output: %s", devicePath, err.Error())
+		return parsers.LUKSHeader{}, false
+	}
+	return header, true
+}
+
+var unlockedKeySlotRx = regexp.MustCompile(`Key slot (\d+) unlocked`)
+
+// FindLUKSKeySlot implements the Interface interface.
+func (l *Linux) FindLUKSKeySlot(devicePath, key string) (int, bool) {
+	stdout, ok := command.Command{
+		Stdin:   key + "\n",
+		SkipLog: true,
+	}.Run("cryptsetup", "luksOpen", "--test-passphrase", "--verbose", devicePath)
+	if !ok {
+		return -1, false
+	}
+	match := unlockedKeySlotRx.FindStringSubmatch(stdout)
+	if match == nil {
+		logg.Error("cannot find key slot number in `cryptsetup luksOpen --test-passphrase --verbose %s` output", devicePath)
+		return -1, false
+	}
+	slot, err := strconv.Atoi(match[1])
+	return slot, err == nil
+}
+
+// AddLUKSKey implements the Interface interface.
+func (l *Linux) AddLUKSKey(devicePath, existingKey, newKey string, profile LUKSProfile) bool {
+	// when stdin is not a TTY, cryptsetup reads both the existing and the new
+	// passphrase from stdin (one line each) without asking for verification
+	args := append([]string{"cryptsetup", "luksAddKey"}, profile.keySlotArgs()...)
+	_, ok := command.Command{Stdin: existingKey + "\n" + newKey + "\n"}.Run(append(args, devicePath)...)
+	return ok
+}
+
+// RemoveLUKSKeySlot implements the Interface interface.
+func (l *Linux) RemoveLUKSKeySlot(devicePath string, slot int, key string) bool {
+	_, ok := command.Command{Stdin: key + "\n"}.Run("cryptsetup", "luksKillSlot", devicePath, strconv.Itoa(slot))
+	return ok
+}
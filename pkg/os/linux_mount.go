@@ -4,12 +4,19 @@
 package os
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"syscall"
 
 	"github.com/sapcc/go-bits/logg"
+	"golang.org/x/sys/unix"
 
-	"github.com/sapcc/swift-drive-autopilot/pkg/command"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
 )
 
 func (l *Linux) mountScopesAreSeparate() bool {
@@ -24,33 +31,52 @@ func oppositeOf(scope MountScope) MountScope {
 }
 
 // MountDevice implements the Interface interface.
-func (l *Linux) MountDevice(devicePath, mountPath string, scope MountScope) bool {
+func (l *Linux) MountDevice(devicePath, mountPath string, options []string, scope MountScope) error {
 	// check if already mounted
 	for _, m := range l.ActiveMountPoints[scope] {
 		if m.DevicePath == devicePath && m.MountPath == mountPath {
-			return true
+			return nil
 		}
 	}
 
-	// prepare target directory
-	_, ok := command.Run("mkdir", "-m", "0700", "-p", mountPath)
-	if !ok {
-		return false
+	// mount(2) does not autodetect the filesystem type like mount(8) does
+	probeResult, err := probeDevice(devicePath)
+	if err != nil {
+		return fmt.Errorf("cannot mount %s: %w", devicePath, err)
 	}
-	// execute mount
-	_, ok = command.Command{NoNsenter: scope == LocalScope}.Run("mount", devicePath, mountPath)
-	if !ok {
-		return false
+	if !probeResult.Type.IsFilesystem() {
+		return fmt.Errorf("cannot mount %s: expected a filesystem, but found %s", devicePath, probeResult.String())
+	}
+
+	// prepare target directory and execute mount
+	flags, data := translateMountOptions(options)
+	err = inMountNamespace(scope, func() error {
+		err := createMountPoint(pathInScope(mountPath, scope))
+		if err != nil {
+			return err
+		}
+		err = unix.Mount(pathInScope(devicePath, scope), pathInScope(mountPath, scope), string(probeResult.Type), flags, data)
+		if err != nil {
+			return explainMountError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("mount of %s to %s in %s mount namespace failed: %w", devicePath, mountPath, scope, err)
 	}
 	logg.Info("mounted %s to %s in %s mount namespace", devicePath, mountPath, scope)
 	if !l.mountScopesAreSeparate() {
 		logg.Info("mounted %s to %s in %s mount namespace", devicePath, mountPath, oppositeOf(scope))
 	}
 
-	// record the new mount
+	// record the new mount (we assume that the kernel reports the options in
+	// the same way as we gave them; if not, the next RefreshMountPoints() will
+	// correct this)
 	m := MountPoint{
-		DevicePath: devicePath,
-		MountPath:  mountPath,
+		DevicePath:   devicePath,
+		MountPath:    mountPath,
+		Options:      makeOptionSet(options),
+		DeviceNumber: deviceNumberOf(devicePath),
 	}
 	if l.mountScopesAreSeparate() {
 		l.ActiveMountPoints[scope] = append(l.ActiveMountPoints[scope], m)
@@ -59,11 +85,59 @@ func (l *Linux) MountDevice(devicePath, mountPath string, scope MountScope) bool
 		l.ActiveMountPoints[LocalScope] = append(l.ActiveMountPoints[LocalScope], m)
 	}
 
-	return true
+	return nil
+}
+
+// createMountPoint creates the given directory like `mkdir -m 0700 -p` does:
+// Only the directory itself is restricted to mode 0700. Missing parent
+// directories are created with mode 0755 (e.g. /srv/node), so that the swift
+// user can traverse into its mount points.
+func createMountPoint(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.Mkdir(path, 0o700)
+	if err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// RemountDevice implements the Interface interface.
+func (l *Linux) RemountDevice(mountPath string, options []string, scope MountScope) error {
+	var current map[string]bool
+	for _, m := range l.ActiveMountPoints[scope] {
+		if m.MountPath == mountPath {
+			current = m.Options
+		}
+	}
+
+	flags, data := translateMountOptions(remountOptions(current, options))
+	err := inMountNamespace(scope, func() error {
+		return unix.Mount("", pathInScope(mountPath, scope), "", flags|unix.MS_REMOUNT, data)
+	})
+	if err != nil {
+		return fmt.Errorf("remount of %s in %s mount namespace failed: %w", mountPath, scope, explainMountError(err))
+	}
+	logg.Info("remounted %s with options %s in %s mount namespace", mountPath, strings.Join(options, ","), scope)
+
+	// record the new options
+	for _, s := range []MountScope{HostScope, LocalScope} {
+		if s != scope && l.mountScopesAreSeparate() {
+			continue
+		}
+		for idx, m := range l.ActiveMountPoints[s] {
+			if m.MountPath == mountPath {
+				l.ActiveMountPoints[s][idx] = m.withOptions(options)
+			}
+		}
+	}
+	return nil
 }
 
 // UnmountDevice implements the Interface interface.
-func (l *Linux) UnmountDevice(mountPath string, scope MountScope) bool {
+func (l *Linux) UnmountDevice(mountPath string, scope MountScope) error {
 	// check if already unmounted
 	mounted := false
 	for _, m := range l.ActiveMountPoints[scope] {
@@ -73,13 +147,15 @@ func (l *Linux) UnmountDevice(mountPath string, scope MountScope) bool {
 		}
 	}
 	if !mounted {
-		return true
+		return nil
 	}
 
 	// perform the unmount
-	_, ok := command.Command{NoNsenter: scope == LocalScope}.Run("umount", mountPath)
-	if !ok {
-		return false
+	err := inMountNamespace(scope, func() error {
+		return unix.Unmount(pathInScope(mountPath, scope), 0)
+	})
+	if err != nil {
+		return fmt.Errorf("unmount of %s in %s mount namespace failed: %w", mountPath, scope, explainMountError(err))
 	}
 	logg.Info("unmounted %s in %s mount namespace", mountPath, scope)
 	if !l.mountScopesAreSeparate() {
@@ -93,7 +169,7 @@ func (l *Linux) UnmountDevice(mountPath string, scope MountScope) bool {
 		l.ActiveMountPoints[HostScope] = removeMountPoint(l.ActiveMountPoints[HostScope], mountPath)
 		l.ActiveMountPoints[LocalScope] = removeMountPoint(l.ActiveMountPoints[LocalScope], mountPath)
 	}
-	return true
+	return nil
 }
 
 func removeMountPoint(ms []MountPoint, mountPath string) []MountPoint {
@@ -107,9 +183,9 @@ func removeMountPoint(ms []MountPoint, mountPath string) []MountPoint {
 
 // RefreshMountPoints implements the Interface interface.
 func (l *Linux) RefreshMountPoints() {
-	l.ActiveMountPoints = map[MountScope][]MountPoint{LocalScope: collectMountPoints(LocalScope)}
+	l.ActiveMountPoints = map[MountScope][]MountPoint{LocalScope: l.collectMountPoints(LocalScope)}
 	if l.mountScopesAreSeparate() {
-		l.ActiveMountPoints[HostScope] = collectMountPoints(HostScope)
+		l.ActiveMountPoints[HostScope] = l.collectMountPoints(HostScope)
 	} else {
 		// make a deep copy to ensure that editing of one list does not affect the other one inadvertently
 		l.ActiveMountPoints[HostScope] = slices.Clone(l.ActiveMountPoints[LocalScope])
@@ -122,47 +198,105 @@ func (l *Linux) RefreshMountPoints() {
 	}
 }
 
-func collectMountPoints(scope MountScope) (result []MountPoint) {
-	// `mount` is executed with chroot even for LocalScope to ensure that paths are not prefixed with the ChrootPath
-	stdout, _ := command.Command{ExitOnError: true, NoNsenter: scope == LocalScope}.Run("mount")
-
-	for line := range strings.SplitSeq(stdout, "\n") {
-		// line looks like "<device> on <mountpoint> type <type> (<options>)"
-		words := strings.Split(line, " ")
-		if len(words) < 3 || words[1] != "on" {
-			continue
-		}
-		devicePath, mountPath := words[0], words[2]
+func (l *Linux) collectMountPoints(scope MountScope) (result []MountPoint) {
+	// for HostScope, read the mount table of the host's init process (this path
+	// is relative to the current directory, i.e. the chroot directory, so it
+	// refers to the host's /proc)
+	mountInfoPath := "proc/1/mountinfo"
+	if scope == LocalScope {
+		mountInfoPath = "/proc/self/mountinfo"
+	}
+	buf, err := os.ReadFile(mountInfoPath)
+	if err != nil {
+		logg.Fatal("cannot read mount table: %s", err.Error())
+	}
+	mounts, err := parsers.ParseMountInfo(string(buf))
+	if err != nil {
+		logg.Fatal("cannot parse %s: %s", mountInfoPath, err.Error())
+	}
 
-		// parse options into a set
-		optionsStr := words[5]
-		optionsStr = strings.TrimPrefix(optionsStr, "(")
-		optionsStr = strings.TrimSuffix(optionsStr, ")")
-		options := make(map[string]bool)
-		for option := range strings.SplitSeq(optionsStr, ",") {
-			options[option] = true
+	for _, m := range mounts {
+		mountPath := m.MountPoint
+		if scope == LocalScope {
+			// our own mount table is not relative to the chroot directory (and
+			// mounts outside of it are not interesting to us)
+			var ok bool
+			mountPath, ok = l.pathInChroot(mountPath)
+			if !ok {
+				continue
+			}
 		}
 
 		// ignore mount points that have been duplicated by Docker/etc. for passing into a container
-		if strings.HasPrefix(mountPath, "/var/lib/docker/") {
+		if l.isIgnoredMountPath(mountPath) {
 			continue
 		}
-		if strings.HasPrefix(mountPath, "/var/lib/rkt/") {
-			continue
+
+		// like mount(8), report the options of the mount point and of the
+		// filesystem together
+		options := make(map[string]bool, len(m.MountOptions)+len(m.SuperOptions))
+		for _, option := range m.MountOptions {
+			options[option] = true
 		}
-		if strings.HasPrefix(mountPath, "/var/lib/kubelet/") {
-			continue
+		for _, option := range m.SuperOptions {
+			options[option] = true
 		}
 
 		result = append(result, MountPoint{
-			DevicePath: devicePath,
-			MountPath:  mountPath,
-			Options:    options,
+			DevicePath:   m.Source,
+			MountPath:    mountPath,
+			Options:      options,
+			MountID:      m.MountID,
+			DeviceNumber: m.DeviceNumber,
 		})
 	}
 	return
 }
 
+// Converts a path from our own mount namespace into a path relative to the
+// chroot directory. Returns false if the path is outside the chroot directory.
+func (l *Linux) pathInChroot(path string) (string, bool) {
+	switch {
+	case l.chrootPath == "/":
+		return path, true
+	case path == l.chrootPath:
+		return "/", true
+	case strings.HasPrefix(path, l.chrootPath+"/"):
+		return strings.TrimPrefix(path, l.chrootPath), true
+	default:
+		return "", false
+	}
+}
+
+func (l *Linux) isIgnoredMountPath(mountPath string) bool {
+	for _, ignoredPath := range l.IgnoredMountPaths {
+		ignoredPath = strings.TrimSuffix(ignoredPath, "/")
+		if mountPath == ignoredPath || strings.HasPrefix(mountPath, ignoredPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the device number (as "major:minor") of the given device, or "" if
+// it cannot be determined (e.g. because the device has disappeared).
+func deviceNumberOf(devicePath string) string {
+	// make path relative to current directory (== chroot directory)
+	fi, err := os.Stat(strings.TrimPrefix(devicePath, "/"))
+	if err != nil || fi.Mode()&os.ModeDevice == 0 {
+		return ""
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	// same encoding as major() and minor() in glibc
+	rdev := uint64(stat.Rdev) //nolint:unconvert // Rdev is not uint64 on all architectures
+	major := (rdev>>8)&0xfff | (rdev>>32)&^0xfff
+	minor := rdev&0xff | (rdev>>12)&^0xff
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
 // GetMountPointsIn implements the Interface interface.
 func (l *Linux) GetMountPointsIn(mountPathPrefix string, scope MountScope) []MountPoint {
 	if !strings.HasSuffix(mountPathPrefix, "/") {
@@ -180,9 +314,13 @@ func (l *Linux) GetMountPointsIn(mountPathPrefix string, scope MountScope) []Mou
 
 // GetMountPointsOf implements the Interface interface.
 func (l *Linux) GetMountPointsOf(devicePath string, scope MountScope) []MountPoint {
+	// prefer matching by device number since the mount table may refer to the
+	// device by a different path (e.g. /dev/dm-0 instead of /dev/mapper/foo)
+	deviceNumber := deviceNumberOf(devicePath)
+
 	var result []MountPoint
 	for _, m := range l.ActiveMountPoints[scope] {
-		if m.DevicePath == devicePath {
+		if m.DevicePath == devicePath || (deviceNumber != "" && m.DeviceNumber == deviceNumber) {
 			result = append(result, m)
 		}
 	}
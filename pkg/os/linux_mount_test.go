@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCreateMountPoint(t *testing.T) {
+	// use the same umask as mkdir(1) would usually see
+	defer unix.Umask(unix.Umask(0o022))
+
+	parentPath := filepath.Join(t.TempDir(), "srv", "node")
+	mountPath := filepath.Join(parentPath, "swift1")
+	err := createMountPoint(mountPath)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expectDirectoryMode(t, parentPath, 0o755)
+	expectDirectoryMode(t, mountPath, 0o700)
+
+	// creating an existing mount point is not an error
+	err = createMountPoint(mountPath)
+	if err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func expectDirectoryMode(t *testing.T, path string, expected fs.FileMode) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != expected {
+		t.Errorf("expected %s to be a directory with mode %o, but got %s", path, expected, fi.Mode().String())
+	}
+}
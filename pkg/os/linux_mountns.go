@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// inMountNamespace executes the given action in the mount namespace identified
+// by the given scope.
+//
+// For LocalScope, the action runs on the current thread. Since our current
+// directory is the chroot directory, paths given to syscalls must be made
+// relative with pathInScope().
+//
+// For HostScope, the action runs on a dedicated OS thread that has joined the
+// mount namespace of the host's init process (like `nsenter --mount`). This
+// also moves the thread's root and current directory to the root of the host
+// filesystem, so absolute paths can be used as-is. Since the thread cannot be
+// returned into the Go runtime's thread pool in this state, it is terminated
+// afterwards.
+func inMountNamespace(scope MountScope, action func() error) error {
+	if scope == LocalScope {
+		return action()
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		// UnlockOSThread() is never called, so the thread exits together with this goroutine
+		runtime.LockOSThread()
+		errChan <- func() error {
+			// setns(CLONE_NEWNS) is refused for threads that share their root and
+			// current directory with other threads
+			err := unix.Unshare(unix.CLONE_FS)
+			if err != nil {
+				return fmt.Errorf("unshare(CLONE_FS): %w", err)
+			}
+
+			// this path is relative to the chroot directory, like in `chroot . nsenter --mount=/proc/1/ns/mnt`
+			fd, err := unix.Open("proc/1/ns/mnt", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+			if err != nil {
+				return fmt.Errorf("open /proc/1/ns/mnt: %w", err)
+			}
+			defer unix.Close(fd)
+			err = unix.Setns(fd, unix.CLONE_NEWNS)
+			if err != nil {
+				return fmt.Errorf("setns(/proc/1/ns/mnt): %w", err)
+			}
+
+			return action()
+		}()
+	}()
+	return <-errChan
+}
+
+// pathInScope converts an absolute path into the form that syscalls executed
+// by inMountNamespace() expect.
+func pathInScope(path string, scope MountScope) string {
+	if scope == HostScope {
+		return path
+	}
+	// make path relative to current directory (== chroot directory)
+	return "./" + strings.TrimPrefix(path, "/")
+}
+
+// mountFlagOptions contains the mount options that mount(8) translates into
+// flags for mount(2), rather than passing them to the filesystem. For each
+// option, the flag is set (if the bool is true) or cleared (if it is false).
+var mountFlagOptions = map[string]struct {
+	Flag uintptr
+	Set  bool
+}{
+	"ro":            {unix.MS_RDONLY, true},
+	"rw":            {unix.MS_RDONLY, false},
+	"nosuid":        {unix.MS_NOSUID, true},
+	"suid":          {unix.MS_NOSUID, false},
+	"nodev":         {unix.MS_NODEV, true},
+	"dev":           {unix.MS_NODEV, false},
+	"noexec":        {unix.MS_NOEXEC, true},
+	"exec":          {unix.MS_NOEXEC, false},
+	"sync":          {unix.MS_SYNCHRONOUS, true},
+	"async":         {unix.MS_SYNCHRONOUS, false},
+	"dirsync":       {unix.MS_DIRSYNC, true},
+	"noatime":       {unix.MS_NOATIME, true},
+	"atime":         {unix.MS_NOATIME, false},
+	"nodiratime":    {unix.MS_NODIRATIME, true},
+	"diratime":      {unix.MS_NODIRATIME, false},
+	"relatime":      {unix.MS_RELATIME, true},
+	"norelatime":    {unix.MS_RELATIME, false},
+	"strictatime":   {unix.MS_STRICTATIME, true},
+	"nostrictatime": {unix.MS_STRICTATIME, false},
+	"lazytime":      {unix.MS_LAZYTIME, true},
+	"nolazytime":    {unix.MS_LAZYTIME, false},
+	"mand":          {unix.MS_MANDLOCK, true},
+	"nomand":        {unix.MS_MANDLOCK, false},
+	"silent":        {unix.MS_SILENT, true},
+	"loud":          {unix.MS_SILENT, false},
+}
+
+// isUserspaceMountOption returns whether the given mount option is only
+// interpreted by mount(8) or other userspace tools (e.g. "nofail" for systemd,
+// or "x-systemd.*" and "comment=..." for fstab parsers). The kernel rejects
+// these options with EINVAL, and does not report them for active mounts.
+func isUserspaceMountOption(option string) bool {
+	switch option {
+	case "auto", "noauto", "user", "nouser", "users", "nofail", "_netdev":
+		return true
+	default:
+		return strings.HasPrefix(option, "x-") || strings.HasPrefix(option, "comment=")
+	}
+}
+
+// translateMountOptions splits mount options in the same way as mount(8): into
+// flags for mount(2), and a comma-separated list of filesystem-specific
+// options (e.g. "logbufs=8"). Options that are only meaningful to userspace
+// are dropped.
+func translateMountOptions(options []string) (flags uintptr, data string) {
+	var fsOptions []string
+	for _, option := range options {
+		if option == "" || option == "defaults" || isUserspaceMountOption(option) {
+			continue
+		}
+		if f, ok := mountFlagOptions[option]; ok {
+			if f.Set {
+				flags |= f.Flag
+			} else {
+				flags &^= f.Flag
+			}
+			continue
+		}
+		fsOptions = append(fsOptions, option)
+	}
+	return flags, strings.Join(fsOptions, ",")
+}
+
+// remountOptions returns the options for remounting a mount that currently has
+// the given options. Since mount(2) resets all flags that are not given on
+// remount, the existing flags are carried over (like mount(8) does).
+// Filesystem-specific options are retained by the filesystem itself.
+func remountOptions(current map[string]bool, requested []string) []string {
+	var result []string
+	for option := range current {
+		if _, ok := mountFlagOptions[option]; ok {
+			result = append(result, option)
+		}
+	}
+	slices.Sort(result)
+	return append(result, requested...)
+}
+
+// explainMountError adds a hint to errors returned by mount(2) and umount2(2)
+// that distinguishes the common causes for each errno.
+func explainMountError(err error) error {
+	var errno unix.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+	switch errno {
+	case unix.EBUSY:
+		return fmt.Errorf("%w (the device or the mount point is in use)", err)
+	case unix.EINVAL:
+		return fmt.Errorf("%w (invalid mount options, or the filesystem superblock is corrupt)", err)
+	case unix.EUCLEAN:
+		return fmt.Errorf("%w (the filesystem is corrupt and needs to be repaired)", err)
+	case unix.ENOENT, unix.ENOTDIR:
+		return fmt.Errorf("%w (the device or mount point does not exist)", err)
+	case unix.EPERM, unix.EACCES:
+		return fmt.Errorf("%w (the autopilot must run as root with CAP_SYS_ADMIN)", err)
+	default:
+		return err
+	}
+}
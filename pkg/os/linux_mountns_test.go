@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTranslateMountOptions(t *testing.T) {
+	testCases := []struct {
+		Options       []string
+		ExpectedFlags uintptr
+		ExpectedData  string
+	}{
+		{nil, 0, ""},
+		{[]string{"defaults"}, 0, ""},
+		{[]string{"noatime", "nodev"}, unix.MS_NOATIME | unix.MS_NODEV, ""},
+		{[]string{"ro", "rw"}, 0, ""},
+		{[]string{"noatime", "logbufs=8", "logbsize=256k"}, unix.MS_NOATIME, "logbufs=8,logbsize=256k"},
+		{[]string{"errors=remount-ro", "nosuid"}, unix.MS_NOSUID, "errors=remount-ro"},
+		// options that are only interpreted by userspace are not given to the kernel
+		{[]string{"nofail", "noatime"}, unix.MS_NOATIME, ""},
+		{[]string{"auto", "noauto", "user", "nouser", "users", "_netdev"}, 0, ""},
+		{[]string{"x-systemd.device-timeout=10s", "x-mount.mkdir", "inode64"}, 0, "inode64"},
+		{[]string{"comment=swift", "noquota"}, 0, "noquota"},
+	}
+
+	for _, tc := range testCases {
+		flags, data := translateMountOptions(tc.Options)
+		if flags != tc.ExpectedFlags {
+			t.Errorf("expected flags %#x for %v, but got %#x", tc.ExpectedFlags, tc.Options, flags)
+		}
+		if data != tc.ExpectedData {
+			t.Errorf("expected data %q for %v, but got %q", tc.ExpectedData, tc.Options, data)
+		}
+	}
+}
+
+func TestMissingOptionsIgnoresUserspaceOptions(t *testing.T) {
+	// the kernel does not report userspace-only options for active mounts
+	m := MountPoint{Options: makeOptionSet([]string{"noatime"})}
+	missing := m.MissingOptions([]string{"noatime", "nofail", "x-systemd.automount", "nodev"})
+	if len(missing) != 1 || missing[0] != "nodev" {
+		t.Errorf("expected only nodev to be missing, but got %v", missing)
+	}
+}
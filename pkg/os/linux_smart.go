@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/command"
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// ReadSMARTHealth implements the Interface interface.
+func (l *Linux) ReadSMARTHealth(devicePath string) (parsers.SMARTHealth, error) {
+	// like in readSmartctlSerialNumber(), use the relative path and skip nsenter
+	// and chroot since the host may not have smartctl in its PATH; the exit
+	// status is ignored because smartctl also uses it to report e.g. a failing
+	// health check, so errors are detected by ParseSmartctlOutput() instead
+	relDevicePath := strings.TrimPrefix(devicePath, "/")
+	stdout, _ := command.Command{SkipLog: true, NoChroot: true, NoNsenter: true}.Run("smartctl", "-j", "-H", "-A", relDevicePath)
+	if strings.TrimSpace(stdout) == "" {
+		return parsers.SMARTHealth{}, errors.New("no output from smartctl (is it installed?)")
+	}
+	output, err := parsers.ParseSmartctlOutput(stdout)
+	if err != nil {
+		return parsers.SMARTHealth{}, err
+	}
+	return output.Health(), nil
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/sapcc/go-bits/logg"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// The multicast group on NETLINK_KOBJECT_UEVENT sockets that receives uevents
+// directly from the kernel. (Group 2 receives the events that udevd re-sends
+// after processing them, but udevd may not be running on the host.)
+const ueventKernelGroup = 1
+
+// Kernel uevents arrive before udevd has created the /dev/disk/by-* symlinks
+// that drive globs usually refer to. Therefore another trigger is sent after
+// this delay, when udevd should be done with the device.
+const ueventSettleDelay = 3 * time.Second
+
+// WatchBlockDeviceUevents listens for kernel uevents on a netlink socket, and
+// sends into the given channel whenever a whole block device is added,
+// removed or changed, and again after ueventSettleDelay. Sends do not block,
+// so the channel should be buffered.
+// The listener runs in a separate goroutine until the program exits. An error
+// is returned if the netlink socket cannot be opened.
+//
+// Uevents are only delivered into the initial network namespace, so the
+// autopilot needs to run in the host network namespace for this to work.
+func WatchBlockDeviceUevents(trigger chan<- struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("socket(AF_NETLINK, NETLINK_KOBJECT_UEVENT) failed: %w", err)
+	}
+	// a larger receive buffer reduces the chance of losing events when many
+	// drives appear at once (failure is not fatal since lost events are detected)
+	_ = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, 1<<20) //nolint:errcheck // see above
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: ueventKernelGroup})
+	if err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("bind(NETLINK_KOBJECT_UEVENT) failed: %w", err)
+	}
+
+	go receiveUevents(fd, trigger)
+	return nil
+}
+
+func receiveUevents(fd int, trigger chan<- struct{}) {
+	settleTimer := time.AfterFunc(ueventSettleDelay, func() { sendTrigger(trigger) })
+	settleTimer.Stop()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.ENOBUFS):
+			// the receive buffer overflowed and events were lost -> we do not know
+			// what happened, so just look at all drives again
+			logg.Info("uevent receive buffer overflowed, checking all drives")
+			sendTrigger(trigger)
+			continue
+		case err != nil:
+			logg.Error("cannot receive uevents: %s", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+
+		event, err := parsers.ParseUevent(buf[:n])
+		if err != nil {
+			logg.Debug("ignoring uevent: %s", err.Error())
+			continue
+		}
+		if event.IsDiskEvent() {
+			logg.Debug("received uevent: %s %s", event.Action, event.Vars["DEVNAME"])
+			sendTrigger(trigger)
+			settleTimer.Reset(ueventSettleDelay)
+		}
+	}
+}
+
+func sendTrigger(trigger chan<- struct{}) {
+	select {
+	case trigger <- struct{}{}:
+	default:
+		// a trigger is already pending
+	}
+}
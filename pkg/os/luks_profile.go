@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package os
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/parsers"
+)
+
+// LUKSProfile contains the parameters for creating and opening LUKS
+// containers. For all fields, the zero value selects the default of
+// cryptsetup.
+type LUKSProfile struct {
+	// format parameters (stored in the LUKS header)
+	Version    int    // 1 or 2
+	Cipher     string // e.g. "aes-xts-plain64"
+	KeySize    int    // in bits
+	SectorSize int    // in bytes (only for LUKS2)
+
+	// key slot parameters (also stored in the LUKS header)
+	PBKDF           string // "pbkdf2", "argon2i" or "argon2id"
+	PBKDFIterations int    // if set, the benchmark is skipped
+	PBKDFMemory     int    // in KiB (only for argon2)
+	PBKDFIterTime   int    // in milliseconds
+
+	// activation flags (only used when opening)
+	AllowDiscards    bool
+	NoReadWorkqueue  bool
+	NoWriteWorkqueue bool
+}
+
+// Returns the arguments for `cryptsetup luksFormat`.
+func (p LUKSProfile) formatArgs() []string {
+	var args []string
+	if p.Version != 0 {
+		args = append(args, "--type", "luks"+strconv.Itoa(p.Version))
+	}
+	if p.Cipher != "" {
+		args = append(args, "--cipher", p.Cipher)
+	}
+	if p.KeySize != 0 {
+		args = append(args, "--key-size", strconv.Itoa(p.KeySize))
+	}
+	if p.SectorSize != 0 {
+		args = append(args, "--sector-size", strconv.Itoa(p.SectorSize))
+	}
+	return append(args, p.keySlotArgs()...)
+}
+
+// Returns the arguments for `cryptsetup luksFormat` and `cryptsetup
+// luksAddKey` that concern the new key slot.
+func (p LUKSProfile) keySlotArgs() []string {
+	var args []string
+	if p.PBKDF != "" {
+		args = append(args, "--pbkdf", p.PBKDF)
+	}
+	if p.PBKDFIterations != 0 {
+		args = append(args, "--pbkdf-force-iterations", strconv.Itoa(p.PBKDFIterations))
+	}
+	if p.PBKDFMemory != 0 {
+		args = append(args, "--pbkdf-memory", strconv.Itoa(p.PBKDFMemory))
+	}
+	if p.PBKDFIterTime != 0 {
+		args = append(args, "--iter-time", strconv.Itoa(p.PBKDFIterTime))
+	}
+	return args
+}
+
+// Returns the arguments for `cryptsetup luksOpen`.
+func (p LUKSProfile) openArgs() []string {
+	var args []string
+	if p.AllowDiscards {
+		args = append(args, "--allow-discards")
+	}
+	if p.NoReadWorkqueue {
+		args = append(args, "--perf-no_read_workqueue")
+	}
+	if p.NoWriteWorkqueue {
+		args = append(args, "--perf-no_write_workqueue")
+	}
+	return args
+}
+
+// Mismatches compares the given LUKS header with this profile, and returns a
+// description of each format or key slot parameter that differs from the
+// profile. Parameters that are not set in the profile are not compared.
+func (p LUKSProfile) Mismatches(h parsers.LUKSHeader) []string {
+	var result []string
+	if p.Version != 0 && h.Version != p.Version {
+		result = append(result, fmt.Sprintf("version is %d (expected %d)", h.Version, p.Version))
+	}
+	if p.Cipher != "" && h.Cipher != p.Cipher {
+		result = append(result, fmt.Sprintf("cipher is %s (expected %s)", h.Cipher, p.Cipher))
+	}
+	if p.KeySize != 0 && h.KeySize != p.KeySize {
+		result = append(result, fmt.Sprintf("key size is %d bits (expected %d bits)", h.KeySize, p.KeySize))
+	}
+	if p.SectorSize != 0 && h.SectorSize != p.SectorSize {
+		result = append(result, fmt.Sprintf("sector size is %d bytes (expected %d bytes)", h.SectorSize, p.SectorSize))
+	}
+	if p.PBKDF != "" {
+		for _, slot := range h.KeySlots {
+			if slot.PBKDF != p.PBKDF {
+				result = append(result, fmt.Sprintf("key slot %d uses PBKDF %s (expected %s)", slot.Index, slot.PBKDF, p.PBKDF))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseDriveAuditConfig parses a drive-audit.conf file as used by
+// swift-drive-audit, and returns the values of all `regex_pattern_N` options
+// in the [drive-audit] section, in the order in which they appear in the file.
+// Only the subset of the INI syntax of Python's ConfigParser that is relevant
+// for these options is supported.
+func ParseDriveAuditConfig(buf string) ([]string, error) {
+	var (
+		patterns      []string
+		section       string
+		lastWasOption bool
+	)
+	for idx, line := range strings.Split(buf, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			lastWasOption = false
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			lastWasOption = false
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of a multi-line value, which is not useful for regexes
+			if lastWasOption && section == "drive-audit" {
+				return nil, fmt.Errorf("line %d: multi-line values are not supported", idx+1)
+			}
+		default:
+			sepIdx := strings.IndexAny(trimmed, "=:")
+			if sepIdx < 0 {
+				return nil, fmt.Errorf("line %d: expected \"key = value\", but got %q", idx+1, trimmed)
+			}
+			key := strings.ToLower(strings.TrimSpace(trimmed[:sepIdx]))
+			value := strings.TrimSpace(trimmed[sepIdx+1:])
+			lastWasOption = strings.HasPrefix(key, "regex_pattern_")
+			if section == "drive-audit" && lastWasOption {
+				// ConfigParser performs interpolation, so literal percent signs are escaped
+				patterns = append(patterns, strings.ReplaceAll(value, "%%", "%"))
+			}
+		}
+	}
+	return patterns, nil
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDriveAuditConfig(t *testing.T) {
+	input := `
+[drive-audit]
+# device_dir = /srv/node
+minutes = 60
+error_limit = 1
+log_file_pattern = /var/log/kern.*[!.][!g][!z]
+regex_pattern_1 = \berror\b.*\b(sd[a-z]{1,2}\d?)\b
+Regex_Pattern_2: \b(sd[a-z]{1,2}\d?)\b.*\berror\b
+; regex_pattern_3 = commented out
+
+[other-section]
+regex_pattern_1 = not relevant
+`
+	actual, err := ParseDriveAuditConfig(input)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []string{
+		`\berror\b.*\b(sd[a-z]{1,2}\d?)\b`,
+		`\b(sd[a-z]{1,2}\d?)\b.*\berror\b`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, actual)
+	}
+
+	_, err = ParseDriveAuditConfig("[drive-audit]\nregex_pattern_1 = foo\n  bar\n")
+	if err == nil {
+		t.Error("expected error for multi-line value, but got none")
+	}
+}
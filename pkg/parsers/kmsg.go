@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KmsgRecord contains a parsed record from /dev/kmsg.
+type KmsgRecord struct {
+	// Priority is the syslog log level, from 0 (emerg) to 7 (debug).
+	Priority int
+	// Facility is the syslog facility (0 for messages from the kernel itself).
+	Facility int
+	// Sequence is the sequence number of the record. Gaps in the sequence
+	// indicate that records were lost.
+	Sequence uint64
+	// Timestamp is the time since boot (in the CLOCK_MONOTONIC clock).
+	Timestamp time.Duration
+	// Message is the text of the record, without the dictionary of
+	// continuation lines (like "SUBSYSTEM=scsi") that may follow it.
+	Message string
+}
+
+// ParseKmsgRecord parses a single record as returned by read() on /dev/kmsg.
+// The record looks like "6,1234,5678901,-;message text\n", optionally
+// followed by continuation lines beginning with a space.
+func ParseKmsgRecord(buf string) (KmsgRecord, error) {
+	var r KmsgRecord
+	prefix, message, ok := strings.Cut(buf, ";")
+	if !ok {
+		return r, errors.New("no message found in kmsg record")
+	}
+	fields := strings.Split(prefix, ",")
+	if len(fields) < 3 {
+		return r, errors.New("malformed prefix in kmsg record: " + prefix)
+	}
+
+	prio, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return r, errors.New("malformed priority in kmsg record: " + fields[0])
+	}
+	r.Priority = prio & 7
+	r.Facility = prio >> 3
+	r.Sequence, err = strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return r, errors.New("malformed sequence number in kmsg record: " + fields[1])
+	}
+	usecs, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return r, errors.New("malformed timestamp in kmsg record: " + fields[2])
+	}
+	r.Timestamp = time.Duration(usecs) * time.Microsecond
+
+	// strip continuation lines
+	message, _, _ = strings.Cut(message, "\n")
+	r.Message = message
+	return r, nil
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseKmsgRecord(t *testing.T) {
+	testCases := map[string]KmsgRecord{
+		"3,1027,171255410,-;blk_update_request: I/O error, dev sdc, sector 1234 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 0\n": {
+			Priority:  3,
+			Facility:  0,
+			Sequence:  1027,
+			Timestamp: 171255410 * time.Microsecond,
+			Message:   "blk_update_request: I/O error, dev sdc, sector 1234 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 0",
+		},
+		"30,1028,171255999,c;sd 0:0:2:0: [sdc] tag#17 Sense Key : Medium Error [current]\n SUBSYSTEM=scsi\n DEVICE=+scsi:0:0:2:0\n": {
+			Priority:  6,
+			Facility:  3,
+			Sequence:  1028,
+			Timestamp: 171255999 * time.Microsecond,
+			Message:   "sd 0:0:2:0: [sdc] tag#17 Sense Key : Medium Error [current]",
+		},
+	}
+	for input, expected := range testCases {
+		actual, err := ParseKmsgRecord(input)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", input, err.Error())
+			continue
+		}
+		if actual != expected {
+			t.Errorf("expected %#v, but got %#v", expected, actual)
+		}
+	}
+
+	for _, input := range []string{"no semicolon", "6,1;short prefix", "x,1,2,-;bad priority", "6,1,y,-;bad timestamp"} {
+		_, err := ParseKmsgRecord(input)
+		if err == nil {
+			t.Errorf("expected error for %q, but got none", input)
+		}
+	}
+}
@@ -5,7 +5,7 @@ package parsers
 
 import (
 	"encoding/json"
-	"fmt"
+	"strings"
 )
 
 // LsblkOutput contains the parsed output from `lsblk -J`.
@@ -48,6 +48,9 @@ func (d LsblkDevice) findBackingDeviceForLUKSRecursively(mappingName string) *st
 	for _, child := range d.Children {
 		if child.Type == "crypt" && child.Name == mappingName {
 			devPath := d.devicePath()
+			if devPath == "" {
+				return nil
+			}
 			return &devPath
 		}
 	}
@@ -81,7 +84,7 @@ func (o LsblkOutput) FindSerialNumberForDevice(devicePath string) *string {
 
 func findDeviceByPath(devices []LsblkDevice, devicePath string) *LsblkDevice {
 	for _, d := range devices {
-		if d.devicePath() == devicePath {
+		if d.devicePath() == devicePath && devicePath != "" {
 			return &d
 		}
 		childResult := findDeviceByPath(d.Children, devicePath)
@@ -92,13 +95,17 @@ func findDeviceByPath(devices []LsblkDevice, devicePath string) *LsblkDevice {
 	return nil
 }
 
+// Returns an empty string for device types that we do not know about, since
+// those cannot be the devices that we are looking for.
 func (d LsblkDevice) devicePath() string {
-	switch d.Type {
-	case "crypt", "mpath":
+	switch {
+	case d.Type == "crypt", d.Type == "mpath", d.Type == "lvm", d.Type == "dm":
 		return "/dev/mapper/" + d.Name
-	case "disk", "part", "rom", "loop":
+	case d.Type == "disk", d.Type == "part", d.Type == "rom", d.Type == "loop", d.Type == "md", strings.HasPrefix(d.Type, "raid"):
+		// NVMe namespaces (e.g. "nvme0n1") and their partitions (e.g.
+		// "nvme0n1p1") also have these types
 		return "/dev/" + d.Name
 	default:
-		panic(fmt.Sprintf("do not know how to compute devicePath for %#v", d))
+		return ""
 	}
 }
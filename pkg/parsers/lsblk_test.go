@@ -22,6 +22,11 @@ func TestFindBackingDeviceForLUKS(t *testing.T) {
 			"usr":          "/dev/sda3",
 			"DOESNOTEXIST": "",
 		},
+		"fixtures/lsblk-nvme.json": {
+			"S5XJNA0R100123":    "/dev/nvme1n1",
+			"S5XJNA0R100123_n2": "/dev/nvme1n2",
+			"DOESNOTEXIST":      "",
+		},
 	}
 	for fileName, testCases := range testCasesPerFile {
 		buf, err := os.ReadFile(fileName)
@@ -58,6 +63,14 @@ func TestFindSerialNumberForDevice(t *testing.T) {
 			"/dev/sda3": "usr",
 			"/dev/null": "",
 		},
+		"fixtures/lsblk-nvme.json": {
+			"/dev/nvme0n1":         "",
+			"/dev/nvme1n1":         "S5XJNA0R100123",
+			"/dev/nvme1n2":         "S5XJNA0R100123_n2",
+			"/dev/nvme2n1":         "",
+			"/dev/mapper/vg0-root": "",
+			"/dev/null":            "",
+		},
 	}
 	for fileName, testCases := range testCasesPerFile {
 		buf, err := os.ReadFile(fileName)
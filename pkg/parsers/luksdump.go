@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LUKSHeader contains the parsed output from `cryptsetup luksDump`.
+type LUKSHeader struct {
+	// Version is 1 for LUKS1 and 2 for LUKS2.
+	Version int
+	// Cipher is the cipher specification of the data, e.g. "aes-xts-plain64".
+	Cipher string
+	// KeySize is the size of the volume key in bits.
+	KeySize int
+	// SectorSize is the encryption sector size in bytes.
+	SectorSize int
+	// KeySlots contains all active key slots, ordered by index.
+	KeySlots []LUKSKeySlot
+}
+
+// LUKSKeySlot appears in type LUKSHeader.
+type LUKSKeySlot struct {
+	Index int
+	// PBKDF is the key derivation function of this slot, e.g. "pbkdf2" or "argon2id".
+	PBKDF string
+}
+
+var (
+	luksVersionRx  = regexp.MustCompile(`(?m)^Version:\s*(\d+)\s*$`)
+	luks1KeySlotRx = regexp.MustCompile(`(?m)^Key Slot (\d+): ENABLED\s*$`)
+	// LUKS1 fields look like "Cipher name:   \taes"
+	luks1FieldRx = regexp.MustCompile(`(?m)^(Cipher name|Cipher mode|MK bits):\s*(\S+)\s*$`)
+	// in LUKS2, key slots are listed below "Keyslots:" as e.g. "  0: luks2", and
+	// data segments are listed below "Data segments:" as e.g. "  0: crypt"
+	luks2EntryRx = regexp.MustCompile(`^  (\d+): \S+\s*$`)
+	// fields of LUKS2 key slots and data segments look like "\tcipher: aes-xts-plain64"
+	// or "\tKey:        512 bits"
+	luks2FieldRx = regexp.MustCompile(`^\t([A-Za-z ]+):\s*(\S+)`)
+)
+
+// ParseLUKSDump parses output from `cryptsetup luksDump` for LUKS1 or LUKS2
+// headers.
+func ParseLUKSDump(buf string) (LUKSHeader, error) {
+	var h LUKSHeader
+	match := luksVersionRx.FindStringSubmatch(buf)
+	if match == nil {
+		return h, errors.New("no LUKS version found")
+	}
+	h.Version, _ = strconv.Atoi(match[1]) //nolint:errcheck // cannot fail because of regex
+
+	switch h.Version {
+	case 1:
+		parseLUKS1Dump(buf, &h)
+	case 2:
+		parseLUKS2Dump(buf, &h)
+	default:
+		return h, errors.New("unsupported LUKS version " + match[1])
+	}
+	return h, nil
+}
+
+func parseLUKS1Dump(buf string, h *LUKSHeader) {
+	fields := make(map[string]string)
+	for _, match := range luks1FieldRx.FindAllStringSubmatch(buf, -1) {
+		fields[match[1]] = match[2]
+	}
+	h.Cipher = fields["Cipher name"] + "-" + fields["Cipher mode"]
+	h.KeySize, _ = strconv.Atoi(fields["MK bits"]) //nolint:errcheck // a missing value is reported as 0
+	// LUKS1 does not support any other sector size or PBKDF
+	h.SectorSize = 512
+	for _, match := range luks1KeySlotRx.FindAllStringSubmatch(buf, -1) {
+		slot, _ := strconv.Atoi(match[1]) //nolint:errcheck // cannot fail because of regex
+		h.KeySlots = append(h.KeySlots, LUKSKeySlot{Index: slot, PBKDF: "pbkdf2"})
+	}
+}
+
+func parseLUKS2Dump(buf string, h *LUKSHeader) {
+	sections := luks2Sections(buf)
+
+	// we only look at the first data segment (cryptsetup only ever creates one)
+	for _, segment := range luks2Entries(sections["Data segments"]) {
+		h.Cipher = segment.Fields["cipher"]
+		h.SectorSize, _ = strconv.Atoi(segment.Fields["sector"]) //nolint:errcheck // a missing value is reported as 0
+		break
+	}
+	for _, slot := range luks2Entries(sections["Keyslots"]) {
+		if h.KeySize == 0 {
+			h.KeySize, _ = strconv.Atoi(slot.Fields["Key"]) //nolint:errcheck // a missing value is reported as 0
+		}
+		h.KeySlots = append(h.KeySlots, LUKSKeySlot{Index: slot.Index, PBKDF: slot.Fields["PBKDF"]})
+	}
+}
+
+// Splits the LUKS2 dump into sections like "Keyslots:" or "Data segments:",
+// and returns the lines of each section by section name.
+func luks2Sections(buf string) map[string][]string {
+	result := make(map[string][]string)
+	currentSection := ""
+	for line := range strings.SplitSeq(buf, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			result[currentSection] = append(result[currentSection], line)
+			continue
+		}
+		// unindented line: either a section header, or a toplevel field like "Version: 2"
+		name, isSectionHeader := strings.CutSuffix(strings.TrimSpace(line), ":")
+		if isSectionHeader {
+			currentSection = name
+		} else {
+			currentSection = ""
+		}
+	}
+	return result
+}
+
+type luks2Entry struct {
+	Index  int
+	Fields map[string]string
+}
+
+// Splits a LUKS2 section into its numbered entries. Only the first word of
+// each field value is retained (e.g. "512" for "512 bits").
+func luks2Entries(lines []string) []luks2Entry {
+	var result []luks2Entry
+	for _, line := range lines {
+		if match := luks2EntryRx.FindStringSubmatch(line); match != nil {
+			idx, _ := strconv.Atoi(match[1]) //nolint:errcheck // cannot fail because of regex
+			result = append(result, luks2Entry{Index: idx, Fields: make(map[string]string)})
+			continue
+		}
+		if match := luks2FieldRx.FindStringSubmatch(line); match != nil && len(result) > 0 {
+			fields := result[len(result)-1].Fields
+			if _, exists := fields[match[1]]; !exists {
+				fields[match[1]] = match[2]
+			}
+		}
+	}
+	return result
+}
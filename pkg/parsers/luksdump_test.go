@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseLUKSDump(t *testing.T) {
+	testCases := map[string]LUKSHeader{
+		"fixtures/luksdump-luks1.txt": {
+			Version:    1,
+			Cipher:     "aes-xts-plain64",
+			KeySize:    256,
+			SectorSize: 512,
+			KeySlots:   []LUKSKeySlot{{Index: 0, PBKDF: "pbkdf2"}, {Index: 2, PBKDF: "pbkdf2"}},
+		},
+		"fixtures/luksdump-luks2.txt": {
+			Version:    2,
+			Cipher:     "aes-xts-plain64",
+			KeySize:    512,
+			SectorSize: 4096,
+			KeySlots:   []LUKSKeySlot{{Index: 0, PBKDF: "pbkdf2"}, {Index: 3, PBKDF: "pbkdf2"}},
+		},
+	}
+	for fileName, expected := range testCases {
+		buf, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		actual, err := ParseLUKSDump(string(buf))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", fileName, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected %#v, but got %#v", fileName, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MountInfo describes a single line from /proc/<pid>/mountinfo. The format is
+// documented in proc(5).
+type MountInfo struct {
+	MountID  int
+	ParentID int
+	// DeviceNumber is the "major:minor" of the mounted device, e.g. "8:0".
+	DeviceNumber string
+	// Root is the path of the directory within the filesystem that is mounted
+	// (usually "/", unless this is a bind-mount of a subdirectory).
+	Root       string
+	MountPoint string
+	// MountOptions are the options of this mount point (e.g. "rw" or "noatime").
+	MountOptions []string
+	// OptionalFields contain the propagation flags of this mount point (e.g.
+	// "shared:1" or "master:2").
+	OptionalFields []string
+	FilesystemType string
+	// Source is the mounted device (e.g. "/dev/sda"), or a placeholder for
+	// pseudo-filesystems (e.g. "proc" or "none").
+	Source string
+	// SuperOptions are the options of the filesystem (e.g. "ro" when the
+	// filesystem was remounted read-only after an error, or "logbsize=256k").
+	SuperOptions []string
+}
+
+// ParseMountInfo parses the contents of /proc/<pid>/mountinfo.
+func ParseMountInfo(buf string) ([]MountInfo, error) {
+	var result []MountInfo
+	for idx, line := range strings.Split(buf, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m, err := parseMountInfoLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("parse mountinfo line %d: %w", idx+1, err)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func parseMountInfoLine(line string) (m MountInfo, err error) {
+	// line looks like
+	// "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue",
+	// where the number of optional fields before the "-" is variable
+	fields := strings.Fields(line)
+	sepIdx := -1
+	for idx := 6; idx < len(fields); idx++ {
+		if fields[idx] == "-" {
+			sepIdx = idx
+			break
+		}
+	}
+	if len(fields) < 6 || sepIdx < 0 || len(fields) < sepIdx+4 {
+		return MountInfo{}, fmt.Errorf("malformed line: %q", line)
+	}
+
+	m.MountID, err = strconv.Atoi(fields[0])
+	if err != nil {
+		return MountInfo{}, fmt.Errorf("malformed mount ID: %w", err)
+	}
+	m.ParentID, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return MountInfo{}, fmt.Errorf("malformed parent ID: %w", err)
+	}
+	m.DeviceNumber = fields[2]
+	m.Root = unescapeMountInfo(fields[3])
+	m.MountPoint = unescapeMountInfo(fields[4])
+	m.MountOptions = strings.Split(fields[5], ",")
+	m.OptionalFields = fields[6:sepIdx]
+	m.FilesystemType = unescapeMountInfo(fields[sepIdx+1])
+	m.Source = unescapeMountInfo(fields[sepIdx+2])
+	m.SuperOptions = strings.Split(fields[sepIdx+3], ",")
+	return m, nil
+}
+
+// The kernel escapes space, tab, newline and backslash in paths as octal
+// sequences, e.g. "\040" for space.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for idx := 0; idx < len(s); idx++ {
+		if s[idx] == '\\' && idx+3 < len(s) {
+			value, err := strconv.ParseUint(s[idx+1:idx+4], 8, 8)
+			if err == nil {
+				b.WriteByte(byte(value))
+				idx += 3
+				continue
+			}
+		}
+		b.WriteByte(s[idx])
+	}
+	return b.String()
+}
+
+// HasPropagation returns whether mount events propagate into or out of this
+// mount point, i.e. whether it is a shared or slave mount.
+func (m MountInfo) HasPropagation() bool {
+	for _, field := range m.OptionalFields {
+		if strings.HasPrefix(field, "shared:") || strings.HasPrefix(field, "master:") || strings.HasPrefix(field, "propagate_from:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	buf, err := os.ReadFile("fixtures/mountinfo.txt")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mounts, err := ParseMountInfo(string(buf))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(mounts) != 9 {
+		t.Fatalf("expected 9 mounts, but got %d", len(mounts))
+	}
+
+	expected := []MountInfo{
+		{
+			MountID:        108,
+			ParentID:       22,
+			DeviceNumber:   "254:1",
+			Root:           "/",
+			MountPoint:     "/srv/node/swift1",
+			MountOptions:   []string{"rw", "noatime"},
+			OptionalFields: []string{"shared:57"},
+			FilesystemType: "xfs",
+			Source:         "/dev/mapper/ABCDEFGH",
+			SuperOptions:   []string{"rw", "attr2", "inode64", "logbufs=8", "logbsize=256k", "noquota"},
+		},
+		{
+			MountID:        110,
+			ParentID:       22,
+			DeviceNumber:   "8:32",
+			Root:           "/",
+			MountPoint:     "/srv/node/swift two",
+			MountOptions:   []string{"rw", "noatime"},
+			OptionalFields: []string{"master:58"},
+			FilesystemType: "xfs",
+			Source:         "/dev/sdc",
+			SuperOptions:   []string{"ro", "attr2", "inode64", "noquota"},
+		},
+	}
+	if !reflect.DeepEqual(mounts[6:8], expected) {
+		t.Errorf("expected %#v, but got %#v", expected, mounts[6:8])
+	}
+
+	if !mounts[6].HasPropagation() || !mounts[7].HasPropagation() || mounts[5].HasPropagation() {
+		t.Error("unexpected result from HasPropagation()")
+	}
+}
+
+func TestParseMountInfoErrors(t *testing.T) {
+	testCases := map[string]string{
+		"22 1 259:2 / / rw,relatime shared:1 ext4 /dev/nvme0n1p2 rw": `parse mountinfo line 1: malformed line: "22 1 259:2 / / rw,relatime shared:1 ext4 /dev/nvme0n1p2 rw"`,
+		"22 1 259:2 / / rw,relatime - ext4 /dev/nvme0n1p2":           `parse mountinfo line 1: malformed line: "22 1 259:2 / / rw,relatime - ext4 /dev/nvme0n1p2"`,
+		"\nfoo 1 259:2 / / rw,relatime - ext4 /dev/nvme0n1p2 rw":     `parse mountinfo line 2: malformed mount ID: strconv.Atoi: parsing "foo": invalid syntax`,
+	}
+	for input, expected := range testCases {
+		_, err := ParseMountInfo(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q for %q, but got %v", expected, input, err)
+		}
+	}
+}
+
+func TestUnescapeMountInfo(t *testing.T) {
+	testCases := map[string]string{
+		`/srv/node/plain`:         "/srv/node/plain",
+		`/srv/node/with\040space`: "/srv/node/with space",
+		`/mnt/tab\011and\134back`: "/mnt/tab\tand\\back",
+		`/mnt/invalid\999`:        `/mnt/invalid\999`,
+		`/mnt/truncated\04`:       `/mnt/truncated\04`,
+	}
+	for input, expected := range testCases {
+		if actual := unescapeMountInfo(input); actual != expected {
+			t.Errorf("expected %q to unescape to %q, but got %q", input, expected, actual)
+		}
+	}
+}
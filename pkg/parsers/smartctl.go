@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// This is used to extract a drive's serial number from `smartctl -i`. (SCSI
+// drives report "Serial number", NVMe drives report "Serial Number".)
+var serialNumberRx = regexp.MustCompile(`(?mi)^Serial number:\s*(\S+)\s*$`)
+
+// ParseSmartctlSerialNumber extracts the serial number from the output of
+// `smartctl -i`, or returns "" if there is none. Serial numbers that contain
+// whitespace are not recognized (see SmartctlCanReportSerialNumber).
+func ParseSmartctlSerialNumber(output string) string {
+	match := serialNumberRx.FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// SmartctlCanReportSerialNumber returns whether ParseSmartctlSerialNumber()
+// recognizes the given serial number in the output of `smartctl -i`, i.e.
+// whether it does not contain whitespace. Before the serial number could be
+// read from sysfs or udev, SCSI/SATA drives were only identified through
+// `smartctl -i`, so drives for which this returns false were identified by
+// the fallback ID instead.
+func SmartctlCanReportSerialNumber(serial string) bool {
+	return serial != "" && !strings.ContainsAny(serial, " \t\n\f\r")
+}
+
+// SmartctlOutput contains the parsed output from `smartctl -j -H -A`. Only
+// those fields are included that are needed for SMARTHealth.
+type SmartctlOutput struct {
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+		ExitStatus int `json:"exit_status"`
+	} `json:"smartctl"`
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	ATASmartAttributes struct {
+		Table []SmartctlATAAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	SCSIGrownDefectList *int64 `json:"scsi_grown_defect_list"`
+	SCSIPendingDefects  *struct {
+		Count int64 `json:"count"`
+	} `json:"scsi_pending_defects"`
+}
+
+// SmartctlATAAttribute appears in type SmartctlOutput.
+type SmartctlATAAttribute struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Raw  struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+// IDs of ATA SMART attributes.
+const (
+	ataReallocatedSectorCount  = 5
+	ataCurrentPendingSectorCnt = 197
+)
+
+// ParseSmartctlOutput parses output from `smartctl -j`. An error is returned
+// if smartctl reports that it could not read from the device. (Other bits in
+// the exit status, e.g. for a failing SMART health check, are not errors.)
+func ParseSmartctlOutput(buf string) (out SmartctlOutput, err error) {
+	err = json.Unmarshal([]byte(buf), &out)
+	if err != nil {
+		return out, err
+	}
+
+	// bit 0 = command line did not parse, bit 1 = device open failed
+	if out.Smartctl.ExitStatus&0x3 != 0 {
+		var msgs []string
+		for _, msg := range out.Smartctl.Messages {
+			msgs = append(msgs, msg.String)
+		}
+		if len(msgs) == 0 {
+			return out, fmt.Errorf("smartctl failed with exit status %d", out.Smartctl.ExitStatus)
+		}
+		return out, errors.New(strings.Join(msgs, "; "))
+	}
+	return out, nil
+}
+
+// SMARTHealth contains the health indicators of a drive that the autopilot
+// looks at. Each field is nil if the drive does not report it.
+type SMARTHealth struct {
+	// Passed is the result of the drive's overall health self-assessment.
+	Passed *bool
+	// TemperatureCelsius is the current temperature of the drive.
+	TemperatureCelsius *int64
+	// ReallocatedSectors is the number of sectors that were remapped to spare
+	// sectors after failing (the grown defect list for SCSI drives).
+	ReallocatedSectors *int64
+	// PendingSectors is the number of unstable sectors that are waiting to be
+	// remapped.
+	PendingSectors *int64
+}
+
+// Health extracts the health indicators from the smartctl output.
+func (o SmartctlOutput) Health() SMARTHealth {
+	var h SMARTHealth
+	if o.SmartStatus != nil {
+		h.Passed = &o.SmartStatus.Passed
+	}
+	if o.Temperature != nil {
+		h.TemperatureCelsius = &o.Temperature.Current
+	}
+
+	for _, attr := range o.ATASmartAttributes.Table {
+		switch attr.ID {
+		case ataReallocatedSectorCount:
+			h.ReallocatedSectors = &attr.Raw.Value
+		case ataCurrentPendingSectorCnt:
+			h.PendingSectors = &attr.Raw.Value
+		}
+	}
+	if o.SCSIGrownDefectList != nil {
+		h.ReallocatedSectors = o.SCSIGrownDefectList
+	}
+	if o.SCSIPendingDefects != nil {
+		h.PendingSectors = &o.SCSIPendingDefects.Count
+	}
+	return h
+}
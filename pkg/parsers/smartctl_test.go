@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestParseSmartctlOutput(t *testing.T) {
+	// health indicators are formatted as strings to make nil values visible
+	format := func(h SMARTHealth) string {
+		str := func(v any) string {
+			switch v := v.(type) {
+			case *bool:
+				if v != nil {
+					return fmt.Sprint(*v)
+				}
+			case *int64:
+				if v != nil {
+					return fmt.Sprint(*v)
+				}
+			}
+			return "nil"
+		}
+		return fmt.Sprintf("passed=%s temperature=%s reallocated=%s pending=%s",
+			str(h.Passed), str(h.TemperatureCelsius), str(h.ReallocatedSectors), str(h.PendingSectors))
+	}
+
+	testCases := map[string]string{
+		"fixtures/smartctl-ata.json":  "passed=true temperature=36 reallocated=24 pending=8",
+		"fixtures/smartctl-scsi.json": "passed=false temperature=41 reallocated=1532 pending=3",
+		"fixtures/smartctl-nvme.json": "passed=true temperature=38 reallocated=nil pending=nil",
+	}
+	for fileName, expected := range testCases {
+		buf, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		output, err := ParseSmartctlOutput(string(buf))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", fileName, err.Error())
+			continue
+		}
+		actual := format(output.Health())
+		if actual != expected {
+			t.Errorf("%s: expected %q, but got %q", fileName, expected, actual)
+		}
+	}
+}
+
+func TestParseSmartctlOutputErrors(t *testing.T) {
+	testCases := map[string]string{
+		`{ "smartctl": { "messages": [ { "string": "/dev/sdx: No such device", "severity": "error" } ], "exit_status": 2 } }`: "/dev/sdx: No such device",
+		`{ "smartctl": { "exit_status": 1 } }`:  "smartctl failed with exit status 1",
+		`Smartctl open device: /dev/sdx failed`: "invalid character 'S' looking for beginning of value",
+	}
+	for input, expected := range testCases {
+		_, err := ParseSmartctlOutput(input)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q for %s, but got %v", expected, input, err)
+		}
+	}
+}
+
+func TestParseSmartctlSerialNumber(t *testing.T) {
+	testCases := []struct {
+		Serial            string
+		ExpectRecognition bool
+	}{
+		{"Z1Z0ABCD", true},
+		{"S3Z2NB0K123456A", true},
+		{"WD-WCC4N1234567", true},
+		// `smartctl -i` output with whitespace in the serial number was never
+		// recognized, so these drives were identified by the fallback ID
+		{"Z1Z0 ABCD", false},
+		{"Z1Z0\tABCD", false},
+	}
+	for _, tc := range testCases {
+		output := fmt.Sprintf("Vendor:               SEAGATE\nSerial number:        %s\nDevice type:          disk\n", tc.Serial)
+		expected := ""
+		if tc.ExpectRecognition {
+			expected = tc.Serial
+		}
+		if actual := ParseSmartctlSerialNumber(output); actual != expected {
+			t.Errorf("expected serial number %q to be parsed as %q, but got %q", tc.Serial, expected, actual)
+		}
+		// the serial numbers from sysfs must be filtered in the same way, so that
+		// drives keep their ID when upgrading from a version that only used smartctl
+		if actual := SmartctlCanReportSerialNumber(tc.Serial); actual != tc.ExpectRecognition {
+			t.Errorf("expected SmartctlCanReportSerialNumber(%q) = %t, but got %t", tc.Serial, tc.ExpectRecognition, actual)
+		}
+	}
+
+	// NVMe drives report "Serial Number" instead of "Serial number"
+	if actual := ParseSmartctlSerialNumber("Model Number:      SAMSUNG MZQL2\nSerial Number:     S64GNE0R123456\n"); actual != "S64GNE0R123456" {
+		t.Errorf("expected NVMe serial number %q, but got %q", "S64GNE0R123456", actual)
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"errors"
+	"strings"
+)
+
+// ParseUdevData parses a device record from the udev database (i.e. a file
+// like /run/udev/data/b8:0), and returns the device properties contained
+// therein, e.g. ID_SERIAL or ID_WWN. Other record types (e.g. symlinks or
+// tags) are ignored.
+func ParseUdevData(buf string) map[string]string {
+	result := make(map[string]string)
+	for line := range strings.SplitSeq(buf, "\n") {
+		// property records look like "E:ID_SERIAL=..."
+		property, ok := strings.CutPrefix(line, "E:")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(property, "=")
+		if ok {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// ParseSCSIUnitSerialNumber parses the Unit Serial Number VPD page (page code
+// 0x80) of a SCSI device, as found in /sys/block/sdX/device/vpd_pg80, and
+// returns the serial number contained therein.
+func ParseSCSIUnitSerialNumber(buf []byte) (string, error) {
+	// header: peripheral qualifier/device type, page code, page length (2 bytes)
+	if len(buf) < 4 || buf[1] != 0x80 {
+		return "", errors.New("not a Unit Serial Number VPD page (0x80)")
+	}
+	length := int(buf[2])<<8 | int(buf[3])
+	if len(buf) < 4+length {
+		return "", errors.New("VPD page 0x80 is truncated")
+	}
+	// the serial number is ASCII, and usually padded with spaces (or sometimes NUL bytes)
+	serial := strings.Trim(string(buf[4:4+length]), " \x00")
+	if serial == "" {
+		return "", errors.New("VPD page 0x80 does not contain a serial number")
+	}
+	return serial, nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUdevData(t *testing.T) {
+	buf := `S:disk/by-id/wwn-0x5000c500a1b2c3d4
+S:disk/by-id/scsi-35000c500a1b2c3d4
+W:12
+I:4371229
+E:ID_TYPE=disk
+E:ID_SERIAL=ST4000NM0023_Z1Z0ABCD
+E:ID_SERIAL_SHORT=Z1Z0ABCD
+E:ID_WWN=0x5000c500a1b2c3d4
+E:ID_MODEL=ST4000NM0023
+E:ID_PATH=pci-0000:03:00.0-sas-phy0-lun-0
+G:systemd
+`
+	expected := map[string]string{
+		"ID_TYPE":         "disk",
+		"ID_SERIAL":       "ST4000NM0023_Z1Z0ABCD",
+		"ID_SERIAL_SHORT": "Z1Z0ABCD",
+		"ID_WWN":          "0x5000c500a1b2c3d4",
+		"ID_MODEL":        "ST4000NM0023",
+		"ID_PATH":         "pci-0000:03:00.0-sas-phy0-lun-0",
+	}
+	actual := ParseUdevData(buf)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, actual)
+	}
+}
+
+func TestParseSCSIUnitSerialNumber(t *testing.T) {
+	testCases := []struct {
+		Input          []byte
+		ExpectedSerial string // or "" if an error is expected
+	}{
+		{append([]byte{0x00, 0x80, 0x00, 0x14}, "        Z1Z0ABCD    "...), "Z1Z0ABCD"},
+		{append([]byte{0x00, 0x80, 0x00, 0x08}, "Z1Z0ABCD\n"...), "Z1Z0ABCD"},
+		{append([]byte{0x00, 0x80, 0x00, 0x14}, "Z1Z0ABCD"...), ""},
+		{append([]byte{0x00, 0x83, 0x00, 0x08}, "Z1Z0ABCD"...), ""},
+		{[]byte{0x00, 0x80, 0x00, 0x04, 0x20, 0x20, 0x00, 0x00}, ""},
+		{[]byte{0x00, 0x80}, ""},
+	}
+	for _, tc := range testCases {
+		actual, err := ParseSCSIUnitSerialNumber(tc.Input)
+		switch {
+		case tc.ExpectedSerial == "" && err == nil:
+			t.Errorf("expected error for %q, but got serial number %q", tc.Input, actual)
+		case tc.ExpectedSerial != "" && err != nil:
+			t.Errorf("expected serial number %q for %q, but got error: %s", tc.ExpectedSerial, tc.Input, err.Error())
+		case actual != tc.ExpectedSerial:
+			t.Errorf("expected serial number %q for %q, but got %q", tc.ExpectedSerial, tc.Input, actual)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// Uevent contains a parsed kernel uevent, as received from a
+// NETLINK_KOBJECT_UEVENT socket.
+type Uevent struct {
+	// Action is e.g. "add", "remove" or "change".
+	Action string
+	// DevPath is the path of the device below /sys, e.g. "/devices/.../block/sda".
+	DevPath string
+	// Vars contains all environment variables of the uevent, e.g. SUBSYSTEM,
+	// DEVNAME or DEVTYPE.
+	Vars map[string]string
+}
+
+// ParseUevent parses a kernel uevent message. The message consists of a
+// header like "add@/devices/.../block/sda", followed by KEY=value pairs, all
+// separated by NUL bytes.
+func ParseUevent(buf []byte) (Uevent, error) {
+	fields := bytes.Split(bytes.TrimRight(buf, "\x00"), []byte{0})
+	action, devPath, ok := strings.Cut(string(fields[0]), "@")
+	if !ok || action == "" || devPath == "" {
+		// this includes messages from udevd (which start with "libudev"), but we
+		// only subscribe to kernel messages anyway
+		return Uevent{}, errors.New("malformed uevent header")
+	}
+
+	e := Uevent{Action: action, DevPath: devPath, Vars: make(map[string]string, len(fields)-1)}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(string(field), "=")
+		if ok {
+			e.Vars[key] = value
+		}
+	}
+	return e, nil
+}
+
+// IsDiskEvent returns whether this uevent describes the addition, removal or
+// change of a whole block device (as opposed to e.g. a partition).
+func (e Uevent) IsDiskEvent() bool {
+	switch e.Action {
+	case "add", "remove", "change":
+		return e.Vars["SUBSYSTEM"] == "block" && e.Vars["DEVTYPE"] == "disk"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package parsers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUevent(t *testing.T) {
+	msg := strings.Join([]string{
+		"add@/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+		"ACTION=add",
+		"DEVPATH=/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+		"SUBSYSTEM=block",
+		"MAJOR=8",
+		"MINOR=0",
+		"DEVNAME=sda",
+		"DEVTYPE=disk",
+		"DISKSEQ=9",
+		"SEQNUM=4711",
+	}, "\x00") + "\x00"
+
+	actual, err := ParseUevent([]byte(msg))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := Uevent{
+		Action:  "add",
+		DevPath: "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+		Vars: map[string]string{
+			"ACTION":    "add",
+			"DEVPATH":   "/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+			"SUBSYSTEM": "block",
+			"MAJOR":     "8",
+			"MINOR":     "0",
+			"DEVNAME":   "sda",
+			"DEVTYPE":   "disk",
+			"DISKSEQ":   "9",
+			"SEQNUM":    "4711",
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %#v, but got %#v", expected, actual)
+	}
+	if !actual.IsDiskEvent() {
+		t.Error("expected IsDiskEvent() to be true")
+	}
+
+	// partitions and other subsystems are not disk events
+	partition, err := ParseUevent([]byte("add@/block/sda/sda1\x00ACTION=add\x00SUBSYSTEM=block\x00DEVNAME=sda1\x00DEVTYPE=partition\x00"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if partition.IsDiskEvent() {
+		t.Error("expected IsDiskEvent() to be false for partition")
+	}
+
+	_, err = ParseUevent([]byte("libudev\x00\xfe\xed\xca\xfe"))
+	if err == nil {
+		t.Error("expected error for udevd message, but got none")
+	}
+}
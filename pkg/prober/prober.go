@@ -0,0 +1,451 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+// Package prober identifies the contents of block devices by looking for the
+// signatures of LUKS containers, filesystems, partition tables and other
+// well-known formats, similar to blkid(8).
+package prober
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Type identifies the kind of signature that was found on a device.
+type Type string
+
+const (
+	// TypeNone is returned when no known signature was found.
+	TypeNone Type = ""
+	// TypeLUKS1 is a LUKS1 container.
+	TypeLUKS1 Type = "luks1"
+	// TypeLUKS2 is a LUKS2 container.
+	TypeLUKS2 Type = "luks2"
+	// TypeXFS is an XFS filesystem.
+	TypeXFS Type = "xfs"
+	// TypeExt2 is an ext2 filesystem.
+	TypeExt2 Type = "ext2"
+	// TypeExt3 is an ext3 filesystem.
+	TypeExt3 Type = "ext3"
+	// TypeExt4 is an ext4 filesystem.
+	TypeExt4 Type = "ext4"
+	// TypeBtrfs is a btrfs filesystem.
+	TypeBtrfs Type = "btrfs"
+	// TypeSwap is a Linux swap area.
+	TypeSwap Type = "swap"
+	// TypeLVM2 is an LVM2 physical volume.
+	TypeLVM2 Type = "lvm2"
+	// TypeMDRaid is a member of a Linux software RAID (mdraid).
+	TypeMDRaid Type = "mdraid"
+	// TypeBcache is a bcache backing or caching device.
+	TypeBcache Type = "bcache"
+	// TypeGPT is a GUID partition table.
+	TypeGPT Type = "gpt"
+	// TypeMBR is a DOS/MBR partition table (or another type of boot sector).
+	TypeMBR Type = "mbr"
+)
+
+// IsLUKS returns whether this is a LUKS container of any version.
+func (t Type) IsLUKS() bool {
+	return t == TypeLUKS1 || t == TypeLUKS2
+}
+
+// IsFilesystem returns whether this is a filesystem that could be mounted.
+func (t Type) IsFilesystem() bool {
+	switch t {
+	case TypeXFS, TypeExt2, TypeExt3, TypeExt4, TypeBtrfs:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsPartitionTable returns whether this is a partition table.
+func (t Type) IsPartitionTable() bool {
+	return t == TypeGPT || t == TypeMBR
+}
+
+// Result describes a signature that was found on a device.
+type Result struct {
+	Type Type
+	// UUID and Label are empty if the format does not have them, or if they
+	// are not set.
+	UUID  string
+	Label string
+	// Blank is only set for TypeNone. It is true if the regions of the device
+	// that were examined (see Probe) are entirely zero, i.e. if the device
+	// does not contain any data, as opposed to data in an unknown format.
+	Blank bool
+}
+
+// String returns a human-readable description of this result for use in log
+// messages, e.g. "xfs (UUID 01234567-...)".
+func (r Result) String() string {
+	if r.Type == TypeNone {
+		if r.Blank {
+			return "no data"
+		}
+		return "unrecognized data"
+	}
+	var details []string
+	if r.UUID != "" {
+		details = append(details, "UUID "+r.UUID)
+	}
+	if r.Label != "" {
+		details = append(details, fmt.Sprintf("label %q", r.Label))
+	}
+	if len(details) == 0 {
+		return string(r.Type)
+	}
+	return fmt.Sprintf("%s (%s)", r.Type, strings.Join(details, ", "))
+}
+
+// Probe looks for known signatures on the given device of the given size (in
+// bytes). If no known signature is found, a Result with TypeNone is returned,
+// with Blank set if the first and last MiB of the device are entirely zero. An
+// error is only returned if the device cannot be read.
+//
+// Signatures that are stored at the end of the device (mdraid 0.90 and 1.0)
+// and signatures of formats that usually span the whole device (RAID members,
+// LVM, bcache) take precedence over filesystem signatures, since the former
+// may contain a valid filesystem superblock at the start of the device as
+// well. Partition tables are checked last because stale boot sectors are often
+// left behind when a device is formatted.
+func Probe(device io.ReaderAt, size int64) (Result, error) {
+	p := probe{device, size}
+	for _, check := range []func() (Result, error){
+		p.checkLUKS,
+		p.checkMDRaid,
+		p.checkLVM2,
+		p.checkBcache,
+		p.checkSwap,
+		p.checkXFS,
+		p.checkExt,
+		p.checkBtrfs,
+		p.checkGPT,
+		p.checkMBR,
+	} {
+		result, err := check()
+		if err != nil || result.Type != TypeNone {
+			return result, err
+		}
+	}
+	blank, err := p.isBlank()
+	return Result{Type: TypeNone, Blank: blank}, err
+}
+
+type probe struct {
+	device io.ReaderAt
+	size   int64
+}
+
+// Reads the given range from the device. If the range is beyond the end of
+// the device, nil is returned without an error.
+func (p probe) read(offset, length int64) ([]byte, error) {
+	if offset < 0 || offset+length > p.size {
+		return nil, nil
+	}
+	buf := make([]byte, length)
+	_, err := p.device.ReadAt(buf, offset)
+	if err != nil {
+		return nil, fmt.Errorf("read %d bytes at offset %d: %w", length, offset, err)
+	}
+	return buf, nil
+}
+
+// The size of the regions at the start and at the end of the device that
+// isBlank() looks at. All signatures that we know of are within these regions.
+const blankRegionSize = 1024 * 1024
+
+// Returns whether the regions at the start and at the end of the device are
+// entirely zero.
+func (p probe) isBlank() (bool, error) {
+	length := min(p.size, blankRegionSize)
+	for _, offset := range []int64{0, p.size - length} {
+		buf, err := p.read(offset, length)
+		if err != nil || !isZero(buf) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Returns whether the given range contains the given magic bytes.
+func (p probe) hasMagic(offset int64, magic string) (bool, error) {
+	buf, err := p.read(offset, int64(len(magic)))
+	return buf != nil && string(buf) == magic, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// encrypted containers
+
+func (p probe) checkLUKS() (Result, error) {
+	// LUKS1 and LUKS2 use the same layout for the fields that we are interested
+	// in (LUKS1 does not have a label, so that field is empty)
+	buf, err := p.read(0, 208)
+	if buf == nil || string(buf[0:6]) != "LUKS\xba\xbe" {
+		return Result{}, err
+	}
+	result := Result{UUID: cString(buf[168:208])}
+	switch binary.BigEndian.Uint16(buf[6:8]) {
+	case 1:
+		result.Type = TypeLUKS1
+	case 2:
+		result.Type = TypeLUKS2
+		result.Label = cString(buf[24:72])
+	default:
+		// unknown version, but still a LUKS header that we must not overwrite
+		result.Type = TypeLUKS2
+	}
+	return result, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// volume management
+
+const mdraidMagic = 0xa92b4efc
+
+func (p probe) checkMDRaid() (Result, error) {
+	// version 0.90 superblock: in the last 64 KiB-aligned 64 KiB of the device
+	offset := (p.size &^ (64*1024 - 1)) - 64*1024
+	buf, err := p.read(offset, 32)
+	if err != nil {
+		return Result{}, err
+	}
+	if buf != nil && binary.LittleEndian.Uint32(buf[0:4]) == mdraidMagic && binary.LittleEndian.Uint32(buf[4:8]) == 0 {
+		// the UUID is split into four words at offsets 5, 13, 14 and 15
+		words, err := p.read(offset, 64)
+		if err != nil {
+			return Result{}, err
+		}
+		uuid := slices.Concat(words[20:24], words[52:56], words[56:60], words[60:64])
+		return Result{Type: TypeMDRaid, UUID: formatMDRaidUUID(uuid)}, nil
+	}
+
+	// version 1.x superblocks: at the end of the device (1.0), at the start
+	// (1.1) or 4 KiB from the start (1.2)
+	for _, offset := range []int64{((p.size/512 - 16) &^ 7) * 512, 0, 4096} {
+		buf, err := p.read(offset, 64)
+		if err != nil {
+			return Result{}, err
+		}
+		if buf != nil && binary.LittleEndian.Uint32(buf[0:4]) == mdraidMagic && binary.LittleEndian.Uint32(buf[4:8]) == 1 {
+			return Result{
+				Type:  TypeMDRaid,
+				UUID:  formatMDRaidUUID(buf[16:32]),
+				Label: cString(buf[32:64]),
+			}, nil
+		}
+	}
+	return Result{}, nil
+}
+
+func (p probe) checkLVM2() (Result, error) {
+	// the label can be in any of the first four sectors
+	for sector := range int64(4) {
+		buf, err := p.read(sector*512, 64)
+		if err != nil {
+			return Result{}, err
+		}
+		if buf == nil || string(buf[0:8]) != "LABELONE" || string(buf[24:32]) != "LVM2 001" {
+			continue
+		}
+		// the PV header (which starts with the UUID) follows at the offset
+		// given in the label header
+		pvOffset := int64(binary.LittleEndian.Uint32(buf[20:24]))
+		uuid, err := p.read(sector*512+pvOffset, 32)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Type: TypeLVM2, UUID: formatLVMUUID(uuid)}, nil
+	}
+	return Result{}, nil
+}
+
+var bcacheMagic = "\xc6\x85\x73\xf6\x4e\x1a\x45\xca\x82\x65\xf5\x7f\x48\xba\x6d\x81"
+
+func (p probe) checkBcache() (Result, error) {
+	buf, err := p.read(4096, 104)
+	if buf == nil || string(buf[24:40]) != bcacheMagic {
+		return Result{}, err
+	}
+	return Result{Type: TypeBcache, UUID: formatUUID(buf[40:56]), Label: cString(buf[72:104])}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// filesystems and swap
+
+func (p probe) checkSwap() (Result, error) {
+	// the signature is at the end of the first page, and the page size depends
+	// on the architecture of the system that created the swap area
+	for _, pageSize := range []int64{4096, 8192, 16384, 65536} {
+		for _, magic := range []string{"SWAPSPACE2", "SWAP-SPACE"} {
+			ok, err := p.hasMagic(pageSize-10, magic)
+			if err != nil {
+				return Result{}, err
+			}
+			if !ok {
+				continue
+			}
+			buf, err := p.read(1024, 44)
+			if err != nil || buf == nil {
+				return Result{Type: TypeSwap}, err
+			}
+			return Result{Type: TypeSwap, UUID: formatUUID(buf[12:28]), Label: cString(buf[28:44])}, nil
+		}
+	}
+	return Result{}, nil
+}
+
+func (p probe) checkXFS() (Result, error) {
+	buf, err := p.read(0, 120)
+	if buf == nil || string(buf[0:4]) != "XFSB" {
+		return Result{}, err
+	}
+	return Result{Type: TypeXFS, UUID: formatUUID(buf[32:48]), Label: cString(buf[108:120])}, nil
+}
+
+// Feature flags of ext2/3/4 that are relevant for telling them apart.
+const (
+	extCompatHasJournal        = 0x0004
+	extIncompatFiletype        = 0x0002
+	extIncompatRecover         = 0x0004
+	extIncompatMetaBG          = 0x0010
+	extIncompatJournalDev      = 0x0008
+	extROCompatSupportedByExt3 = 0x0007 // sparse_super, large_file, btree_dir
+)
+
+func (p probe) checkExt() (Result, error) {
+	buf, err := p.read(1024, 136)
+	if buf == nil || binary.LittleEndian.Uint16(buf[56:58]) != 0xEF53 {
+		return Result{}, err
+	}
+	result := Result{UUID: formatUUID(buf[104:120]), Label: cString(buf[120:136])}
+
+	// same logic as in blkid: ext4 is anything that uses features that ext3
+	// does not support
+	compat := binary.LittleEndian.Uint32(buf[92:96])
+	incompat := binary.LittleEndian.Uint32(buf[96:100])
+	roCompat := binary.LittleEndian.Uint32(buf[100:104])
+	switch {
+	case incompat&extIncompatJournalDev != 0:
+		// an external journal is not a filesystem, but must not be overwritten
+		// either, so report it as the most likely filesystem type
+		result.Type = TypeExt4
+	case incompat&^(extIncompatFiletype|extIncompatRecover|extIncompatMetaBG) != 0,
+		roCompat&^extROCompatSupportedByExt3 != 0:
+		result.Type = TypeExt4
+	case compat&extCompatHasJournal != 0:
+		result.Type = TypeExt3
+	default:
+		result.Type = TypeExt2
+	}
+	return result, nil
+}
+
+func (p probe) checkBtrfs() (Result, error) {
+	buf, err := p.read(64*1024, 555)
+	if buf == nil || string(buf[64:72]) != "_BHRfS_M" {
+		return Result{}, err
+	}
+	return Result{Type: TypeBtrfs, UUID: formatUUID(buf[32:48]), Label: cString(buf[299:555])}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// partition tables
+
+func (p probe) checkGPT() (Result, error) {
+	// the GPT header is in the second logical block, so its offset depends on
+	// the logical block size
+	for _, blockSize := range []int64{512, 4096} {
+		buf, err := p.read(blockSize, 72)
+		if err != nil {
+			return Result{}, err
+		}
+		if buf != nil && string(buf[0:8]) == "EFI PART" {
+			return Result{Type: TypeGPT, UUID: formatGUID(buf[56:72])}, nil
+		}
+	}
+	return Result{}, nil
+}
+
+func (p probe) checkMBR() (Result, error) {
+	buf, err := p.read(0, 512)
+	if buf == nil || buf[510] != 0x55 || buf[511] != 0xAA {
+		return Result{}, err
+	}
+	// the disk signature is not really a UUID, but blkid reports it as such
+	result := Result{Type: TypeMBR}
+	if diskID := binary.LittleEndian.Uint32(buf[440:444]); diskID != 0 {
+		result.UUID = fmt.Sprintf("%08x", diskID)
+	}
+	return result, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// helper functions
+
+// Returns the given NUL-terminated (or NUL-padded) string.
+func cString(buf []byte) string {
+	if idx := bytes.IndexByte(buf, 0); idx >= 0 {
+		buf = buf[:idx]
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// Formats a UUID that is stored in big-endian byte order, or returns "" if the
+// UUID is all zeroes.
+func formatUUID(buf []byte) string {
+	if isZero(buf) {
+		return ""
+	}
+	s := hex.EncodeToString(buf)
+	return strings.Join([]string{s[0:8], s[8:12], s[12:16], s[16:20], s[20:32]}, "-")
+}
+
+// Formats a GUID as used by GPT, where the first three fields are stored in
+// little-endian byte order.
+func formatGUID(buf []byte) string {
+	swapped := make([]byte, 16)
+	copy(swapped, buf)
+	swapped[0], swapped[1], swapped[2], swapped[3] = buf[3], buf[2], buf[1], buf[0]
+	swapped[4], swapped[5] = buf[5], buf[4]
+	swapped[6], swapped[7] = buf[7], buf[6]
+	return formatUUID(swapped)
+}
+
+// Formats an mdraid UUID the way that mdadm does (e.g. "01234567:89abcdef:...").
+func formatMDRaidUUID(buf []byte) string {
+	if isZero(buf) {
+		return ""
+	}
+	s := hex.EncodeToString(buf)
+	return strings.Join([]string{s[0:8], s[8:16], s[16:24], s[24:32]}, ":")
+}
+
+// Formats an LVM UUID the way that LVM does (e.g. "abcdef-ghij-...").
+func formatLVMUUID(buf []byte) string {
+	if len(buf) != 32 || isZero(buf) {
+		return ""
+	}
+	s := string(buf)
+	parts := []string{s[0:6]}
+	for i := 6; i < 26; i += 4 {
+		parts = append(parts, s[i:i+4])
+	}
+	return strings.Join(append(parts, s[26:32]), "-")
+}
+
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package prober
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"syscall"
+	"testing"
+)
+
+// fakeDevice builds a device image in memory.
+type fakeDevice []byte
+
+func newFakeDevice(size int) fakeDevice {
+	return make(fakeDevice, size)
+}
+
+// randomFakeDevice builds a device image that is filled with pseudo-random
+// data (e.g. like a drive that was previously used as a LUKS container whose
+// header has been overwritten).
+func randomFakeDevice(size int) fakeDevice {
+	d := make(fakeDevice, size)
+	rng := rand.NewChaCha8([32]byte{})
+	_, _ = rng.Read(d) // cannot fail
+	return d
+}
+
+func (d fakeDevice) put(offset int, data string) fakeDevice {
+	copy(d[offset:], data)
+	return d
+}
+
+func (d fakeDevice) putUint16LE(offset int, value uint16) fakeDevice {
+	binary.LittleEndian.PutUint16(d[offset:], value)
+	return d
+}
+
+func (d fakeDevice) putUint32LE(offset int, value uint32) fakeDevice {
+	binary.LittleEndian.PutUint32(d[offset:], value)
+	return d
+}
+
+const (
+	mib       = 1024 * 1024
+	uuidBytes = "\x01\x23\x45\x67\x89\xab\xcd\xef\x01\x23\x45\x67\x89\xab\xcd\xef"
+	uuidText  = "01234567-89ab-cdef-0123-456789abcdef"
+)
+
+func TestProbe(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Device   fakeDevice
+		Expected Result
+	}{
+		{
+			Name:     "empty device",
+			Device:   newFakeDevice(mib),
+			Expected: Result{Type: TypeNone, Blank: true},
+		},
+		{
+			Name:     "device too small for any signature",
+			Device:   newFakeDevice(100),
+			Expected: Result{Type: TypeNone, Blank: true},
+		},
+		{
+			Name:     "random data",
+			Device:   randomFakeDevice(mib),
+			Expected: Result{Type: TypeNone},
+		},
+		{
+			Name:     "unknown data at the start",
+			Device:   newFakeDevice(4*mib).put(8192, "some application data"),
+			Expected: Result{Type: TypeNone},
+		},
+		{
+			Name:     "unknown data at the end",
+			Device:   newFakeDevice(4*mib).put(4*mib-4096, "some application data"),
+			Expected: Result{Type: TypeNone},
+		},
+		{
+			Name:     "unknown data outside of the examined regions",
+			Device:   newFakeDevice(4*mib).put(2*mib, "some application data"),
+			Expected: Result{Type: TypeNone, Blank: true},
+		},
+		{
+			Name:     "device too small for any signature, but not empty",
+			Device:   newFakeDevice(100).put(50, "x"),
+			Expected: Result{Type: TypeNone},
+		},
+		{
+			Name:     "LUKS1",
+			Device:   newFakeDevice(mib).put(0, "LUKS\xba\xbe\x00\x01").put(168, uuidText),
+			Expected: Result{Type: TypeLUKS1, UUID: uuidText},
+		},
+		{
+			Name:     "LUKS2",
+			Device:   newFakeDevice(mib).put(0, "LUKS\xba\xbe\x00\x02").put(24, "swift-01").put(168, uuidText),
+			Expected: Result{Type: TypeLUKS2, UUID: uuidText, Label: "swift-01"},
+		},
+		{
+			Name:     "XFS",
+			Device:   newFakeDevice(mib).put(0, "XFSB").put(32, uuidBytes).put(108, "swift-01"),
+			Expected: Result{Type: TypeXFS, UUID: uuidText, Label: "swift-01"},
+		},
+		{
+			Name:     "XFS with stale boot sector",
+			Device:   newFakeDevice(mib).put(0, "XFSB").put(32, uuidBytes).put(510, "\x55\xaa"),
+			Expected: Result{Type: TypeXFS, UUID: uuidText},
+		},
+		{
+			Name: "ext4",
+			Device: newFakeDevice(mib).putUint16LE(1024+56, 0xEF53).put(1024+104, uuidBytes).put(1024+120, "swift-01").
+				putUint32LE(1024+92, extCompatHasJournal).putUint32LE(1024+96, 0x0002|0x0040), // filetype, extents
+			Expected: Result{Type: TypeExt4, UUID: uuidText, Label: "swift-01"},
+		},
+		{
+			Name: "ext3",
+			Device: newFakeDevice(mib).putUint16LE(1024+56, 0xEF53).put(1024+104, uuidBytes).
+				putUint32LE(1024+92, extCompatHasJournal).putUint32LE(1024+96, 0x0002),
+			Expected: Result{Type: TypeExt3, UUID: uuidText},
+		},
+		{
+			Name:     "ext2",
+			Device:   newFakeDevice(mib).putUint16LE(1024+56, 0xEF53),
+			Expected: Result{Type: TypeExt2},
+		},
+		{
+			Name:     "btrfs",
+			Device:   newFakeDevice(mib).put(65536+32, uuidBytes).put(65536+64, "_BHRfS_M").put(65536+299, "data"),
+			Expected: Result{Type: TypeBtrfs, UUID: uuidText, Label: "data"},
+		},
+		{
+			Name:     "swap",
+			Device:   newFakeDevice(mib).put(1024+12, uuidBytes).put(1024+28, "swap0").put(4096-10, "SWAPSPACE2"),
+			Expected: Result{Type: TypeSwap, UUID: uuidText, Label: "swap0"},
+		},
+		{
+			Name:     "LVM2 physical volume",
+			Device:   newFakeDevice(mib).put(512, "LABELONE").putUint32LE(512+20, 32).put(512+24, "LVM2 001").put(512+32, "abcdefghijklmnopqrstuvwxyz012345"),
+			Expected: Result{Type: TypeLVM2, UUID: "abcdef-ghij-klmn-opqr-stuv-wxyz-012345"},
+		},
+		{
+			Name: "mdraid 1.2",
+			Device: newFakeDevice(mib).putUint32LE(4096, mdraidMagic).putUint32LE(4096+4, 1).
+				put(4096+16, uuidBytes).put(4096+32, "host:md0"),
+			Expected: Result{Type: TypeMDRaid, UUID: "01234567:89abcdef:01234567:89abcdef", Label: "host:md0"},
+		},
+		{
+			// the filesystem on a RAID-1 member with metadata at the end is visible
+			// at the start of the device, but the device must still be reported as
+			// a RAID member
+			Name: "mdraid 1.0 with XFS inside",
+			Device: newFakeDevice(mib).put(0, "XFSB").putUint32LE(mib-8192, mdraidMagic).putUint32LE(mib-8192+4, 1).
+				put(mib-8192+16, uuidBytes),
+			Expected: Result{Type: TypeMDRaid, UUID: "01234567:89abcdef:01234567:89abcdef"},
+		},
+		{
+			Name: "mdraid 0.90",
+			Device: newFakeDevice(mib).putUint32LE(mib-65536, mdraidMagic).
+				put(mib-65536+20, "\x01\x23\x45\x67").put(mib-65536+52, "\x89\xab\xcd\xef\x01\x23\x45\x67\x89\xab\xcd\xef"),
+			Expected: Result{Type: TypeMDRaid, UUID: "01234567:89abcdef:01234567:89abcdef"},
+		},
+		{
+			Name:     "bcache",
+			Device:   newFakeDevice(mib).put(4096+24, bcacheMagic).put(4096+40, uuidBytes),
+			Expected: Result{Type: TypeBcache, UUID: uuidText},
+		},
+		{
+			Name: "GPT",
+			Device: newFakeDevice(mib).put(510, "\x55\xaa").put(512, "EFI PART").
+				put(512+56, "\x67\x45\x23\x01\xab\x89\xef\xcd\x01\x23\x45\x67\x89\xab\xcd\xef"),
+			Expected: Result{Type: TypeGPT, UUID: uuidText},
+		},
+		{
+			Name:     "MBR",
+			Device:   newFakeDevice(mib).put(440, "\x78\x56\x34\x12").put(510, "\x55\xaa"),
+			Expected: Result{Type: TypeMBR, UUID: "12345678"},
+		},
+	}
+
+	for _, tc := range testCases {
+		actual, err := Probe(bytes.NewReader(tc.Device), int64(len(tc.Device)))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.Name, err.Error())
+			continue
+		}
+		if actual != tc.Expected {
+			t.Errorf("%s: expected %#v, but got %#v", tc.Name, tc.Expected, actual)
+		}
+	}
+}
+
+func TestResultString(t *testing.T) {
+	testCases := map[Result]string{
+		{Type: TypeNone, Blank: true}: "no data",
+		{Type: TypeNone}:              "unrecognized data",
+		{Type: TypeMBR}:               "mbr",
+		{Type: TypeXFS, UUID: uuidText, Label: "swift-01"}: `xfs (UUID ` + uuidText + `, label "swift-01")`,
+	}
+	for result, expected := range testCases {
+		if actual := result.String(); actual != expected {
+			t.Errorf("expected %#v to be described as %q, but got %q", result, expected, actual)
+		}
+	}
+}
+
+type unreadableDevice struct{}
+
+func (unreadableDevice) ReadAt(buf []byte, offset int64) (int, error) {
+	return 0, syscall.EIO
+}
+
+func TestProbeUnreadableDevice(t *testing.T) {
+	_, err := Probe(unreadableDevice{}, mib)
+	if !errors.Is(err, syscall.EIO) {
+		t.Errorf("expected EIO, but got %v", err)
+	}
+}
@@ -30,9 +30,8 @@ func SetupTestMode() {
 	}()
 
 	// This makes sure that SIGPIPE is honored and results in a clean exit.
-	//TODO: This could be extended to properly shut down the converger by
-	// posting a ShutdownEvent or similar, and could then also be used for
-	// SIGINT/SIGTERM.
+	// (Unlike SIGINT/SIGTERM, this does not go through the ShutdownEvent: Once
+	// `logexpect` has exited, nobody is interested in a graceful shutdown.)
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGPIPE)
 	go func(c <-chan os.Signal) {
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/core"
+)
+
+// Status is the response body of the /status endpoint.
+type Status struct {
+	// LastConverge is the time when the converger last finished an iteration of
+	// its event loop. It is nil until the first iteration is complete.
+	LastConverge *time.Time    `json:"last_converge"`
+	SwiftIDPool  []string      `json:"swift_id_pool"`
+	Drives       []DriveStatus `json:"drives"`
+}
+
+// DriveStatus appears in type Status.
+type DriveStatus struct {
+	DevicePath       string            `json:"device_path"`
+	DriveID          string            `json:"drive_id"`
+	WWN              string            `json:"wwn,omitempty"`
+	Model            string            `json:"model,omitempty"`
+	State            core.DriveState   `json:"state"`
+	DeviceType       string            `json:"device_type,omitempty"`
+	MappedDevicePath string            `json:"mapped_device_path,omitempty"`
+	MountedPath      string            `json:"mounted_path,omitempty"`
+	MissingOptions   []string          `json:"missing_mount_options,omitempty"`
+	HeaderMismatches []string          `json:"luks_header_mismatches,omitempty"`
+	Assignment       *AssignmentStatus `json:"assignment,omitempty"`
+	Broken           bool              `json:"broken"`
+	BrokenReason     string            `json:"broken_reason,omitempty"`
+	KernelLogErrors  map[string]int    `json:"kernel_log_errors,omitempty"`
+	SMART            *SMARTStatus      `json:"smart,omitempty"`
+	FilesystemUsage  *UsageStatus      `json:"filesystem_usage,omitempty"`
+}
+
+// SMARTStatus appears in type DriveStatus.
+type SMARTStatus struct {
+	HealthPassed       *bool  `json:"health_passed,omitempty"`
+	TemperatureCelsius *int64 `json:"temperature_celsius,omitempty"`
+	ReallocatedSectors *int64 `json:"reallocated_sectors,omitempty"`
+	PendingSectors     *int64 `json:"pending_sectors,omitempty"`
+	SuspectReason      string `json:"suspect_reason,omitempty"`
+}
+
+// UsageStatus appears in type DriveStatus.
+type UsageStatus struct {
+	TotalBytes  uint64 `json:"total_bytes"`
+	FreeBytes   uint64 `json:"free_bytes"`
+	UsedBytes   uint64 `json:"used_bytes"`
+	TotalInodes uint64 `json:"total_inodes"`
+	FreeInodes  uint64 `json:"free_inodes"`
+	NearlyFull  bool   `json:"nearly_full"`
+}
+
+// AssignmentStatus appears in type DriveStatus.
+type AssignmentStatus struct {
+	SwiftID string `json:"swift_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// The status is written by the converger thread and read by the HTTP server,
+// so it needs to be guarded by a mutex.
+var currentStatus = struct {
+	mutex  sync.RWMutex
+	status Status
+}{
+	status: Status{Drives: []DriveStatus{}},
+}
+
+// ReportStatus publishes the converger's current state on the /status endpoint.
+func (c *Converger) ReportStatus() {
+	now := time.Now()
+	status := Status{
+		LastConverge: &now,
+		SwiftIDPool:  Config.SwiftIDPool,
+		Drives:       c.getDriveStatuses(),
+	}
+
+	currentStatus.mutex.Lock()
+	defer currentStatus.mutex.Unlock()
+	currentStatus.status = status
+}
+
+// getDriveStatuses returns the status of all drives, including those that
+// are pending.
+func (c *Converger) getDriveStatuses() []DriveStatus {
+	result := make([]DriveStatus, 0, len(c.Drives)+len(c.PendingDrives))
+	for _, d := range c.Drives {
+		result = append(result, getDriveStatus(d))
+	}
+	for _, e := range c.PendingDrives {
+		result = append(result, DriveStatus{
+			DevicePath: e.DevicePath,
+			DriveID:    e.SerialNumber,
+			WWN:        e.WWN,
+			Model:      e.Model,
+			State:      core.DrivePending,
+		})
+	}
+	return result
+}
+
+func getDriveStatus(d *core.Drive) DriveStatus {
+	s := DriveStatus{
+		DevicePath:       d.DevicePath,
+		DriveID:          d.DriveID,
+		WWN:              d.WWN,
+		Model:            d.Model,
+		State:            d.State(),
+		MountedPath:      d.MountedPath(),
+		MissingOptions:   d.MissingMountOptions(),
+		HeaderMismatches: d.LUKSHeaderMismatches(),
+		Broken:           d.Broken,
+		BrokenReason:     d.BrokenReason,
+	}
+	if len(d.KernelLogErrors) > 0 {
+		s.KernelLogErrors = d.KernelLogErrorCounts()
+	}
+	if h := d.SMARTHealth; h != nil {
+		s.SMART = &SMARTStatus{
+			HealthPassed:       h.Passed,
+			TemperatureCelsius: h.TemperatureCelsius,
+			ReallocatedSectors: h.ReallocatedSectors,
+			PendingSectors:     h.PendingSectors,
+			SuspectReason:      d.SMARTSuspectReason,
+		}
+	}
+	if u := d.FilesystemUsage; u != nil {
+		s.FilesystemUsage = &UsageStatus{
+			TotalBytes:  u.TotalBytes,
+			FreeBytes:   u.FreeBytes,
+			UsedBytes:   u.UsedBytes,
+			TotalInodes: u.TotalInodes,
+			FreeInodes:  u.FreeInodes,
+			NearlyFull:  d.IsNearlyFull(),
+		}
+	}
+	if d.Device != nil {
+		s.DeviceType = d.Device.Type()
+	}
+	if luksDevice, ok := d.Device.(*core.LUKSDevice); ok {
+		s.MappedDevicePath = luksDevice.MappedDevicePath()
+	}
+	if d.Assignment != nil {
+		s.Assignment = &AssignmentStatus{
+			SwiftID: d.Assignment.SwiftID,
+			Error:   d.Assignment.ErrorMessage(d),
+		}
+	}
+	return s
+}
+
+// ServeStatus is the HTTP handler for the /status endpoint.
+func ServeStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	currentStatus.mutex.RLock()
+	buf, err := json.Marshal(currentStatus.status)
+	currentStatus.mutex.RUnlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf) //nolint:errcheck // no way to recover from write errors here
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2026 SAP SE or an SAP affiliate company
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sapcc/swift-drive-autopilot/pkg/os"
+)
+
+func getStatus(t *testing.T) Status {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ServeStatus(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected GET /status to return 200, but got %d", rec.Code)
+	}
+	var status Status
+	err := json.Unmarshal(rec.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return status
+}
+
+func TestStatusEndpoint(t *testing.T) {
+	c, osi := setupConverger(t, `{
+		swift-id-pool: [ swift1, spare ],
+		keys: [ { secret: "bzQoG5HN4onneis5bhDmnYqqacoLNCSmDbFEAb3VDztmBtGobH" } ],
+	}`)
+	osi.AddDrive("/dev/sda", &os.FakeDevice{SerialNumber: "SERIAL1"})
+	osi.AddDrive("/dev/sdb", &os.FakeDevice{SerialNumber: "SERIAL2"})
+	c.HandleEvents([]Event{
+		DriveAddedEvent{DevicePath: "/dev/sda", SerialNumber: "SERIAL1", WWN: "naa.5000c500a1b2c3d4", Model: "ST4000NM0023"},
+		DriveAddedEvent{DevicePath: "/dev/sdb", SerialNumber: "SERIAL2"},
+	})
+	c.HandleEvents([]Event{DriveErrorEvent{DevicePath: "/dev/sdb", LogLine: "I/O error on sdb"}})
+
+	status := getStatus(t)
+	if status.LastConverge == nil {
+		t.Error("expected last_converge to be set")
+	}
+	if len(status.SwiftIDPool) != 2 || status.SwiftIDPool[1] != "spare/0" {
+		t.Errorf("expected swift_id_pool to be [swift1 spare/0], but got %v", status.SwiftIDPool)
+	}
+	if len(status.Drives) != 2 {
+		t.Fatalf("expected 2 drives in status, but got %d", len(status.Drives))
+	}
+
+	d := status.Drives[0]
+	if d.DevicePath != "/dev/sda" || d.DriveID != "SERIAL1" || d.WWN != "naa.5000c500a1b2c3d4" || d.Model != "ST4000NM0023" || d.DeviceType != "luks" {
+		t.Errorf("unexpected identity of drive: %#v", d)
+	}
+	if d.MappedDevicePath != "/dev/mapper/SERIAL1" || d.MountedPath != "/srv/node/swift1" {
+		t.Errorf("unexpected device/mount paths for drive: %#v", d)
+	}
+	if d.Assignment == nil || d.Assignment.SwiftID != "swift1" || d.Assignment.Error != "" {
+		t.Errorf("unexpected assignment for drive: %#v", d.Assignment)
+	}
+	if d.Broken {
+		t.Errorf("expected %s to not be broken", d.DevicePath)
+	}
+
+	d = status.Drives[1]
+	if !d.Broken || d.BrokenReason != "potential device error seen in kernel log: I/O error on sdb" {
+		t.Errorf("expected %s to be broken because of the kernel log, but got broken = %t, reason = %q", d.DevicePath, d.Broken, d.BrokenReason)
+	}
+	if d.MountedPath != "" || d.MappedDevicePath != "" || d.Assignment != nil {
+		t.Errorf("unexpected state for broken drive: %#v", d)
+	}
+}